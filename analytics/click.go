@@ -0,0 +1,69 @@
+package analytics
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"urlshortner/models"
+)
+
+// countryHeaders are set by common CDNs and load balancers with the
+// client's ISO country code
+var countryHeaders = []string{"CF-IPCountry", "X-Country-Code", "X-Appengine-Country"}
+
+// NewClickEvent builds the click event for a redirect of urlID served to r,
+// coming from the already resolved clientIP
+func NewClickEvent(r *http.Request, urlID int, clientIP string) *models.ClickEvent {
+	ua := ParseUserAgent(r.UserAgent())
+
+	return &models.ClickEvent{
+		URLID:        urlID,
+		ClickedAt:    time.Now().UTC(),
+		ReferrerHost: ReferrerHost(r.Referer()),
+		Browser:      ua.Browser,
+		OS:           ua.OS,
+		Device:       ua.Device,
+		IP:           AnonymizeIP(clientIP),
+		Country:      country(r),
+	}
+}
+
+// ReferrerHost returns the lowercased host of a Referer header, or "" for
+// direct traffic and unparseable values
+func ReferrerHost(referrer string) string {
+	if referrer == "" {
+		return ""
+	}
+	parsed, err := url.Parse(referrer)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(parsed.Hostname())
+}
+
+// AnonymizeIP zeroes the host part of an address: the last octet of IPv4
+// and everything after the /48 prefix of IPv6
+func AnonymizeIP(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ""
+	}
+	if v4 := parsed.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(24, 32)).String()
+	}
+	return parsed.Mask(net.CIDRMask(48, 128)).String()
+}
+
+func country(r *http.Request) string {
+	for _, header := range countryHeaders {
+		code := strings.ToUpper(strings.TrimSpace(r.Header.Get(header)))
+		// Cloudflare uses XX for unknown and T1 for Tor
+		if len(code) == 2 && code != "XX" && code != "T1" {
+			return code
+		}
+	}
+	return ""
+}
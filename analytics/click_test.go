@@ -0,0 +1,72 @@
+package analytics
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNewClickEvent(t *testing.T) {
+	r := httptest.NewRequest("GET", "/u/abc", nil)
+	r.Header.Set("Referer", "https://News.Example.com/item?id=1")
+	r.Header.Set("User-Agent", "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 Version/17.0 Mobile/15E148 Safari/604.1")
+	r.Header.Set("CF-IPCountry", "de")
+
+	e := NewClickEvent(r, 7, "203.0.113.42")
+	if e.URLID != 7 || e.ClickedAt.IsZero() {
+		t.Errorf("event = %+v", e)
+	}
+	if e.ReferrerHost != "news.example.com" {
+		t.Errorf("referrer host = %q", e.ReferrerHost)
+	}
+	if e.Browser != "Safari" || e.OS != "iOS" || e.Device != DeviceMobile {
+		t.Errorf("user agent = %s/%s/%s, want Safari/iOS/mobile", e.Browser, e.OS, e.Device)
+	}
+	if e.IP != "203.0.113.0" || e.Country != "DE" {
+		t.Errorf("ip %q country %q, want the anonymized address and DE", e.IP, e.Country)
+	}
+}
+
+func TestAnonymizeIP(t *testing.T) {
+	tests := map[string]string{
+		"192.0.2.123":         "192.0.2.0",
+		"2001:db8:abcd:12::1": "2001:db8:abcd::",
+		"::ffff:198.51.100.9": "198.51.100.0",
+		"not an ip":           "",
+		"":                    "",
+	}
+	for in, want := range tests {
+		if got := AnonymizeIP(in); got != want {
+			t.Errorf("AnonymizeIP(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestCountryIgnoresUnknownCodes(t *testing.T) {
+	for _, code := range []string{"XX", "T1", "DEU", ""} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("CF-IPCountry", code)
+		if got := country(r); got != "" {
+			t.Errorf("country for %q = %q, want none", code, got)
+		}
+	}
+}
+
+func TestParseUserAgent(t *testing.T) {
+	tests := []struct {
+		ua   string
+		want UserAgent
+	}{
+		{"", UserAgent{"unknown", "unknown", DeviceUnknown}},
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 Chrome/120.0 Safari/537.36 Edg/120.0", UserAgent{"Edge", "Windows", DeviceDesktop}},
+		{"Mozilla/5.0 (Macintosh; Intel Mac OS X 10.15; rv:121.0) Gecko/20100101 Firefox/121.0", UserAgent{"Firefox", "macOS", DeviceDesktop}},
+		{"Mozilla/5.0 (Linux; Android 14; SM-X710) AppleWebKit/537.36 Chrome/120.0 Safari/537.36", UserAgent{"Chrome", "Android", DeviceTablet}},
+		{"Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 Chrome/120.0 Mobile Safari/537.36", UserAgent{"Chrome", "Android", DeviceMobile}},
+		{"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)", UserAgent{"other", "other", DeviceBot}},
+		{"curl/8.4.0", UserAgent{"curl", "other", DeviceBot}},
+	}
+	for _, tt := range tests {
+		if got := ParseUserAgent(tt.ua); got != tt.want {
+			t.Errorf("ParseUserAgent(%q) = %+v, want %+v", tt.ua, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package analytics
+
+import "strings"
+
+// Device classes reported for click events
+const (
+	DeviceDesktop = "desktop"
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceBot     = "bot"
+	DeviceUnknown = "unknown"
+)
+
+// UserAgent is the coarse classification of a User-Agent header
+type UserAgent struct {
+	Browser string
+	OS      string
+	Device  string
+}
+
+var botMarkers = []string{"bot", "crawler", "spider", "slurp", "curl", "wget", "python-requests", "go-http-client", "headless"}
+
+// ParseUserAgent classifies a User-Agent string into browser, OS and device
+// class. It only recognises the common families; anything else is "other".
+func ParseUserAgent(ua string) UserAgent {
+	if ua == "" {
+		return UserAgent{Browser: "unknown", OS: "unknown", Device: DeviceUnknown}
+	}
+	lower := strings.ToLower(ua)
+
+	return UserAgent{
+		Browser: parseBrowser(lower),
+		OS:      parseOS(lower),
+		Device:  parseDevice(lower),
+	}
+}
+
+func parseBrowser(ua string) string {
+	switch {
+	case strings.Contains(ua, "edg/"), strings.Contains(ua, "edge/"):
+		return "Edge"
+	case strings.Contains(ua, "opr/"), strings.Contains(ua, "opera"):
+		return "Opera"
+	case strings.Contains(ua, "samsungbrowser/"):
+		return "Samsung Internet"
+	case strings.Contains(ua, "firefox/"), strings.Contains(ua, "fxios/"):
+		return "Firefox"
+	case strings.Contains(ua, "chrome/"), strings.Contains(ua, "crios/"):
+		return "Chrome"
+	case strings.Contains(ua, "safari/"):
+		return "Safari"
+	case strings.Contains(ua, "msie"), strings.Contains(ua, "trident/"):
+		return "Internet Explorer"
+	case strings.Contains(ua, "curl/"):
+		return "curl"
+	default:
+		return "other"
+	}
+}
+
+func parseOS(ua string) string {
+	switch {
+	case strings.Contains(ua, "windows"):
+		return "Windows"
+	case strings.Contains(ua, "android"):
+		return "Android"
+	case strings.Contains(ua, "iphone"), strings.Contains(ua, "ipad"), strings.Contains(ua, "ipod"):
+		return "iOS"
+	case strings.Contains(ua, "mac os x"), strings.Contains(ua, "macintosh"):
+		return "macOS"
+	case strings.Contains(ua, "cros"):
+		return "ChromeOS"
+	case strings.Contains(ua, "linux"):
+		return "Linux"
+	default:
+		return "other"
+	}
+}
+
+func parseDevice(ua string) string {
+	for _, marker := range botMarkers {
+		if strings.Contains(ua, marker) {
+			return DeviceBot
+		}
+	}
+	switch {
+	case strings.Contains(ua, "ipad"), strings.Contains(ua, "tablet"),
+		strings.Contains(ua, "android") && !strings.Contains(ua, "mobile"):
+		return DeviceTablet
+	case strings.Contains(ua, "mobile"), strings.Contains(ua, "iphone"), strings.Contains(ua, "ipod"):
+		return DeviceMobile
+	default:
+		return DeviceDesktop
+	}
+}
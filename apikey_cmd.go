@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"urlshortner/auth"
+	"urlshortner/config"
+	"urlshortner/database"
+	"urlshortner/handlers"
+)
+
+// runAPIKey implements `main apikey create <name> <scope,...>`, used to
+// bootstrap the first admin key
+func runAPIKey(cfg *config.Config, args []string) error {
+	if len(args) != 3 || args[0] != "create" {
+		return fmt.Errorf("usage: apikey create <name> <scope,...>")
+	}
+	if cfg.DatabaseURL == "memory://" {
+		return fmt.Errorf("keys created in the in-memory store would be lost immediately")
+	}
+
+	scopes := strings.Split(args[2], ",")
+	for _, scope := range scopes {
+		if !auth.ValidScope(scope) {
+			return fmt.Errorf("unknown scope %q, expected one of %s", scope, strings.Join(auth.AllScopes, ", "))
+		}
+	}
+
+	store := database.InitDB(cfg.DatabaseURL)
+	defer database.DB.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	key, k, err := handlers.IssueAPIKey(ctx, store, args[1], args[1], scopes)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Created API key %d (%s) with scopes %s\n%s\n", k.ID, k.Name, strings.Join(k.Scopes, ","), key)
+	return nil
+}
@@ -0,0 +1,170 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"urlshortner/cache"
+	"urlshortner/database"
+	"urlshortner/logging"
+
+	"github.com/sirupsen/logrus"
+)
+
+var logger = logging.Component("auth")
+
+// Principal is the caller identified by an API key
+type Principal struct {
+	KeyID  int
+	Name   string
+	Owner  string
+	Scopes []string
+}
+
+// HasScope reports whether the principal was granted scope. Admin keys have
+// every scope.
+func (p *Principal) HasScope(scope string) bool {
+	for _, s := range p.Scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// CanAccess reports whether the principal may modify or inspect a link
+// belonging to owner. Unowned links are reserved for admins.
+func (p *Principal) CanAccess(owner string) bool {
+	return p.HasScope(ScopeAdmin) || (owner != "" && owner == p.Owner)
+}
+
+type principalKey struct{}
+type invalidKey struct{}
+
+// FromContext returns the authenticated principal, if any
+func FromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok
+}
+
+// WithPrincipal returns a copy of ctx carrying p
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// Authenticator resolves `Authorization: Bearer <key>` to a Principal.
+// Lookups are cached briefly, so a revoked key may keep working on other
+// replicas for up to cacheTTL.
+type Authenticator struct {
+	store    database.Store
+	cache    *cache.LRU[*Principal]
+	cacheTTL time.Duration
+}
+
+// NewAuthenticator creates an Authenticator backed by store
+func NewAuthenticator(store database.Store) *Authenticator {
+	return &Authenticator{
+		store:    store,
+		cache:    cache.NewLRU[*Principal](1000),
+		cacheTTL: 30 * time.Second,
+	}
+}
+
+// Middleware attaches the principal for a valid bearer key to the request
+// context. It never rejects requests itself; routes opt in with Require.
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Authorization")
+		if header == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key, ok := strings.CutPrefix(header, "Bearer ")
+		if !ok {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), invalidKey{}, true)))
+			return
+		}
+
+		p, err := a.Authenticate(r.Context(), strings.TrimSpace(key))
+		if err != nil {
+			if !errors.Is(err, database.ErrNotFound) {
+				logging.FromContext(r.Context()).WithError(err).Error("Failed to look up API key")
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), invalidKey{}, true)))
+			return
+		}
+		logging.AddFields(r.Context(), logrus.Fields{"principal": p.Name, "key_id": p.KeyID})
+		next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), p)))
+	})
+}
+
+// Authenticate returns the principal for an API key, or database.ErrNotFound
+// for unknown and revoked keys
+func (a *Authenticator) Authenticate(ctx context.Context, key string) (*Principal, error) {
+	hash := HashKey(key)
+	if p, ok := a.cache.Get(hash); ok {
+		if p == nil {
+			return nil, database.ErrNotFound
+		}
+		return p, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	k, err := a.store.GetAPIKeyByHash(ctx, hash)
+	if errors.Is(err, database.ErrNotFound) || (err == nil && k.RevokedAt != nil) {
+		a.cache.Add(hash, nil, a.cacheTTL)
+		return nil, database.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Principal{KeyID: k.ID, Name: k.Name, Owner: k.Owner, Scopes: k.Scopes}
+	a.cache.Add(hash, p, a.cacheTTL)
+	return p, nil
+}
+
+// Forget drops cached lookups, e.g. after a key is revoked
+func (a *Authenticator) Forget() {
+	a.cache.Purge()
+}
+
+// Authenticated rejects requests without a valid API key, whatever its scopes
+func Authenticated(next http.Handler) http.Handler {
+	return Require("")(next)
+}
+
+// Require rejects requests without a principal holding scope: 401 when no
+// valid key was presented, 403 when the key lacks the scope
+func Require(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p, ok := FromContext(r.Context())
+			if !ok {
+				msg := "API key required"
+				if invalid, _ := r.Context().Value(invalidKey{}).(bool); invalid {
+					msg = "invalid API key"
+				}
+				w.Header().Set("WWW-Authenticate", `Bearer realm="urlshortener"`)
+				http.Error(w, msg, http.StatusUnauthorized)
+				return
+			}
+			if scope != "" && !p.HasScope(scope) {
+				logger.WithFields(logrus.Fields{
+					"key_id": p.KeyID,
+					"scope":  scope,
+					"path":   r.URL.Path,
+				}).Warn("API key lacks required scope")
+				http.Error(w, "API key lacks the "+scope+" scope", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
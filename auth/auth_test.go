@@ -0,0 +1,136 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"urlshortner/database"
+	"urlshortner/models"
+)
+
+func issueKey(t *testing.T, store database.Store, owner string, scopes ...string) (string, *models.APIKey) {
+	t.Helper()
+	key, prefix, hash, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	k := &models.APIKey{Name: owner + "-key", Owner: owner, Prefix: prefix, Scopes: scopes}
+	if err := store.CreateAPIKey(context.Background(), k, hash); err != nil {
+		t.Fatal(err)
+	}
+	return key, k
+}
+
+func TestGenerateKey(t *testing.T) {
+	key, prefix, hash, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(key, keyPrefix) || len(key) != len(keyPrefix)+keyLength {
+		t.Errorf("key %q has the wrong shape", key)
+	}
+	if !strings.HasPrefix(key, prefix) || len(prefix) != displayPrefixLength {
+		t.Errorf("display prefix %q does not start the key", prefix)
+	}
+	if hash != HashKey(key) || strings.Contains(hash, key) {
+		t.Errorf("hash %q is not the hash of the key", hash)
+	}
+	if other, _, _, _ := GenerateKey(); other == key {
+		t.Error("two generated keys are equal")
+	}
+}
+
+func TestPrincipalAccess(t *testing.T) {
+	user := &Principal{Owner: "alice", Scopes: []string{ScopeCreate}}
+	admin := &Principal{Owner: "ops", Scopes: []string{ScopeAdmin}}
+
+	if !user.HasScope(ScopeCreate) || user.HasScope(ScopeManage) {
+		t.Error("user scopes not honoured")
+	}
+	if !admin.HasScope(ScopeManage) {
+		t.Error("admin lacks a scope")
+	}
+	if !user.CanAccess("alice") || user.CanAccess("bob") || user.CanAccess("") {
+		t.Error("user may only access their own links")
+	}
+	if !admin.CanAccess("bob") || !admin.CanAccess("") {
+		t.Error("admin may access every link, owned or not")
+	}
+}
+
+func TestAuthenticateCachesAndForgets(t *testing.T) {
+	ctx := context.Background()
+	store := database.NewMemoryStore()
+	a := NewAuthenticator(store)
+	key, k := issueKey(t, store, "alice", ScopeCreate)
+
+	p, err := a.Authenticate(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.KeyID != k.ID || p.Owner != "alice" || !p.HasScope(ScopeCreate) {
+		t.Errorf("principal = %+v", p)
+	}
+	if _, err := a.Authenticate(ctx, key+"x"); !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("unknown key: err = %v, want ErrNotFound", err)
+	}
+
+	// Revocation only takes effect here once the cached lookup is dropped
+	if err := store.RevokeAPIKey(ctx, k.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Authenticate(ctx, key); err != nil {
+		t.Errorf("cached key rejected before Forget: %v", err)
+	}
+	a.Forget()
+	if _, err := a.Authenticate(ctx, key); !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("revoked key: err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestMiddlewareAndRequire(t *testing.T) {
+	store := database.NewMemoryStore()
+	a := NewAuthenticator(store)
+	creator, _ := issueKey(t, store, "alice", ScopeCreate)
+	reader, _ := issueKey(t, store, "bob", ScopeStats)
+
+	var seen *Principal
+	h := a.Middleware(Require(ScopeCreate)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen, _ = FromContext(r.Context())
+	})))
+
+	tests := []struct {
+		name   string
+		header string
+		want   int
+		body   string
+	}{
+		{"valid key", "Bearer " + creator, http.StatusOK, ""},
+		{"no key", "", http.StatusUnauthorized, "API key required"},
+		{"unknown key", "Bearer us_nope", http.StatusUnauthorized, "invalid API key"},
+		{"not bearer", "Basic " + creator, http.StatusUnauthorized, "invalid API key"},
+		{"missing scope", "Bearer " + reader, http.StatusForbidden, "lacks the create scope"},
+	}
+	for _, tt := range tests {
+		seen = nil
+		req := httptest.NewRequest("POST", "/shorten", nil)
+		if tt.header != "" {
+			req.Header.Set("Authorization", tt.header)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tt.want || !strings.Contains(rec.Body.String(), tt.body) {
+			t.Errorf("%s: %d %q, want %d %q", tt.name, rec.Code, rec.Body, tt.want, tt.body)
+		}
+		if tt.want == http.StatusOK && (seen == nil || seen.Owner != "alice") {
+			t.Errorf("%s: handler saw principal %+v", tt.name, seen)
+		}
+		if tt.want == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("%s: no WWW-Authenticate challenge", tt.name)
+		}
+	}
+}
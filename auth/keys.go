@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+)
+
+// Scopes that can be granted to an API key
+const (
+	ScopeCreate = "create" // shorten URLs
+	ScopeManage = "manage" // update and delete short URLs
+	ScopeStats  = "stats"  // read access statistics
+	ScopeAdmin  = "admin"  // everything, including key management
+)
+
+// AllScopes lists every valid scope
+var AllScopes = []string{ScopeCreate, ScopeManage, ScopeStats, ScopeAdmin}
+
+const (
+	keyPrefix   = "us_"
+	keyAlphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	keyLength   = 40
+	// displayPrefixLength characters of the key are stored in clear so
+	// users can tell their keys apart
+	displayPrefixLength = 10
+)
+
+// ValidScope reports whether scope is one of AllScopes
+func ValidScope(scope string) bool {
+	for _, s := range AllScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// GenerateKey returns a new random API key, its display prefix and the hash
+// to store
+func GenerateKey() (key, prefix, hash string, err error) {
+	b := make([]byte, keyLength)
+	max := big.NewInt(int64(len(keyAlphabet)))
+	for i := range b {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", "", "", fmt.Errorf("generating API key: %w", err)
+		}
+		b[i] = keyAlphabet[n.Int64()]
+	}
+
+	key = keyPrefix + string(b)
+	return key, key[:displayPrefixLength], HashKey(key), nil
+}
+
+// HashKey returns the hex SHA-256 of an API key. Keys are long and random,
+// so a fast hash is enough to make a leaked table useless.
+func HashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
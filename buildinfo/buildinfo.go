@@ -0,0 +1,69 @@
+// Package buildinfo describes the running binary. Release builds set the
+// variables at link time:
+//
+//	go build -ldflags "-X urlshortner/buildinfo.Version=v1.4.0 \
+//	  -X urlshortner/buildinfo.Commit=$(git rev-parse HEAD) \
+//	  -X urlshortner/buildinfo.BuildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+package buildinfo
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// Set with -ldflags "-X". Commit and BuildTime fall back to the VCS stamp
+// the go command embeds when building inside a git checkout.
+var (
+	Version   = "dev"
+	Commit    = ""
+	BuildTime = ""
+)
+
+// Info is the build description reported by health and metrics endpoints
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"build_time"`
+	GoVersion string `json:"go_version"`
+}
+
+var info = load()
+
+func load() Info {
+	i := Info{
+		Version:   Version,
+		Commit:    Commit,
+		BuildTime: BuildTime,
+		GoVersion: runtime.Version(),
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				if i.Commit == "" {
+					i.Commit = s.Value
+				}
+			case "vcs.time":
+				if i.BuildTime == "" {
+					i.BuildTime = s.Value
+				}
+			case "vcs.modified":
+				if s.Value == "true" && Commit == "" {
+					i.Commit += "-dirty"
+				}
+			}
+		}
+	}
+	if i.Commit == "" {
+		i.Commit = "unknown"
+	}
+	if i.BuildTime == "" {
+		i.BuildTime = "unknown"
+	}
+	return i
+}
+
+// Get returns the build description
+func Get() Info {
+	return info
+}
@@ -0,0 +1,57 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLRUEvictsLeastRecentlyUsed(t *testing.T) {
+	c := NewLRU[int](2)
+	c.Add("a", 1, time.Minute)
+	c.Add("b", 2, time.Minute)
+	// Reading a makes b the least recently used entry
+	if v, ok := c.Get("a"); !ok || v != 1 {
+		t.Fatalf("Get(a) = %v, %v", v, ok)
+	}
+	c.Add("c", 3, time.Minute)
+
+	if _, ok := c.Get("b"); ok {
+		t.Error("b survived eviction")
+	}
+	for key, want := range map[string]int{"a": 1, "c": 3} {
+		if v, ok := c.Get(key); !ok || v != want {
+			t.Errorf("Get(%s) = %v, %v, want %d", key, v, ok, want)
+		}
+	}
+	if c.Len() != 2 || c.Evictions() != 1 {
+		t.Errorf("len %d evictions %d, want 2 and 1", c.Len(), c.Evictions())
+	}
+
+	// Replacing a value does not evict anything
+	c.Add("a", 10, time.Minute)
+	if v, _ := c.Get("a"); v != 10 || c.Evictions() != 1 {
+		t.Errorf("replaced value %d with %d evictions", v, c.Evictions())
+	}
+}
+
+func TestLRUExpiryAndRemoval(t *testing.T) {
+	c := NewLRU[string](10)
+	c.Add("short", "x", time.Millisecond)
+	c.Add("long", "y", time.Minute)
+	c.Add("gone", "z", time.Minute)
+	time.Sleep(5 * time.Millisecond)
+
+	if _, ok := c.Get("short"); ok {
+		t.Error("expired entry returned")
+	}
+	if c.Len() != 2 {
+		t.Errorf("len %d after reading an expired entry, want 2", c.Len())
+	}
+	c.Remove("gone")
+	if _, ok := c.Get("gone"); ok {
+		t.Error("removed entry returned")
+	}
+	if v, ok := c.Get("long"); !ok || v != "y" {
+		t.Errorf("Get(long) = %q, %v", v, ok)
+	}
+}
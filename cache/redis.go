@@ -0,0 +1,107 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"urlshortner/models"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	redisKeyPrefix           = "urlshortener:link:"
+	redisInvalidateChannel   = "urlshortener:invalidate"
+	redisNegativePlaceholder = "-"
+)
+
+// SharedCache is a second cache tier shared by every replica
+type SharedCache interface {
+	// Get returns found=false on a miss and a nil URL for a cached unknown code
+	Get(ctx context.Context, code string) (u *models.URL, found bool, err error)
+	Set(ctx context.Context, code string, u *models.URL, ttl time.Duration) error
+	Delete(ctx context.Context, codes ...string) error
+	// Subscribe calls fn with every code invalidated by any replica until ctx
+	// is cancelled
+	Subscribe(ctx context.Context, fn func(code string))
+}
+
+// RedisCache implements SharedCache on a Redis server. Invalidations are
+// broadcast over pub/sub so every replica can drop its local copy.
+type RedisCache struct {
+	client *redis.Client
+}
+
+// NewRedisCache wraps an existing Redis client
+func NewRedisCache(client *redis.Client) *RedisCache {
+	return &RedisCache{client: client}
+}
+
+func (c *RedisCache) Get(ctx context.Context, code string) (*models.URL, bool, error) {
+	data, err := c.client.Get(ctx, redisKeyPrefix+code).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if string(data) == redisNegativePlaceholder {
+		return nil, true, nil
+	}
+
+	var u models.URL
+	if err := json.Unmarshal(data, &u); err != nil {
+		return nil, false, err
+	}
+	return &u, true, nil
+}
+
+func (c *RedisCache) Set(ctx context.Context, code string, u *models.URL, ttl time.Duration) error {
+	value := []byte(redisNegativePlaceholder)
+	if u != nil {
+		var err error
+		if value, err = json.Marshal(u); err != nil {
+			return err
+		}
+	}
+	return c.client.Set(ctx, redisKeyPrefix+code, value, ttl).Err()
+}
+
+func (c *RedisCache) Delete(ctx context.Context, codes ...string) error {
+	if len(codes) == 0 {
+		return nil
+	}
+
+	keys := make([]string, len(codes))
+	for i, code := range codes {
+		keys[i] = redisKeyPrefix + code
+	}
+
+	pipe := c.client.Pipeline()
+	pipe.Del(ctx, keys...)
+	for _, code := range codes {
+		pipe.Publish(ctx, redisInvalidateChannel, code)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (c *RedisCache) Subscribe(ctx context.Context, fn func(code string)) {
+	sub := c.client.Subscribe(ctx, redisInvalidateChannel)
+	defer sub.Close()
+
+	ch := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+			fn(msg.Payload)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"urlshortner/database"
+	"urlshortner/models"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func newRedisClient(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	t.Helper()
+	srv := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: srv.Addr(), MaxRetries: -1})
+	t.Cleanup(func() { client.Close() })
+	return srv, client
+}
+
+// replica is one server instance: its own resolver and Redis connection,
+// sharing the store and Redis with the others
+func replica(t *testing.T, ctx context.Context, store database.Store, client *redis.Client) *Resolver {
+	t.Helper()
+	r := NewResolver(store, NewRedisCache(client), 100, time.Minute, time.Minute)
+	go r.Listen(ctx)
+	return r
+}
+
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestInvalidationReachesOtherReplicas(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	srv, client := newRedisClient(t)
+	store := database.NewMemoryStore()
+	if err := store.Create(ctx, &models.URL{URL: "https://old.example/", ShortCode: "abc"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	other := redis.NewClient(&redis.Options{Addr: srv.Addr()})
+	defer other.Close()
+	a := replica(t, ctx, store, client)
+	b := replica(t, ctx, store, other)
+	eventually(t, "both replicas to subscribe", func() bool {
+		return srv.PubSubNumSub(redisInvalidateChannel)[redisInvalidateChannel] == 2
+	})
+
+	for _, r := range []*Resolver{a, b} {
+		if u, err := r.Resolve(ctx, "abc"); err != nil || u.URL != "https://old.example/" {
+			t.Fatalf("Resolve = %v, %v", u, err)
+		}
+	}
+	if _, err := store.UpdateLink(ctx, "abc", "https://new.example/", ""); err != nil {
+		t.Fatal(err)
+	}
+	// b still serves its local copy until a invalidates the code
+	if u, _ := b.Resolve(ctx, "abc"); u.URL != "https://old.example/" {
+		t.Fatalf("b resolved %q before the invalidation", u.URL)
+	}
+
+	a.Invalidate("abc")
+	eventually(t, "b to drop its copy", func() bool {
+		u, err := b.Resolve(ctx, "abc")
+		return err == nil && u.URL == "https://new.example/"
+	})
+}
+
+func TestResolverFallsBackToStoreWhenRedisIsDown(t *testing.T) {
+	ctx := context.Background()
+	srv, client := newRedisClient(t)
+	store := database.NewMemoryStore()
+	if err := store.Create(ctx, &models.URL{URL: "https://example.com/", ShortCode: "abc"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	r := NewResolver(store, NewRedisCache(client), 0, time.Minute, time.Minute)
+	srv.Close()
+
+	u, err := r.Resolve(ctx, "abc")
+	if err != nil || u.URL != "https://example.com/" {
+		t.Fatalf("Resolve with Redis down = %v, %v", u, err)
+	}
+	if _, err := r.Resolve(ctx, "missing"); !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("Resolve of unknown code = %v, want ErrNotFound", err)
+	}
+	if r.Stats().SharedErrors == 0 {
+		t.Error("shared cache errors not counted")
+	}
+	// Invalidating must not block or panic either
+	r.Invalidate("abc")
+}
+
+func TestRedisCacheNegativeEntries(t *testing.T) {
+	ctx := context.Background()
+	_, client := newRedisClient(t)
+	c := NewRedisCache(client)
+
+	if _, found, err := c.Get(ctx, "nope"); found || err != nil {
+		t.Fatalf("empty cache Get = found %v, err %v", found, err)
+	}
+	if err := c.Set(ctx, "nope", nil, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	u, found, err := c.Get(ctx, "nope")
+	if !found || u != nil || err != nil {
+		t.Errorf("negative entry Get = %v, found %v, err %v", u, found, err)
+	}
+}
@@ -0,0 +1,258 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"urlshortner/database"
+	"urlshortner/logging"
+	"urlshortner/models"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/sync/singleflight"
+)
+
+var logger = logging.Component("cache")
+
+var tracer = otel.Tracer("urlshortner/cache")
+
+// Resolver looks up short codes for the redirect path through an LRU in
+// front of the store, optionally backed by a SharedCache between the LRU and
+// the store. Concurrent misses for the same code share one lookup, and
+// unknown codes are cached for negativeTTL. Returned URLs are shared between
+// callers and must not be modified.
+type Resolver struct {
+	store       database.Store
+	shared      SharedCache
+	lru         *LRU[*models.URL]
+	ttl         time.Duration
+	negativeTTL time.Duration
+	group       singleflight.Group
+
+	// generation is bumped on every invalidation so that a lookup racing
+	// with an update does not repopulate the cache with the old row
+	generation atomic.Uint64
+
+	hits         atomic.Int64
+	negativeHits atomic.Int64
+	misses       atomic.Int64
+	coalesced    atomic.Int64
+	sharedHits   atomic.Int64
+	sharedErrors atomic.Int64
+}
+
+// NewResolver creates a Resolver caching up to size codes in process. A size
+// of zero disables the local cache. shared may be nil; when it fails the
+// Resolver falls back to the store.
+func NewResolver(store database.Store, shared SharedCache, size int, ttl, negativeTTL time.Duration) *Resolver {
+	r := &Resolver{store: store, shared: shared, ttl: ttl, negativeTTL: negativeTTL}
+	if size > 0 {
+		r.lru = NewLRU[*models.URL](size)
+	}
+	return r
+}
+
+// Resolve returns the URL for code, or database.ErrNotFound
+func (r *Resolver) Resolve(ctx context.Context, code string) (*models.URL, error) {
+	ctx, span := tracer.Start(ctx, "cache.Resolve")
+	defer span.End()
+
+	if r.lru == nil && r.shared == nil {
+		return r.store.GetByCode(ctx, code)
+	}
+
+	if r.lru != nil {
+		if u, ok := r.lru.Get(code); ok {
+			span.SetAttributes(attribute.Bool("cache.hit", true))
+			if u == nil {
+				r.negativeHits.Add(1)
+				return nil, database.ErrNotFound
+			}
+			r.hits.Add(1)
+			return u, nil
+		}
+	}
+	r.misses.Add(1)
+	span.SetAttributes(attribute.Bool("cache.hit", false))
+
+	v, err, shared := r.group.Do(code, func() (interface{}, error) {
+		return r.load(ctx, code)
+	})
+	if shared {
+		r.coalesced.Add(1)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return v.(*models.URL), nil
+}
+
+func (r *Resolver) load(ctx context.Context, code string) (*models.URL, error) {
+	generation := r.generation.Load()
+
+	// The query is shared by every waiting caller, so it must not be
+	// cancelled just because the first one went away
+	loadCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+
+	u, found := r.loadShared(loadCtx, code)
+	if !found {
+		var err error
+		u, err = r.store.GetByCode(loadCtx, code)
+		if err != nil && !errors.Is(err, database.ErrNotFound) {
+			return nil, err
+		}
+		r.storeShared(loadCtx, code, u)
+	}
+
+	if r.lru != nil && r.generation.Load() == generation {
+		r.lru.Add(code, u, r.ttlFor(u))
+	}
+	if u == nil {
+		return nil, database.ErrNotFound
+	}
+	return u, nil
+}
+
+func (r *Resolver) loadShared(ctx context.Context, code string) (*models.URL, bool) {
+	if r.shared == nil {
+		return nil, false
+	}
+	u, found, err := r.shared.Get(ctx, code)
+	if err != nil {
+		r.sharedErrors.Add(1)
+		logger.WithError(err).Debug("Shared cache lookup failed, falling back to database")
+		return nil, false
+	}
+	if found {
+		r.sharedHits.Add(1)
+	}
+	return u, found
+}
+
+func (r *Resolver) storeShared(ctx context.Context, code string, u *models.URL) {
+	if r.shared == nil {
+		return
+	}
+	if err := r.shared.Set(ctx, code, u, r.ttlFor(u)); err != nil {
+		r.sharedErrors.Add(1)
+		logger.WithError(err).Debug("Failed to populate shared cache")
+	}
+}
+
+func (r *Resolver) ttlFor(u *models.URL) time.Duration {
+	if u == nil {
+		return r.negativeTTL
+	}
+	return r.ttl
+}
+
+// Invalidate forgets any cached state for the given codes, on this replica
+// and in the shared cache
+func (r *Resolver) Invalidate(codes ...string) {
+	r.invalidateLocal(codes...)
+
+	if r.shared != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		if err := r.shared.Delete(ctx, codes...); err != nil {
+			r.sharedErrors.Add(1)
+			logger.WithError(err).Warn("Failed to invalidate shared cache")
+		}
+	}
+}
+
+func (r *Resolver) invalidateLocal(codes ...string) {
+	r.generation.Add(1)
+	for _, code := range codes {
+		if r.lru != nil {
+			r.lru.Remove(code)
+		}
+		r.group.Forget(code)
+	}
+}
+
+// Listen drops local copies of codes invalidated by other replicas until ctx
+// is cancelled. It returns immediately without a shared cache.
+func (r *Resolver) Listen(ctx context.Context) {
+	if r.shared == nil || r.lru == nil {
+		return
+	}
+	r.shared.Subscribe(ctx, func(code string) {
+		r.invalidateLocal(code)
+	})
+}
+
+// CacheStats is the JSON view of the resolver counters
+type CacheStats struct {
+	Enabled      bool  `json:"enabled"`
+	Size         int   `json:"size"`
+	Hits         int64 `json:"hits"`
+	NegativeHits int64 `json:"negative_hits"`
+	Misses       int64 `json:"misses"`
+	Coalesced    int64 `json:"coalesced"`
+	Evictions    int64 `json:"evictions"`
+	Shared       bool  `json:"shared"`
+	SharedHits   int64 `json:"shared_hits"`
+	SharedErrors int64 `json:"shared_errors"`
+}
+
+// Stats returns a snapshot of the cache counters
+func (r *Resolver) Stats() CacheStats {
+	stats := CacheStats{
+		Enabled:      r.lru != nil,
+		Hits:         r.hits.Load(),
+		NegativeHits: r.negativeHits.Load(),
+		Misses:       r.misses.Load(),
+		Coalesced:    r.coalesced.Load(),
+		Shared:       r.shared != nil,
+		SharedHits:   r.sharedHits.Load(),
+		SharedErrors: r.sharedErrors.Load(),
+	}
+	if r.lru != nil {
+		stats.Size = r.lru.Len()
+		stats.Evictions = r.lru.Evictions()
+	}
+	return stats
+}
+
+// Report implements monitoring.Reporter
+func (r *Resolver) Report() (string, interface{}) {
+	return "cache", r.Stats()
+}
+
+var (
+	lookupsDesc      = prometheus.NewDesc("urlshortener_cache_lookups_total", "Redirect cache lookups by result", []string{"result"}, nil)
+	coalescedDesc    = prometheus.NewDesc("urlshortener_cache_coalesced_total", "Cache misses that shared an in-flight lookup", nil, nil)
+	evictionsDesc    = prometheus.NewDesc("urlshortener_cache_evictions_total", "Entries evicted to stay within the size limit", nil, nil)
+	entriesDesc      = prometheus.NewDesc("urlshortener_cache_entries", "Entries currently cached", nil, nil)
+	sharedHitsDesc   = prometheus.NewDesc("urlshortener_cache_shared_hits_total", "Local cache misses answered by the shared cache", nil, nil)
+	sharedErrorsDesc = prometheus.NewDesc("urlshortener_cache_shared_errors_total", "Shared cache operations that failed", nil, nil)
+)
+
+// Describe implements prometheus.Collector
+func (r *Resolver) Describe(ch chan<- *prometheus.Desc) {
+	ch <- lookupsDesc
+	ch <- coalescedDesc
+	ch <- evictionsDesc
+	ch <- entriesDesc
+	ch <- sharedHitsDesc
+	ch <- sharedErrorsDesc
+}
+
+// Collect implements prometheus.Collector
+func (r *Resolver) Collect(ch chan<- prometheus.Metric) {
+	stats := r.Stats()
+	ch <- prometheus.MustNewConstMetric(lookupsDesc, prometheus.CounterValue, float64(stats.Hits), "hit")
+	ch <- prometheus.MustNewConstMetric(lookupsDesc, prometheus.CounterValue, float64(stats.NegativeHits), "negative_hit")
+	ch <- prometheus.MustNewConstMetric(lookupsDesc, prometheus.CounterValue, float64(stats.Misses), "miss")
+	ch <- prometheus.MustNewConstMetric(coalescedDesc, prometheus.CounterValue, float64(stats.Coalesced))
+	ch <- prometheus.MustNewConstMetric(evictionsDesc, prometheus.CounterValue, float64(stats.Evictions))
+	ch <- prometheus.MustNewConstMetric(entriesDesc, prometheus.GaugeValue, float64(stats.Size))
+	ch <- prometheus.MustNewConstMetric(sharedHitsDesc, prometheus.CounterValue, float64(stats.SharedHits))
+	ch <- prometheus.MustNewConstMetric(sharedErrorsDesc, prometheus.CounterValue, float64(stats.SharedErrors))
+}
@@ -0,0 +1,123 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"urlshortner/database"
+	"urlshortner/models"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// countingStore counts lookups and, when release is set, holds each one
+// until it is closed
+type countingStore struct {
+	database.Store
+	lookups atomic.Int64
+	release chan struct{}
+}
+
+func (s *countingStore) GetByCode(ctx context.Context, code string) (*models.URL, error) {
+	s.lookups.Add(1)
+	if s.release != nil {
+		<-s.release
+	}
+	return s.Store.GetByCode(ctx, code)
+}
+
+func newCountingStore(t *testing.T) *countingStore {
+	t.Helper()
+	store := &countingStore{Store: database.NewMemoryStore()}
+	if err := store.Create(context.Background(), &models.URL{URL: "https://example.com/", ShortCode: "abc"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestResolverCachesHitsAndMisses(t *testing.T) {
+	ctx := context.Background()
+	store := newCountingStore(t)
+	r := NewResolver(store, nil, 10, time.Minute, time.Minute)
+
+	for i := 0; i < 3; i++ {
+		if u, err := r.Resolve(ctx, "abc"); err != nil || u.URL != "https://example.com/" {
+			t.Fatalf("Resolve = %v, %v", u, err)
+		}
+		if _, err := r.Resolve(ctx, "missing"); !errors.Is(err, database.ErrNotFound) {
+			t.Fatalf("Resolve of unknown code: err = %v", err)
+		}
+	}
+	if n := store.lookups.Load(); n != 2 {
+		t.Errorf("%d store lookups, want one per code", n)
+	}
+	stats := r.Stats()
+	if stats.Hits != 2 || stats.NegativeHits != 2 || stats.Misses != 2 {
+		t.Errorf("stats = %+v, want 2 hits, 2 negative hits, 2 misses", stats)
+	}
+	want := `
+# HELP urlshortener_cache_lookups_total Redirect cache lookups by result
+# TYPE urlshortener_cache_lookups_total counter
+urlshortener_cache_lookups_total{result="hit"} 2
+urlshortener_cache_lookups_total{result="miss"} 2
+urlshortener_cache_lookups_total{result="negative_hit"} 2
+`
+	if err := testutil.CollectAndCompare(r, strings.NewReader(want), "urlshortener_cache_lookups_total"); err != nil {
+		t.Error(err)
+	}
+
+	if _, err := store.UpdateLink(ctx, "abc", "https://new.example/", ""); err != nil {
+		t.Fatal(err)
+	}
+	r.Invalidate("abc")
+	if u, _ := r.Resolve(ctx, "abc"); u.URL != "https://new.example/" {
+		t.Errorf("Resolve after Invalidate = %q, want the new destination", u.URL)
+	}
+}
+
+func TestResolverWithoutCacheAlwaysQueries(t *testing.T) {
+	store := newCountingStore(t)
+	r := NewResolver(store, nil, 0, time.Minute, time.Minute)
+	for i := 0; i < 3; i++ {
+		r.Resolve(context.Background(), "abc")
+	}
+	if n := store.lookups.Load(); n != 3 {
+		t.Errorf("%d store lookups with the cache disabled, want 3", n)
+	}
+}
+
+func TestResolverCoalescesConcurrentMisses(t *testing.T) {
+	store := newCountingStore(t)
+	store.release = make(chan struct{})
+	r := NewResolver(store, nil, 10, time.Minute, time.Minute)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := r.Resolve(context.Background(), "abc"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	// Let the waiting callers pile up behind the first lookup
+	for r.Stats().Misses < 10 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(store.release)
+	wg.Wait()
+
+	if n := store.lookups.Load(); n != 1 {
+		t.Errorf("%d store lookups for 10 concurrent misses, want 1", n)
+	}
+	if got := r.Stats().Coalesced; got != 10 {
+		t.Errorf("coalesced = %d, want 10", got)
+	}
+}
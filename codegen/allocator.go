@@ -0,0 +1,95 @@
+package codegen
+
+import (
+	"context"
+	"sync/atomic"
+
+	"urlshortner/database"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Allocator hands codes from a CodeGenerator to the store, which inserts
+// them and asks again on collision, and keeps count of how often that happens
+type Allocator struct {
+	gen         CodeGenerator
+	maxAttempts int
+
+	generated atomic.Int64
+	collided  atomic.Int64
+	exhausted atomic.Int64
+}
+
+// NewAllocator creates an Allocator that gives up once maxAttempts codes for
+// the same link were taken
+func NewAllocator(gen CodeGenerator, maxAttempts int) *Allocator {
+	if maxAttempts <= 0 {
+		maxAttempts = 1
+	}
+	return &Allocator{gen: gen, maxAttempts: maxAttempts}
+}
+
+// Next implements database.CodeAllocator
+func (a *Allocator) Next(ctx context.Context, collisions int) (string, error) {
+	if collisions > 0 {
+		a.collided.Add(1)
+	}
+	if collisions >= a.maxAttempts {
+		a.exhausted.Add(1)
+		return "", database.ErrCodesExhausted
+	}
+	code, err := a.gen.Generate(ctx)
+	if err != nil {
+		return "", err
+	}
+	a.generated.Add(1)
+	return code, nil
+}
+
+// AllocatorStats is a snapshot of the Allocator counters
+type AllocatorStats struct {
+	Generated     int64   `json:"generated"`
+	Collisions    int64   `json:"collisions"`
+	Exhausted     int64   `json:"exhausted"`
+	CollisionRate float64 `json:"collision_rate"`
+}
+
+// Stats returns the current counters. CollisionRate is the share of
+// generated codes that were already taken.
+func (a *Allocator) Stats() AllocatorStats {
+	stats := AllocatorStats{
+		Generated:  a.generated.Load(),
+		Collisions: a.collided.Load(),
+		Exhausted:  a.exhausted.Load(),
+	}
+	if stats.Generated > 0 {
+		stats.CollisionRate = float64(stats.Collisions) / float64(stats.Generated)
+	}
+	return stats
+}
+
+// Report implements monitoring.Reporter
+func (a *Allocator) Report() (string, interface{}) {
+	return "short_codes", a.Stats()
+}
+
+var (
+	generatedDesc  = prometheus.NewDesc("urlshortener_codes_generated_total", "Short codes generated for new links", nil, nil)
+	collisionsDesc = prometheus.NewDesc("urlshortener_code_collisions_total", "Generated short codes that were already taken", nil, nil)
+	exhaustedDesc  = prometheus.NewDesc("urlshortener_code_exhausted_total", "Links that found no free short code within the retry budget", nil, nil)
+)
+
+// Describe implements prometheus.Collector
+func (a *Allocator) Describe(ch chan<- *prometheus.Desc) {
+	ch <- generatedDesc
+	ch <- collisionsDesc
+	ch <- exhaustedDesc
+}
+
+// Collect implements prometheus.Collector
+func (a *Allocator) Collect(ch chan<- prometheus.Metric) {
+	stats := a.Stats()
+	ch <- prometheus.MustNewConstMetric(generatedDesc, prometheus.CounterValue, float64(stats.Generated))
+	ch <- prometheus.MustNewConstMetric(collisionsDesc, prometheus.CounterValue, float64(stats.Collisions))
+	ch <- prometheus.MustNewConstMetric(exhaustedDesc, prometheus.CounterValue, float64(stats.Exhausted))
+}
@@ -0,0 +1,114 @@
+package codegen
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"urlshortner/database"
+	"urlshortner/models"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// repeating always generates the same code
+type repeating string
+
+func (g repeating) Generate(ctx context.Context) (string, error) {
+	return string(g), nil
+}
+
+func TestAllocatorGivesUpAfterMaxAttempts(t *testing.T) {
+	ctx := context.Background()
+	store := database.NewMemoryStore()
+	a := NewAllocator(repeating("same01"), 3)
+
+	if err := store.Create(ctx, &models.URL{URL: "https://a.example/"}, a); err != nil {
+		t.Fatal(err)
+	}
+	err := store.Create(ctx, &models.URL{URL: "https://b.example/"}, a)
+	if !errors.Is(err, database.ErrCodesExhausted) {
+		t.Fatalf("Create with every code taken: err = %v, want ErrCodesExhausted", err)
+	}
+
+	stats := a.Stats()
+	if stats.Generated != 4 || stats.Collisions != 3 || stats.Exhausted != 1 {
+		t.Errorf("stats = %+v, want 4 generated, 3 collisions, 1 exhausted", stats)
+	}
+	if stats.CollisionRate != 0.75 {
+		t.Errorf("collision rate = %v, want 0.75", stats.CollisionRate)
+	}
+
+	want := `
+# HELP urlshortener_code_exhausted_total Links that found no free short code within the retry budget
+# TYPE urlshortener_code_exhausted_total counter
+urlshortener_code_exhausted_total 1
+`
+	if err := testutil.CollectAndCompare(a, strings.NewReader(want), "urlshortener_code_exhausted_total"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestBlockSequenceNeverOverlaps(t *testing.T) {
+	ctx := context.Background()
+	store := database.NewMemoryStore()
+	// Two instances sharing one database each reserve their own blocks
+	instances := []*BlockSequence{
+		NewBlockSequence(store, "short_code", 10),
+		NewBlockSequence(store, "short_code", 10),
+	}
+
+	var mu sync.Mutex
+	seen := make(map[int64]bool)
+	var wg sync.WaitGroup
+	for _, seq := range instances {
+		for w := 0; w < 4; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < 50; i++ {
+					n, err := seq.Next(ctx)
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					mu.Lock()
+					if seen[n] {
+						t.Errorf("number %d handed out twice", n)
+					}
+					seen[n] = true
+					mu.Unlock()
+				}
+			}()
+		}
+	}
+	wg.Wait()
+
+	if len(seen) != 400 {
+		t.Errorf("%d distinct numbers, want 400", len(seen))
+	}
+	// Blocks are handed out whole, so nothing was reserved beyond them
+	if next, _ := store.ReserveSequence(ctx, "short_code", 1); next != 401 {
+		t.Errorf("next free number = %d, want 401", next)
+	}
+}
+
+func TestSequenceCodesDoNotCollide(t *testing.T) {
+	ctx := context.Background()
+	store := database.NewMemoryStore()
+	gen, err := New(StrategyHashids, "", 6, "salt", NewBlockSequence(store, "short_code", 100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := NewAllocator(gen, 1)
+	for i := 0; i < 500; i++ {
+		if err := store.Create(ctx, &models.URL{URL: "https://example.com/"}, a); err != nil {
+			t.Fatalf("link %d: %v", i, err)
+		}
+	}
+	if stats := a.Stats(); stats.Collisions != 0 {
+		t.Errorf("%d collisions, want none from a sequence", stats.Collisions)
+	}
+}
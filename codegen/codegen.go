@@ -0,0 +1,208 @@
+package codegen
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"strings"
+)
+
+// Generator strategies selectable with New
+const (
+	StrategyRandom   = "random"
+	StrategySequence = "sequence"
+	StrategyHashids  = "hashids"
+)
+
+// DefaultAlphabet is base62 in digit, lower, upper order
+const DefaultAlphabet = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+// Limits on generator settings. Codes must stay valid custom codes, which are
+// 3 to 20 alphanumeric characters.
+const (
+	minAlphabet = 16
+	minLength   = 3
+	maxLength   = 20
+)
+
+// CodeGenerator produces short codes for links created without one. Codes
+// are not checked against the store; callers retry on collision.
+type CodeGenerator interface {
+	Generate(ctx context.Context) (string, error)
+}
+
+// New returns the generator for strategy. length is exact for random codes
+// and the minimum for sequence and hashids codes, which draw their numbers
+// from seq and grow as it does. salt shuffles the hashids alphabet. An
+// empty alphabet selects DefaultAlphabet.
+func New(strategy, alphabet string, length int, salt string, seq Sequence) (CodeGenerator, error) {
+	if alphabet == "" {
+		alphabet = DefaultAlphabet
+	}
+	if err := validate(alphabet, length); err != nil {
+		return nil, err
+	}
+	switch strategy {
+	case StrategyRandom:
+		return NewRandom(alphabet, length), nil
+	case StrategySequence:
+		return NewSequential(seq, alphabet, length), nil
+	case StrategyHashids:
+		return NewHashids(seq, alphabet, length, salt), nil
+	}
+	return nil, fmt.Errorf("unknown code generator %q, want random, sequence or hashids", strategy)
+}
+
+func validate(alphabet string, length int) error {
+	if len(alphabet) < minAlphabet {
+		return fmt.Errorf("code alphabet needs at least %d characters", minAlphabet)
+	}
+	for i := 0; i < len(alphabet); i++ {
+		c := alphabet[i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+			return fmt.Errorf("code alphabet may only contain letters and digits, got %q", c)
+		}
+		if strings.IndexByte(alphabet[i+1:], c) >= 0 {
+			return fmt.Errorf("code alphabet repeats %q", c)
+		}
+	}
+	if length < minLength || length > maxLength {
+		return fmt.Errorf("code length must be between %d and %d", minLength, maxLength)
+	}
+	return nil
+}
+
+// Random draws every character independently from crypto/rand
+type Random struct {
+	alphabet string
+	length   int
+	// limit is the largest multiple of len(alphabet) a byte can reach, bytes
+	// at or above it are redrawn so every character is equally likely
+	limit int
+}
+
+// NewRandom creates a Random generator of codes with length characters
+func NewRandom(alphabet string, length int) *Random {
+	return &Random{alphabet: alphabet, length: length, limit: 256 - 256%len(alphabet)}
+}
+
+func (g *Random) Generate(ctx context.Context) (string, error) {
+	code := make([]byte, 0, g.length)
+	buf := make([]byte, g.length*2)
+	for len(code) < g.length {
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+		for _, b := range buf {
+			if int(b) >= g.limit {
+				continue
+			}
+			code = append(code, g.alphabet[int(b)%len(g.alphabet)])
+			if len(code) == g.length {
+				break
+			}
+		}
+	}
+	return string(code), nil
+}
+
+// Sequential encodes consecutive numbers in the alphabet, left padded with
+// its first character to the minimum length. Codes are short and dense but
+// reveal how many links exist and are easy to enumerate.
+type Sequential struct {
+	seq       Sequence
+	alphabet  string
+	minLength int
+}
+
+// NewSequential creates a Sequential generator over seq
+func NewSequential(seq Sequence, alphabet string, minLength int) *Sequential {
+	return &Sequential{seq: seq, alphabet: alphabet, minLength: minLength}
+}
+
+func (g *Sequential) Generate(ctx context.Context) (string, error) {
+	n, err := g.seq.Next(ctx)
+	if err != nil {
+		return "", err
+	}
+	return encode(uint64(n), g.alphabet, g.minLength), nil
+}
+
+// encode writes n in base len(alphabet), padded to minLength
+func encode(n uint64, alphabet string, minLength int) string {
+	base := uint64(len(alphabet))
+	var buf [64]byte
+	i := len(buf)
+	for n > 0 || len(buf)-i < minLength {
+		i--
+		buf[i] = alphabet[n%base]
+		n /= base
+	}
+	return string(buf[i:])
+}
+
+// Hashids encodes sequence numbers in the style of hashids: a salted
+// alphabet shuffle, reshuffled per number by a leading "lottery" character,
+// keeps codes unique while hiding their order
+type Hashids struct {
+	seq       Sequence
+	alphabet  string
+	minLength int
+	salt      string
+}
+
+// NewHashids creates a Hashids generator over seq. Different salts give
+// unrelated codes for the same numbers.
+func NewHashids(seq Sequence, alphabet string, minLength int, salt string) *Hashids {
+	return &Hashids{
+		seq:       seq,
+		alphabet:  shuffle(alphabet, salt),
+		minLength: minLength,
+		salt:      salt,
+	}
+}
+
+func (g *Hashids) Generate(ctx context.Context) (string, error) {
+	n, err := g.seq.Next(ctx)
+	if err != nil {
+		return "", err
+	}
+	return g.encode(uint64(n)), nil
+}
+
+// encode is reversible: the lottery character selects the shuffle of the
+// remaining characters, which hold the digits of n, least significant first,
+// each added to the one before so padding does not show
+func (g *Hashids) encode(n uint64) string {
+	base := uint64(len(g.alphabet))
+	lottery := n % base
+	alphabet := shuffle(g.alphabet, string(g.alphabet[lottery])+g.salt)
+
+	code := make([]byte, 1, g.minLength)
+	code[0] = g.alphabet[lottery]
+	prev := lottery
+	for i := uint64(0); n > 0 || len(code) < g.minLength; i++ {
+		prev = (n%base + prev + i) % base
+		code = append(code, alphabet[prev])
+		n /= base
+	}
+	return string(code)
+}
+
+// shuffle permutes alphabet deterministically by salt, as hashids'
+// consistent shuffle does
+func shuffle(alphabet, salt string) string {
+	if salt == "" {
+		return alphabet
+	}
+	out := []byte(alphabet)
+	for i, v, p := len(out)-1, 0, 0; i > 0; i-- {
+		v %= len(salt)
+		c := int(salt[v])
+		p += c
+		j := (c + v + p) % i
+		out[i], out[j] = out[j], out[i]
+		v++
+	}
+	return string(out)
+}
@@ -0,0 +1,110 @@
+package codegen
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"urlshortner/utils"
+)
+
+// counter is a Sequence counting up from 1
+type counter struct{ n int64 }
+
+func (c *counter) Next(ctx context.Context) (int64, error) {
+	c.n++
+	return c.n, nil
+}
+
+func TestNewValidatesSettings(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy string
+		alphabet string
+		length   int
+	}{
+		{"unknown strategy", "uuid", "", 6},
+		{"short alphabet", StrategyRandom, "abcdef", 6},
+		{"repeated character", StrategyRandom, "0123456789abcdefa", 6},
+		{"punctuation", StrategyRandom, "0123456789abcdef-", 6},
+		{"too short", StrategyRandom, "", 2},
+		{"too long", StrategyRandom, "", 21},
+	}
+	for _, tt := range tests {
+		if _, err := New(tt.strategy, tt.alphabet, tt.length, "", nil); err == nil {
+			t.Errorf("%s: New accepted the settings", tt.name)
+		}
+	}
+	for _, strategy := range []string{StrategyRandom, StrategySequence, StrategyHashids} {
+		if _, err := New(strategy, "", 6, "salt", &counter{}); err != nil {
+			t.Errorf("New(%s) with defaults: %v", strategy, err)
+		}
+	}
+}
+
+func TestRandomCodes(t *testing.T) {
+	const alphabet = "0123456789abcdef"
+	g := NewRandom(alphabet, 8)
+	seen := make(map[string]bool)
+	for i := 0; i < 1000; i++ {
+		code, err := g.Generate(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(code) != 8 || strings.Trim(code, alphabet) != "" {
+			t.Fatalf("code %q is not 8 characters of %s", code, alphabet)
+		}
+		seen[code] = true
+	}
+	// 16^8 possible codes make a repeat within 1000 draws vanishingly unlikely
+	if len(seen) != 1000 {
+		t.Errorf("%d distinct codes in 1000 draws", len(seen))
+	}
+}
+
+func TestSequentialCodes(t *testing.T) {
+	g := NewSequential(&counter{}, DefaultAlphabet, 3)
+	want := []string{"001", "002", "003"}
+	for _, w := range want {
+		if code, _ := g.Generate(context.Background()); code != w {
+			t.Errorf("code %q, want %q", code, w)
+		}
+	}
+	if got := encode(62*62*62, DefaultAlphabet, 3); got != "1000" {
+		t.Errorf("encode past the minimum length = %q, want 1000", got)
+	}
+}
+
+func TestHashidsCodes(t *testing.T) {
+	ctx := context.Background()
+	a := NewHashids(&counter{}, DefaultAlphabet, 6, "one")
+	b := NewHashids(&counter{}, DefaultAlphabet, 6, "two")
+
+	seen := make(map[string]bool)
+	same := 0
+	for i := 0; i < 10000; i++ {
+		code, err := a.Generate(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(code) < 6 || !utils.IsValidShortCode(code) {
+			t.Fatalf("code %q is not a valid short code of at least 6 characters", code)
+		}
+		if seen[code] {
+			t.Fatalf("number %d repeated code %q", i+1, code)
+		}
+		seen[code] = true
+		if other, _ := b.Generate(ctx); other == code {
+			same++
+		}
+	}
+	if same > 0 {
+		t.Errorf("%d numbers got the same code under different salts", same)
+	}
+
+	// Consecutive numbers must not give codes that look consecutive
+	first, second := a.encode(1), a.encode(2)
+	if first[1:] == second[1:] {
+		t.Errorf("codes %q and %q only differ in the first character", first, second)
+	}
+}
@@ -0,0 +1,54 @@
+package codegen
+
+import (
+	"context"
+	"sync"
+)
+
+// Sequence hands out increasing numbers for sequence based generators
+type Sequence interface {
+	Next(ctx context.Context) (int64, error)
+}
+
+// Reserver reserves n consecutive numbers of the named sequence and returns
+// the first, typically backed by the database so instances never overlap
+type Reserver interface {
+	ReserveSequence(ctx context.Context, name string, n int) (int64, error)
+}
+
+// BlockSequence hands out numbers from blocks reserved through a Reserver,
+// so most calls do not touch the database. Numbers left in a block when the
+// process exits are never used.
+type BlockSequence struct {
+	reserver Reserver
+	name     string
+	block    int
+
+	mu   sync.Mutex
+	next int64
+	end  int64
+}
+
+// NewBlockSequence creates a BlockSequence reserving block numbers at a time
+func NewBlockSequence(reserver Reserver, name string, block int) *BlockSequence {
+	if block <= 0 {
+		block = 1
+	}
+	return &BlockSequence{reserver: reserver, name: name, block: block}
+}
+
+func (s *BlockSequence) Next(ctx context.Context) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.next == s.end {
+		first, err := s.reserver.ReserveSequence(ctx, s.name, s.block)
+		if err != nil {
+			return 0, err
+		}
+		s.next, s.end = first, first+int64(s.block)
+	}
+	n := s.next
+	s.next++
+	return n, nil
+}
@@ -1,8 +1,10 @@
 package config
 
 import (
+	"fmt"
 	"os"
-	// "strconv"
+	"strconv"
+	"time"
 )
 
 type Config struct {
@@ -11,6 +13,105 @@ type Config struct {
 	BaseURL     string
 	LogLevel    string
 	Environment string
+
+	// Log format (json or text) and output (stdout, stderr or a file path),
+	// whether query values and credentials of logged URLs are hidden, and
+	// how many successful redirects are logged per second (0 for all)
+	LogFormat             string
+	LogOutput             string
+	LogRedactURLs         bool
+	LogRedirectsPerSecond int
+
+	// HTTP server timeouts, and how long shutdown waits with failing health
+	// checks before it stops accepting and how long it then waits for
+	// in-flight requests and background work
+	HTTPReadTimeout       time.Duration
+	HTTPReadHeaderTimeout time.Duration
+	HTTPWriteTimeout      time.Duration
+	HTTPIdleTimeout       time.Duration
+	ShutdownDrainDelay    time.Duration
+	ShutdownTimeout       time.Duration
+
+	// Expired link sweeper, archive moves expired links to expired_urls and
+	// purge deletes them
+	ExpirySweepInterval time.Duration
+	ExpirySweepBatch    int
+	ExpiryMode          string
+
+	// Batched access count writer
+	AccessFlushInterval time.Duration
+	AccessFlushSize     int
+
+	// Redirect lookup cache, a size of 0 disables it
+	CacheSize        int
+	CacheTTL         time.Duration
+	CacheNegativeTTL time.Duration
+
+	// Per-client rate limits, redirects and reads vs. writes
+	RateLimitReadRPS    int
+	RateLimitReadBurst  int
+	RateLimitWriteRPS   int
+	RateLimitWriteBurst int
+	// Proxies whose X-Forwarded-For is trusted, comma separated IPs/CIDRs
+	TrustedProxies string
+
+	// Short code generation: random, sequence or hashids, the characters
+	// codes are made of (empty for base62), their length (exact for random, minimum otherwise),
+	// the hashids salt, how many sequence numbers an instance reserves at a
+	// time and how many taken codes a new link may hit before giving up
+	CodeGenerator     string
+	CodeAlphabet      string
+	CodeLength        int
+	CodeSalt          string
+	CodeSequenceBlock int
+	CodeMaxAttempts   int
+
+	// Most items accepted by POST /shorten/batch
+	BatchMaxSize int
+	// Query parameters dropped from destinations, comma separated names where
+	// a trailing * matches any suffix, and whether to sort the rest
+	URLStripParams string
+	URLSortQuery   bool
+	// Answer requests for an already shortened destination with its existing
+	// generated code unless the request sets reuse_existing
+	ReuseExisting bool
+
+	// Destination policy: optional file of allow/deny host patterns, whether
+	// private and loopback addresses are accepted, and further host names
+	// besides BASE_URL's that serve short links, comma separated
+	PolicyFile         string
+	PolicyAllowPrivate bool
+	PolicySelfHosts    string
+
+	// Threat feed: comma separated list files, how often they are checked for
+	// changes, how often existing links are re-scanned and whether listed
+	// links are flagged or disabled
+	ThreatFeedFiles      string
+	ThreatReloadInterval time.Duration
+	ThreatScanInterval   time.Duration
+	ThreatAction         string
+
+	// Let callers without an API key shorten URLs
+	AllowAnonymousCreate bool
+	// Owner of anonymously created links and of links that predate ownership;
+	// empty leaves them manageable by admins only
+	DefaultOwner string
+
+	// Optional Redis for a shared cache and cluster-wide rate limiting
+	RedisURL string
+	// Whether /readyz fails while Redis is unreachable instead of reporting
+	// degraded, and how long each readiness check may take
+	ReadyRequireRedis bool
+	ReadyCheckTimeout time.Duration
+
+	// OpenTelemetry tracing: exporter (none or otlp), OTLP/HTTP collector
+	// endpoint, whether it is plain HTTP, share of new traces sampled and
+	// the service name spans are reported under
+	TracingExporter    string
+	TracingEndpoint    string
+	TracingInsecure    bool
+	TracingSampleRatio float64
+	TracingServiceName string
 }
 
 func Load() *Config {
@@ -20,7 +121,105 @@ func Load() *Config {
 		BaseURL:     getEnv("BASE_URL", "http://localhost:8080"),
 		LogLevel:    getEnv("LOG_LEVEL", "info"),
 		Environment: getEnv("ENVIRONMENT", "development"),
+
+		LogFormat:             getEnv("LOG_FORMAT", "json"),
+		LogOutput:             getEnv("LOG_OUTPUT", "stderr"),
+		LogRedactURLs:         getEnv("LOG_REDACT_URLS", "true") == "true",
+		LogRedirectsPerSecond: getEnvInt("LOG_REDIRECT_SAMPLE_PER_SECOND", 0),
+
+		HTTPReadTimeout:       getEnvDuration("HTTP_READ_TIMEOUT", 30*time.Second),
+		HTTPReadHeaderTimeout: getEnvDuration("HTTP_READ_HEADER_TIMEOUT", 5*time.Second),
+		HTTPWriteTimeout:      getEnvDuration("HTTP_WRITE_TIMEOUT", 30*time.Second),
+		HTTPIdleTimeout:       getEnvDuration("HTTP_IDLE_TIMEOUT", 2*time.Minute),
+		ShutdownDrainDelay:    getEnvDuration("SHUTDOWN_DRAIN_DELAY", 5*time.Second),
+		ShutdownTimeout:       getEnvDuration("SHUTDOWN_TIMEOUT", 30*time.Second),
+
+		ExpirySweepInterval: getEnvDuration("EXPIRY_SWEEP_INTERVAL", time.Minute),
+		ExpirySweepBatch:    getEnvInt("EXPIRY_SWEEP_BATCH", 500),
+		ExpiryMode:          getEnv("EXPIRY_MODE", "archive"),
+
+		AccessFlushInterval: getEnvDuration("ACCESS_FLUSH_INTERVAL", time.Second),
+		AccessFlushSize:     getEnvInt("ACCESS_FLUSH_SIZE", 1000),
+
+		CacheSize:        getEnvInt("CACHE_SIZE", 10000),
+		CacheTTL:         getEnvDuration("CACHE_TTL", time.Minute),
+		CacheNegativeTTL: getEnvDuration("CACHE_NEGATIVE_TTL", 10*time.Second),
+
+		RateLimitReadRPS:    getEnvInt("RATE_LIMIT_READ_RPS", 100),
+		RateLimitReadBurst:  getEnvInt("RATE_LIMIT_READ_BURST", 200),
+		RateLimitWriteRPS:   getEnvInt("RATE_LIMIT_WRITE_RPS", 5),
+		RateLimitWriteBurst: getEnvInt("RATE_LIMIT_WRITE_BURST", 20),
+		TrustedProxies:      getEnv("TRUSTED_PROXIES", ""),
+
+		CodeGenerator:     getEnv("CODE_GENERATOR", "random"),
+		CodeAlphabet:      getEnv("CODE_ALPHABET", ""),
+		CodeLength:        getEnvInt("CODE_LENGTH", 6),
+		CodeSalt:          getEnv("CODE_SALT", ""),
+		CodeSequenceBlock: getEnvInt("CODE_SEQUENCE_BLOCK", 100),
+		CodeMaxAttempts:   getEnvInt("CODE_MAX_ATTEMPTS", 5),
+
+		BatchMaxSize:  getEnvInt("BATCH_MAX_SIZE", 5000),
+		ReuseExisting: getEnv("REUSE_EXISTING", "false") == "true",
+
+		URLStripParams: getEnv("URL_STRIP_PARAMS", "utm_*,fbclid,gclid"),
+		URLSortQuery:   getEnv("URL_SORT_QUERY", "false") == "true",
+
+		PolicyFile:         getEnv("POLICY_FILE", ""),
+		PolicyAllowPrivate: getEnv("POLICY_ALLOW_PRIVATE", "false") == "true",
+		PolicySelfHosts:    getEnv("POLICY_SELF_HOSTS", ""),
+
+		ThreatFeedFiles:      getEnv("THREAT_FEED_FILES", ""),
+		ThreatReloadInterval: getEnvDuration("THREAT_RELOAD_INTERVAL", time.Minute),
+		ThreatScanInterval:   getEnvDuration("THREAT_SCAN_INTERVAL", time.Hour),
+		ThreatAction:         getEnv("THREAT_ACTION", "disable"),
+
+		AllowAnonymousCreate: getEnv("ALLOW_ANONYMOUS_CREATE", "false") == "true",
+		DefaultOwner:         getEnv("DEFAULT_OWNER", ""),
+
+		RedisURL:          getEnv("REDIS_URL", ""),
+		ReadyRequireRedis: getEnv("READY_REQUIRE_REDIS", "false") == "true",
+		ReadyCheckTimeout: getEnvDuration("READY_CHECK_TIMEOUT", 2*time.Second),
+
+		TracingExporter:    getEnv("TRACING_EXPORTER", "none"),
+		TracingEndpoint:    getEnv("TRACING_OTLP_ENDPOINT", "localhost:4318"),
+		TracingInsecure:    getEnv("TRACING_OTLP_INSECURE", "false") == "true",
+		TracingSampleRatio: getEnvFloat("TRACING_SAMPLE_RATIO", 1),
+		TracingServiceName: getEnv("TRACING_SERVICE_NAME", "urlshortener"),
+	}
+}
+
+// Validate rejects settings the server cannot run with
+func (c *Config) Validate() error {
+	limits := []struct {
+		name  string
+		value int
+	}{
+		{"RATE_LIMIT_READ_RPS", c.RateLimitReadRPS},
+		{"RATE_LIMIT_READ_BURST", c.RateLimitReadBurst},
+		{"RATE_LIMIT_WRITE_RPS", c.RateLimitWriteRPS},
+		{"RATE_LIMIT_WRITE_BURST", c.RateLimitWriteBurst},
 	}
+	for _, l := range limits {
+		if l.value < 1 {
+			return fmt.Errorf("%s must be at least 1, got %d", l.name, l.value)
+		}
+	}
+
+	intervals := []struct {
+		name  string
+		value time.Duration
+	}{
+		{"EXPIRY_SWEEP_INTERVAL", c.ExpirySweepInterval},
+		{"ACCESS_FLUSH_INTERVAL", c.AccessFlushInterval},
+		{"THREAT_RELOAD_INTERVAL", c.ThreatReloadInterval},
+		{"THREAT_SCAN_INTERVAL", c.ThreatScanInterval},
+	}
+	for _, i := range intervals {
+		if i.value <= 0 {
+			return fmt.Errorf("%s must be positive, got %s", i.name, i.value)
+		}
+	}
+	return nil
 }
 
 func getEnv(key, defaultValue string) string {
@@ -30,11 +229,29 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
-// func getEnvInt(key string, defaultValue int) int {
-// 	if value := os.Getenv(key); value != "" {
-// 		if intValue, err := strconv.Atoi(value); err == nil {
-// 			return intValue
-// 		}
-// 	}
-// 	return defaultValue
-// }
+func getEnvInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if intValue, err := strconv.Atoi(value); err == nil {
+			return intValue
+		}
+	}
+	return defaultValue
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if d, err := time.ParseDuration(value); err == nil {
+			return d
+		}
+	}
+	return defaultValue
+}
+
+func getEnvFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return f
+		}
+	}
+	return defaultValue
+}
@@ -0,0 +1,31 @@
+package config
+
+import "testing"
+
+func TestValidateRateLimits(t *testing.T) {
+	if err := Load().Validate(); err != nil {
+		t.Fatalf("defaults rejected: %v", err)
+	}
+
+	for _, key := range []string{"RATE_LIMIT_READ_RPS", "RATE_LIMIT_READ_BURST", "RATE_LIMIT_WRITE_RPS", "RATE_LIMIT_WRITE_BURST"} {
+		t.Run(key, func(t *testing.T) {
+			t.Setenv(key, "0")
+			if err := Load().Validate(); err == nil {
+				t.Errorf("%s=0 accepted", key)
+			}
+		})
+	}
+}
+
+func TestValidateIntervals(t *testing.T) {
+	for _, key := range []string{"EXPIRY_SWEEP_INTERVAL", "ACCESS_FLUSH_INTERVAL", "THREAT_RELOAD_INTERVAL", "THREAT_SCAN_INTERVAL"} {
+		for _, value := range []string{"0s", "-1s"} {
+			t.Run(key+"="+value, func(t *testing.T) {
+				t.Setenv(key, value)
+				if err := Load().Validate(); err == nil {
+					t.Errorf("%s=%s accepted", key, value)
+				}
+			})
+		}
+	}
+}
@@ -3,99 +3,82 @@ package database
 import (
 	"context"
 	"database/sql"
-	"log"
 	"time"
 
+	"urlshortner/logging"
+
 	_ "github.com/lib/pq"
 	_ "github.com/mattn/go-sqlite3"
-	"github.com/sirupsen/logrus"
 )
 
 var DB *sql.DB
-var logger = logrus.New()
 
-func init() {
-	logger.SetFormatter(&logrus.JSONFormatter{})
-	logger.SetLevel(logrus.InfoLevel)
+// Migrations is the Migrator InitDB applied to DB, nil for the in-memory store
+var Migrations *Migrator
+
+var logger = logging.Component("database")
+
+// InitDB initializes database connection with PostgreSQL for production or SQLite for development,
+// applies pending migrations and returns the matching Store. A DATABASE_URL of "memory://" selects
+// the in-memory Store.
+func InitDB(databaseURL string) Store {
+	if databaseURL == "memory://" {
+		logger.Info("Using in-memory store, data will not be persisted")
+		return NewMemoryStore()
+	}
+
+	dialect := OpenDB(databaseURL)
+
+	migrator, err := NewMigrator(DB, dialect)
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to load migrations")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if _, err := migrator.Up(ctx); err != nil {
+		logger.WithError(err).Fatal("Failed to apply migrations")
+	}
+	Migrations = migrator
+
+	if dialect == DialectSQLite {
+		return NewSQLiteStore(DB)
+	}
+	return NewPostgresStore(DB)
 }
 
-// InitDB initializes database connection with PostgreSQL for production or SQLite for development
-func InitDB(databaseURL string) {
+// OpenDB connects DB without touching the schema and returns the SQL dialect in use
+func OpenDB(databaseURL string) string {
 	var err error
+	var dialect string
 
 	if databaseURL == "" {
 		// Development mode - use SQLite
 		logger.Info("Initializing SQLite database for development")
+		dialect = DialectSQLite
 		DB, err = sql.Open("sqlite3", "./urlshortener.db")
 		if err != nil {
-			log.Fatalf("Failed to open SQLite database: %v", err)
+			logger.WithError(err).Fatal("Failed to open SQLite database")
 		}
-		createSQLiteTables()
 	} else {
 		// Production mode - use PostgreSQL
 		logger.Info("Initializing PostgreSQL database for production")
+		dialect = DialectPostgres
 		DB, err = sql.Open("postgres", databaseURL)
 		if err != nil {
-			log.Fatalf("Failed to open PostgreSQL database: %v", err)
+			logger.WithError(err).Fatal("Failed to open PostgreSQL database")
 		}
 
 		// Configure connection pool
 		DB.SetMaxOpenConns(25)
 		DB.SetMaxIdleConns(25)
 		DB.SetConnMaxLifetime(5 * time.Minute)
-
-		createPostgresTables()
 	}
 
 	// Test connection
 	if err = DB.Ping(); err != nil {
-		log.Fatalf("Failed to ping database: %v", err)
+		logger.WithError(err).Fatal("Failed to ping database")
 	}
 
 	logger.Info("Database connection established successfully")
-}
-
-func createSQLiteTables() {
-	createTable := `
-	CREATE TABLE IF NOT EXISTS urls (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		url TEXT NOT NULL,
-		short_code TEXT UNIQUE NOT NULL,
-		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
-		updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
-		access_count INTEGER NOT NULL DEFAULT 0
-	);`
-
-	_, err := DB.Exec(createTable)
-	if err != nil {
-		log.Fatalf("Failed to create SQLite table: %v", err)
-	}
-}
-
-func createPostgresTables() {
-	createTable := `
-	CREATE TABLE IF NOT EXISTS urls (
-		id SERIAL PRIMARY KEY,
-		url TEXT NOT NULL,
-		short_code VARCHAR(50) UNIQUE NOT NULL,
-		created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
-		updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
-		access_count INTEGER NOT NULL DEFAULT 0
-	);
-	
-	CREATE INDEX IF NOT EXISTS idx_urls_short_code ON urls(short_code);
-	CREATE INDEX IF NOT EXISTS idx_urls_created_at ON urls(created_at);`
-
-	_, err := DB.Exec(createTable)
-	if err != nil {
-		log.Fatalf("Failed to create PostgreSQL tables: %v", err)
-	}
-}
-
-// HealthCheck verifies database connectivity
-func HealthCheck() error {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	return DB.PingContext(ctx)
+	return dialect
 }
@@ -0,0 +1,196 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"urlshortner/models"
+)
+
+// Hook is called when a Store operation starts, named after the Store
+// method. It returns the context to run the operation with and a function
+// that is called with the operation's error once it returns.
+type Hook func(ctx context.Context, op string) (context.Context, func(err error))
+
+// Instrument wraps s so every call runs through hooks, in order, for timing
+// and tracing without touching the store implementations
+func Instrument(s Store, hooks ...Hook) Store {
+	if len(hooks) == 0 {
+		return s
+	}
+	return &instrumentedStore{next: s, hooks: hooks}
+}
+
+type instrumentedStore struct {
+	next  Store
+	hooks []Hook
+}
+
+// start runs the hooks for op and returns the context and a function ending
+// the operation, which calls the hooks' end functions in reverse order
+func (s *instrumentedStore) start(ctx context.Context, op string) (context.Context, func(error)) {
+	ends := make([]func(error), len(s.hooks))
+	for i, hook := range s.hooks {
+		ctx, ends[i] = hook(ctx, op)
+	}
+	return ctx, func(err error) {
+		for i := len(ends) - 1; i >= 0; i-- {
+			ends[i](err)
+		}
+	}
+}
+
+func (s *instrumentedStore) Create(ctx context.Context, u *models.URL, codes CodeAllocator) (err error) {
+	ctx, end := s.start(ctx, "Create")
+	defer func() { end(err) }()
+	return s.next.Create(ctx, u, codes)
+}
+
+func (s *instrumentedStore) CreateBatch(ctx context.Context, urls []*models.URL, codes CodeAllocator, atomic bool) (_ []error, err error) {
+	ctx, end := s.start(ctx, "CreateBatch")
+	defer func() { end(err) }()
+	return s.next.CreateBatch(ctx, urls, codes, atomic)
+}
+
+func (s *instrumentedStore) GetByCode(ctx context.Context, code string) (_ *models.URL, err error) {
+	ctx, end := s.start(ctx, "GetByCode")
+	defer func() { end(err) }()
+	return s.next.GetByCode(ctx, code)
+}
+
+func (s *instrumentedStore) FindReusable(ctx context.Context, owner, destHash string) (_ *models.URL, err error) {
+	ctx, end := s.start(ctx, "FindReusable")
+	defer func() { end(err) }()
+	return s.next.FindReusable(ctx, owner, destHash)
+}
+
+func (s *instrumentedStore) ListByOwner(ctx context.Context, owner string, afterID, limit int) (_ []models.URL, err error) {
+	ctx, end := s.start(ctx, "ListByOwner")
+	defer func() { end(err) }()
+	return s.next.ListByOwner(ctx, owner, afterID, limit)
+}
+
+func (s *instrumentedStore) List(ctx context.Context, f ListFilter) (_ []models.URL, err error) {
+	ctx, end := s.start(ctx, "List")
+	defer func() { end(err) }()
+	return s.next.List(ctx, f)
+}
+
+func (s *instrumentedStore) ForEachURL(ctx context.Context, fn func(*models.URL) error) (err error) {
+	ctx, end := s.start(ctx, "ForEachURL")
+	defer func() { end(err) }()
+	return s.next.ForEachURL(ctx, fn)
+}
+
+func (s *instrumentedStore) ImportBatch(ctx context.Context, urls []*models.URL, onConflict string) (_ []error, err error) {
+	ctx, end := s.start(ctx, "ImportBatch")
+	defer func() { end(err) }()
+	return s.next.ImportBatch(ctx, urls, onConflict)
+}
+
+func (s *instrumentedStore) AssignUnowned(ctx context.Context, owner string) (_ int, err error) {
+	ctx, end := s.start(ctx, "AssignUnowned")
+	defer func() { end(err) }()
+	return s.next.AssignUnowned(ctx, owner)
+}
+
+func (s *instrumentedStore) BackfillDestHashes(ctx context.Context, hash func(url string) string, limit int) (_ int, err error) {
+	ctx, end := s.start(ctx, "BackfillDestHashes")
+	defer func() { end(err) }()
+	return s.next.BackfillDestHashes(ctx, hash, limit)
+}
+
+func (s *instrumentedStore) UpdateLink(ctx context.Context, code, newURL, newCode string) (_ *models.URL, err error) {
+	ctx, end := s.start(ctx, "UpdateLink")
+	defer func() { end(err) }()
+	return s.next.UpdateLink(ctx, code, newURL, newCode)
+}
+
+func (s *instrumentedStore) SetThreatStatus(ctx context.Context, code, url, status, match string) (err error) {
+	ctx, end := s.start(ctx, "SetThreatStatus")
+	defer func() { end(err) }()
+	return s.next.SetThreatStatus(ctx, code, url, status, match)
+}
+
+func (s *instrumentedStore) Delete(ctx context.Context, code string) (err error) {
+	ctx, end := s.start(ctx, "Delete")
+	defer func() { end(err) }()
+	return s.next.Delete(ctx, code)
+}
+
+func (s *instrumentedStore) IncrementAccess(ctx context.Context, code string) (err error) {
+	ctx, end := s.start(ctx, "IncrementAccess")
+	defer func() { end(err) }()
+	return s.next.IncrementAccess(ctx, code)
+}
+
+func (s *instrumentedStore) IncrementAccessBatch(ctx context.Context, counts map[string]int) (err error) {
+	ctx, end := s.start(ctx, "IncrementAccessBatch")
+	defer func() { end(err) }()
+	return s.next.IncrementAccessBatch(ctx, counts)
+}
+
+func (s *instrumentedStore) RecordClicks(ctx context.Context, events []*models.ClickEvent) (err error) {
+	ctx, end := s.start(ctx, "RecordClicks")
+	defer func() { end(err) }()
+	return s.next.RecordClicks(ctx, events)
+}
+
+func (s *instrumentedStore) ClickStats(ctx context.Context, urlID int, since time.Time, bucket string, topN int) (_ *models.ClickStats, err error) {
+	ctx, end := s.start(ctx, "ClickStats")
+	defer func() { end(err) }()
+	return s.next.ClickStats(ctx, urlID, since, bucket, topN)
+}
+
+func (s *instrumentedStore) SweepExpired(ctx context.Context, before time.Time, limit int, archive bool) (_ int, err error) {
+	ctx, end := s.start(ctx, "SweepExpired")
+	defer func() { end(err) }()
+	return s.next.SweepExpired(ctx, before, limit, archive)
+}
+
+func (s *instrumentedStore) IsArchived(ctx context.Context, code string) (_ bool, err error) {
+	ctx, end := s.start(ctx, "IsArchived")
+	defer func() { end(err) }()
+	return s.next.IsArchived(ctx, code)
+}
+
+func (s *instrumentedStore) ReserveSequence(ctx context.Context, name string, n int) (_ int64, err error) {
+	ctx, end := s.start(ctx, "ReserveSequence")
+	defer func() { end(err) }()
+	return s.next.ReserveSequence(ctx, name, n)
+}
+
+func (s *instrumentedStore) CreateAPIKey(ctx context.Context, k *models.APIKey, hash string) (err error) {
+	ctx, end := s.start(ctx, "CreateAPIKey")
+	defer func() { end(err) }()
+	return s.next.CreateAPIKey(ctx, k, hash)
+}
+
+func (s *instrumentedStore) GetAPIKeyByHash(ctx context.Context, hash string) (_ *models.APIKey, err error) {
+	ctx, end := s.start(ctx, "GetAPIKeyByHash")
+	defer func() { end(err) }()
+	return s.next.GetAPIKeyByHash(ctx, hash)
+}
+
+func (s *instrumentedStore) ListAPIKeys(ctx context.Context) (_ []models.APIKey, err error) {
+	ctx, end := s.start(ctx, "ListAPIKeys")
+	defer func() { end(err) }()
+	return s.next.ListAPIKeys(ctx)
+}
+
+func (s *instrumentedStore) RevokeAPIKey(ctx context.Context, id int) (err error) {
+	ctx, end := s.start(ctx, "RevokeAPIKey")
+	defer func() { end(err) }()
+	return s.next.RevokeAPIKey(ctx, id)
+}
+
+// Stats only reads pool counters and is left out of the hooks
+func (s *instrumentedStore) Stats(ctx context.Context) Stats {
+	return s.next.Stats(ctx)
+}
+
+func (s *instrumentedStore) Ping(ctx context.Context) (err error) {
+	ctx, end := s.start(ctx, "Ping")
+	defer func() { end(err) }()
+	return s.next.Ping(ctx)
+}
@@ -0,0 +1,568 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"urlshortner/models"
+)
+
+// memoryStore keeps every URL in a map. It is meant for tests and throwaway
+// local runs; nothing survives a restart.
+type memoryStore struct {
+	mu      sync.RWMutex
+	nextID  int
+	urls    map[string]*models.URL
+	expired []models.URL
+	clicks  []models.ClickEvent
+	keys    []memoryKey
+
+	// Sequences have their own lock so code generators may reserve numbers
+	// while a batch insert holds mu
+	seqMu     sync.Mutex
+	sequences map[string]int64
+}
+
+type memoryKey struct {
+	key  models.APIKey
+	hash string
+}
+
+// NewMemoryStore returns an empty in-memory Store
+func NewMemoryStore() Store {
+	return &memoryStore{
+		nextID:    1,
+		urls:      make(map[string]*models.URL),
+		sequences: make(map[string]int64),
+	}
+}
+
+func (s *memoryStore) Create(ctx context.Context, u *models.URL, codes CodeAllocator) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	generated := u.GeneratedCode || u.ShortCode == ""
+	u.GeneratedCode = generated
+	for collisions := 0; ; collisions++ {
+		if generated && (collisions > 0 || u.ShortCode == "") {
+			code, err := codes.Next(ctx, collisions)
+			if err != nil {
+				return err
+			}
+			u.ShortCode = code
+		}
+		if _, exists := s.urls[u.ShortCode]; !exists {
+			break
+		}
+		if !generated {
+			return ErrConflict
+		}
+	}
+
+	now := time.Now().UTC()
+	u.ID = s.nextID
+	u.CreatedAt = now
+	u.UpdatedAt = now
+	s.nextID++
+
+	stored := *u
+	if u.ExpiresAt != nil {
+		expiresAt := u.ExpiresAt.UTC()
+		stored.ExpiresAt = &expiresAt
+	}
+	s.urls[u.ShortCode] = &stored
+	return nil
+}
+
+func (s *memoryStore) CreateBatch(ctx context.Context, urls []*models.URL, codes CodeAllocator, atomic bool) ([]error, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	errs := make([]error, len(urls))
+	now := time.Now().UTC()
+	var inserted []string
+	rollback := func() {
+		for _, code := range inserted {
+			delete(s.urls, code)
+		}
+	}
+	for i, u := range urls {
+		generated := u.GeneratedCode || u.ShortCode == ""
+		u.GeneratedCode = generated
+		for collisions := 0; ; collisions++ {
+			if generated && (collisions > 0 || u.ShortCode == "") {
+				code, err := codes.Next(ctx, collisions)
+				if errors.Is(err, ErrCodesExhausted) {
+					errs[i] = err
+					break
+				} else if err != nil {
+					rollback()
+					return nil, err
+				}
+				u.ShortCode = code
+			}
+			if _, exists := s.urls[u.ShortCode]; !exists {
+				break
+			}
+			if !generated {
+				errs[i] = ErrConflict
+				break
+			}
+		}
+		if errs[i] != nil {
+			if atomic {
+				rollback()
+				return errs, nil
+			}
+			continue
+		}
+
+		u.ID = s.nextID
+		u.CreatedAt = now
+		u.UpdatedAt = now
+		s.nextID++
+
+		stored := *u
+		if u.ExpiresAt != nil {
+			expiresAt := u.ExpiresAt.UTC()
+			stored.ExpiresAt = &expiresAt
+		}
+		s.urls[u.ShortCode] = &stored
+		inserted = append(inserted, u.ShortCode)
+	}
+	return errs, nil
+}
+
+func (s *memoryStore) GetByCode(ctx context.Context, code string) (*models.URL, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	u, ok := s.urls[code]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	found := *u
+	return &found, nil
+}
+
+func (s *memoryStore) FindReusable(ctx context.Context, owner, destHash string) (*models.URL, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if destHash == "" {
+		return nil, ErrNotFound
+	}
+	var found *models.URL
+	for _, u := range s.urls {
+		if u.DestHash != destHash || u.Owner != owner || !u.GeneratedCode || u.ExpiresAt != nil {
+			continue
+		}
+		if found == nil || u.ID < found.ID {
+			found = u
+		}
+	}
+	if found == nil {
+		return nil, ErrNotFound
+	}
+	reused := *found
+	return &reused, nil
+}
+
+func (s *memoryStore) ListByOwner(ctx context.Context, owner string, afterID, limit int) ([]models.URL, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	urls := []models.URL{}
+	for _, u := range s.urls {
+		if u.Owner == owner && u.ID > afterID {
+			urls = append(urls, *u)
+		}
+	}
+	sort.Slice(urls, func(i, j int) bool { return urls[i].ID < urls[j].ID })
+	if len(urls) > limit {
+		urls = urls[:limit]
+	}
+	return urls, nil
+}
+
+func (s *memoryStore) List(ctx context.Context, f ListFilter) ([]models.URL, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	terms := searchTerms(f.Search)
+	column := sortColumn(f.Sort)
+	// less orders a before b ascending, ties broken by id
+	less := func(a, b *models.URL) bool {
+		switch column {
+		case SortCreatedAt:
+			if !a.CreatedAt.Equal(b.CreatedAt) {
+				return a.CreatedAt.Before(b.CreatedAt)
+			}
+		case SortAccessCount:
+			if a.AccessCount != b.AccessCount {
+				return a.AccessCount < b.AccessCount
+			}
+		case SortShortCode:
+			return a.ShortCode < b.ShortCode
+		}
+		return a.ID < b.ID
+	}
+	var after *models.URL
+	if f.After != nil {
+		after = &models.URL{ID: f.After.ID, CreatedAt: f.After.CreatedAt, AccessCount: f.After.AccessCount, ShortCode: f.After.ShortCode}
+	}
+
+	urls := []models.URL{}
+	for _, u := range s.urls {
+		switch {
+		case f.Owner != "" && u.Owner != f.Owner,
+			f.Host != "" && linkHost(u.URL) != strings.ToLower(f.Host),
+			!f.CreatedAfter.IsZero() && u.CreatedAt.Before(f.CreatedAfter),
+			!f.CreatedBefore.IsZero() && !u.CreatedAt.Before(f.CreatedBefore),
+			u.AccessCount < f.MinAccessCount,
+			!strings.HasPrefix(u.ShortCode, f.CodePrefix),
+			len(terms) > 0 && !matchesTerms(u.URL+" "+u.Title, terms),
+			f.ThreatStatus != "" && u.ThreatStatus != f.ThreatStatus,
+			after != nil && !f.Desc && !less(after, u),
+			after != nil && f.Desc && !less(u, after):
+			continue
+		}
+		urls = append(urls, *u)
+	}
+	sort.Slice(urls, func(i, j int) bool {
+		if f.Desc {
+			return less(&urls[j], &urls[i])
+		}
+		return less(&urls[i], &urls[j])
+	})
+	if len(urls) > f.Limit {
+		urls = urls[:f.Limit]
+	}
+	return urls, nil
+}
+
+func (s *memoryStore) ForEachURL(ctx context.Context, fn func(*models.URL) error) error {
+	s.mu.RLock()
+	urls := make([]models.URL, 0, len(s.urls))
+	for _, u := range s.urls {
+		urls = append(urls, *u)
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(urls, func(i, j int) bool { return urls[i].ID < urls[j].ID })
+	for i := range urls {
+		if err := fn(&urls[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *memoryStore) ImportBatch(ctx context.Context, urls []*models.URL, onConflict string) ([]error, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	errs := make([]error, len(urls))
+	if onConflict == ConflictFail {
+		seen := make(map[string]bool, len(urls))
+		for i, u := range urls {
+			if _, exists := s.urls[u.ShortCode]; exists || seen[u.ShortCode] {
+				errs[i] = ErrConflict
+				return errs, nil
+			}
+			seen[u.ShortCode] = true
+		}
+	}
+
+	for i, u := range urls {
+		if existing, exists := s.urls[u.ShortCode]; exists {
+			if onConflict != ConflictOverwrite {
+				errs[i] = ErrConflict
+				continue
+			}
+			u.ID = existing.ID
+		} else {
+			u.ID = s.nextID
+			s.nextID++
+		}
+
+		stored := *u
+		stored.CreatedAt = u.CreatedAt.UTC()
+		stored.UpdatedAt = u.UpdatedAt.UTC()
+		if u.ExpiresAt != nil {
+			expiresAt := u.ExpiresAt.UTC()
+			stored.ExpiresAt = &expiresAt
+		}
+		s.urls[u.ShortCode] = &stored
+	}
+	return errs, nil
+}
+
+func (s *memoryStore) BackfillDestHashes(ctx context.Context, hash func(url string) string, limit int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := 0
+	for _, u := range s.urls {
+		if n >= limit {
+			break
+		}
+		if u.DestHash == "" && !u.GeneratedCode {
+			u.DestHash = hash(u.URL)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *memoryStore) AssignUnowned(ctx context.Context, owner string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := 0
+	for _, u := range s.urls {
+		if u.Owner == "" {
+			u.Owner = owner
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *memoryStore) UpdateLink(ctx context.Context, code, newURL, newCode string) (*models.URL, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.urls[code]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if newCode != "" && newCode != code {
+		if _, exists := s.urls[newCode]; exists {
+			return nil, ErrConflict
+		}
+		delete(s.urls, code)
+		u.ShortCode = newCode
+		s.urls[newCode] = u
+	}
+	if newURL != "" {
+		u.URL = newURL
+		u.DestHash = ""
+		u.ThreatStatus, u.ThreatMatch = "", ""
+	}
+	u.UpdatedAt = time.Now().UTC()
+
+	updated := *u
+	return &updated, nil
+}
+
+func (s *memoryStore) SetThreatStatus(ctx context.Context, code, url, status, match string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.urls[code]
+	if !ok || u.URL != url {
+		return ErrNotFound
+	}
+	u.ThreatStatus, u.ThreatMatch = status, match
+	return nil
+}
+
+func (s *memoryStore) Delete(ctx context.Context, code string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.urls[code]; !ok {
+		return ErrNotFound
+	}
+	delete(s.urls, code)
+	return nil
+}
+
+func (s *memoryStore) IncrementAccess(ctx context.Context, code string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.urls[code]
+	if !ok {
+		return ErrNotFound
+	}
+	u.AccessCount++
+	u.UpdatedAt = time.Now().UTC()
+	return nil
+}
+
+func (s *memoryStore) IncrementAccessBatch(ctx context.Context, counts map[string]int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC()
+	for code, n := range counts {
+		if u, ok := s.urls[code]; ok {
+			u.AccessCount += n
+			u.UpdatedAt = now
+		}
+	}
+	return nil
+}
+
+func (s *memoryStore) RecordClicks(ctx context.Context, events []*models.ClickEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, e := range events {
+		s.clicks = append(s.clicks, *e)
+	}
+	return nil
+}
+
+func (s *memoryStore) ClickStats(ctx context.Context, urlID int, since time.Time, bucket string, topN int) (*models.ClickStats, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	layout := "2006-01-02T00:00:00Z"
+	if bucket == BucketHour {
+		layout = "2006-01-02T15:00:00Z"
+	}
+
+	buckets := make(map[string]int)
+	referrers := make(map[string]int)
+	for _, e := range s.clicks {
+		if e.URLID != urlID || e.ClickedAt.Before(since) {
+			continue
+		}
+		buckets[e.ClickedAt.UTC().Format(layout)]++
+		referrers[e.ReferrerHost]++
+	}
+
+	stats := &models.ClickStats{
+		Clicks:       []models.BucketCount{},
+		TopReferrers: []models.ReferrerCount{},
+	}
+	for b, n := range buckets {
+		stats.Clicks = append(stats.Clicks, models.BucketCount{Bucket: b, Count: n})
+	}
+	sort.Slice(stats.Clicks, func(i, j int) bool {
+		return stats.Clicks[i].Bucket < stats.Clicks[j].Bucket
+	})
+	for r, n := range referrers {
+		stats.TopReferrers = append(stats.TopReferrers, models.ReferrerCount{Referrer: r, Count: n})
+	}
+	sort.Slice(stats.TopReferrers, func(i, j int) bool {
+		a, b := stats.TopReferrers[i], stats.TopReferrers[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.Referrer < b.Referrer
+	})
+	if len(stats.TopReferrers) > topN {
+		stats.TopReferrers = stats.TopReferrers[:topN]
+	}
+	return stats, nil
+}
+
+func (s *memoryStore) SweepExpired(ctx context.Context, before time.Time, limit int, archive bool) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	removed := 0
+	for code, u := range s.urls {
+		if removed >= limit {
+			break
+		}
+		if !u.IsExpired(before) {
+			continue
+		}
+		if archive {
+			s.expired = append(s.expired, *u)
+		}
+		delete(s.urls, code)
+		removed++
+	}
+	return removed, nil
+}
+
+func (s *memoryStore) IsArchived(ctx context.Context, code string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, u := range s.expired {
+		if u.ShortCode == code {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *memoryStore) ReserveSequence(ctx context.Context, name string, n int) (int64, error) {
+	s.seqMu.Lock()
+	defer s.seqMu.Unlock()
+
+	first := s.sequences[name] + 1
+	s.sequences[name] += int64(n)
+	return first, nil
+}
+
+func (s *memoryStore) CreateAPIKey(ctx context.Context, k *models.APIKey, hash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.keys {
+		if existing.hash == hash {
+			return ErrConflict
+		}
+	}
+	k.ID = len(s.keys) + 1
+	k.CreatedAt = time.Now().UTC()
+	s.keys = append(s.keys, memoryKey{key: *k, hash: hash})
+	return nil
+}
+
+func (s *memoryStore) GetAPIKeyByHash(ctx context.Context, hash string) (*models.APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, existing := range s.keys {
+		if existing.hash == hash {
+			k := existing.key
+			return &k, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (s *memoryStore) ListAPIKeys(ctx context.Context) ([]models.APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys := make([]models.APIKey, 0, len(s.keys))
+	for _, existing := range s.keys {
+		keys = append(keys, existing.key)
+	}
+	return keys, nil
+}
+
+func (s *memoryStore) RevokeAPIKey(ctx context.Context, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.keys {
+		if s.keys[i].key.ID == id && s.keys[i].key.RevokedAt == nil {
+			now := time.Now().UTC()
+			s.keys[i].key.RevokedAt = &now
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (s *memoryStore) Stats(ctx context.Context) Stats {
+	return Stats{Connected: true}
+}
+
+func (s *memoryStore) Ping(ctx context.Context) error {
+	return nil
+}
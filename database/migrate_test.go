@@ -0,0 +1,82 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadMigrationsPairsUpAndDown(t *testing.T) {
+	for _, dialect := range []string{DialectSQLite, DialectPostgres} {
+		migrations, err := loadMigrations(dialect)
+		if err != nil {
+			t.Fatalf("%s: %v", dialect, err)
+		}
+		for i, m := range migrations {
+			if m.Version != i+1 {
+				t.Errorf("%s: migration %d has version %d, want consecutive versions", dialect, i, m.Version)
+			}
+			if m.Up == "" || m.Down == "" {
+				t.Errorf("%s: migration %04d_%s lacks an up or down script", dialect, m.Version, m.Name)
+			}
+		}
+	}
+	sqlite, _ := loadMigrations(DialectSQLite)
+	postgres, _ := loadMigrations(DialectPostgres)
+	if len(sqlite) != len(postgres) {
+		t.Errorf("%d SQLite and %d PostgreSQL migrations, want the same schema history", len(sqlite), len(postgres))
+	}
+}
+
+func TestMigratorUpDown(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	m, err := NewMigrator(db, DialectSQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	total := len(m.migrations)
+
+	if pending, err := m.Pending(ctx); err != nil || pending != total {
+		t.Fatalf("pending on an empty database = %d, %v, want %d", pending, err, total)
+	}
+	if n, err := m.Up(ctx); err != nil || n != total {
+		t.Fatalf("Up applied %d: %v", n, err)
+	}
+	if n, err := m.Up(ctx); err != nil || n != 0 {
+		t.Errorf("second Up applied %d: %v", n, err)
+	}
+
+	if n, err := m.Down(ctx, 2); err != nil || n != 2 {
+		t.Fatalf("Down(2) rolled back %d: %v", n, err)
+	}
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range statuses {
+		if want := s.Version <= total-2; s.Applied != want {
+			t.Errorf("migration %04d applied = %v, want %v", s.Version, s.Applied, want)
+		}
+	}
+
+	// Every down script must undo its up script for a full cycle to work
+	if n, err := m.Down(ctx, total); err != nil || n != total-2 {
+		t.Fatalf("Down(all) rolled back %d: %v", n, err)
+	}
+	var tables int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'urls'`).Scan(&tables); err != nil || tables != 0 {
+		t.Errorf("urls table left after rolling everything back (%d, %v)", tables, err)
+	}
+	if n, err := m.Up(ctx); err != nil || n != total {
+		t.Fatalf("Up after a full rollback applied %d: %v", n, err)
+	}
+	if pending, err := m.Pending(ctx); err != nil || pending != 0 {
+		t.Errorf("pending after Up = %d, %v", pending, err)
+	}
+}
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_urls_created_at;
+DROP INDEX IF EXISTS idx_urls_short_code;
+DROP TABLE IF EXISTS urls;
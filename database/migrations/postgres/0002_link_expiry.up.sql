@@ -0,0 +1,14 @@
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS expires_at TIMESTAMP WITH TIME ZONE;
+CREATE INDEX IF NOT EXISTS idx_urls_expires_at ON urls(expires_at) WHERE expires_at IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS expired_urls (
+	id INTEGER PRIMARY KEY,
+	url TEXT NOT NULL,
+	short_code VARCHAR(50) NOT NULL,
+	created_at TIMESTAMP WITH TIME ZONE,
+	updated_at TIMESTAMP WITH TIME ZONE,
+	access_count INTEGER NOT NULL DEFAULT 0,
+	expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+	archived_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_expired_urls_short_code ON expired_urls(short_code);
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS click_events (
+	id BIGSERIAL PRIMARY KEY,
+	url_id INTEGER NOT NULL REFERENCES urls(id) ON DELETE CASCADE,
+	clicked_at TIMESTAMP WITH TIME ZONE NOT NULL,
+	referrer_host TEXT NOT NULL DEFAULT '',
+	browser VARCHAR(50) NOT NULL DEFAULT '',
+	os VARCHAR(50) NOT NULL DEFAULT '',
+	device VARCHAR(20) NOT NULL DEFAULT '',
+	ip VARCHAR(64) NOT NULL DEFAULT '',
+	country VARCHAR(2) NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS idx_click_events_url_id_clicked_at ON click_events(url_id, clicked_at);
@@ -0,0 +1,4 @@
+ALTER TABLE api_keys DROP COLUMN IF EXISTS owner;
+ALTER TABLE expired_urls DROP COLUMN IF EXISTS owner;
+DROP INDEX IF EXISTS idx_urls_owner;
+ALTER TABLE urls DROP COLUMN IF EXISTS owner;
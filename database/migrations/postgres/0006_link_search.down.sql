@@ -0,0 +1,9 @@
+ALTER TABLE expired_urls DROP COLUMN IF EXISTS title;
+
+DROP INDEX IF EXISTS idx_urls_search;
+DROP INDEX IF EXISTS idx_urls_short_code_prefix;
+DROP INDEX IF EXISTS idx_urls_access_count;
+DROP INDEX IF EXISTS idx_urls_created_id;
+DROP INDEX IF EXISTS idx_urls_host;
+ALTER TABLE urls DROP COLUMN IF EXISTS host;
+ALTER TABLE urls DROP COLUMN IF EXISTS title;
@@ -0,0 +1,15 @@
+ALTER TABLE urls ADD COLUMN title TEXT NOT NULL DEFAULT '';
+ALTER TABLE urls ADD COLUMN host TEXT NOT NULL DEFAULT '';
+UPDATE urls SET host = lower(coalesce(substring(url from '://(?:[^/?#@]*@)?([^/?#:]+)'), ''));
+
+CREATE INDEX IF NOT EXISTS idx_urls_host ON urls(host, id);
+CREATE INDEX IF NOT EXISTS idx_urls_created_id ON urls(created_at, id);
+CREATE INDEX IF NOT EXISTS idx_urls_access_count ON urls(access_count, id);
+CREATE INDEX IF NOT EXISTS idx_urls_short_code_prefix ON urls(short_code varchar_pattern_ops);
+
+-- Must match the expression used by the store's search queries
+CREATE INDEX IF NOT EXISTS idx_urls_search ON urls USING GIN (
+	to_tsvector('simple', regexp_replace(url || ' ' || title, '[^[:alnum:]]+', ' ', 'g'))
+);
+
+ALTER TABLE expired_urls ADD COLUMN title TEXT NOT NULL DEFAULT '';
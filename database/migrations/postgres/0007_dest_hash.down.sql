@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_urls_dest_hash;
+ALTER TABLE urls DROP COLUMN IF EXISTS generated_code;
+ALTER TABLE urls DROP COLUMN IF EXISTS dest_hash;
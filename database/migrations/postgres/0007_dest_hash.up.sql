@@ -0,0 +1,3 @@
+ALTER TABLE urls ADD COLUMN dest_hash TEXT NOT NULL DEFAULT '';
+ALTER TABLE urls ADD COLUMN generated_code BOOLEAN NOT NULL DEFAULT FALSE;
+CREATE INDEX IF NOT EXISTS idx_urls_dest_hash ON urls USING HASH (dest_hash) WHERE dest_hash <> '';
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_urls_threat_status;
+ALTER TABLE urls DROP COLUMN IF EXISTS threat_match;
+ALTER TABLE urls DROP COLUMN IF EXISTS threat_status;
@@ -0,0 +1,3 @@
+ALTER TABLE urls ADD COLUMN threat_status TEXT NOT NULL DEFAULT '';
+ALTER TABLE urls ADD COLUMN threat_match TEXT NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS idx_urls_threat_status ON urls(threat_status, id) WHERE threat_status <> '';
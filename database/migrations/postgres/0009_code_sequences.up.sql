@@ -0,0 +1,4 @@
+CREATE TABLE IF NOT EXISTS code_sequences (
+	name VARCHAR(50) PRIMARY KEY,
+	next_value BIGINT NOT NULL
+);
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS urls (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	url TEXT NOT NULL,
+	short_code TEXT UNIQUE NOT NULL,
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	access_count INTEGER NOT NULL DEFAULT 0
+);
@@ -0,0 +1,14 @@
+ALTER TABLE urls ADD COLUMN expires_at DATETIME;
+CREATE INDEX IF NOT EXISTS idx_urls_expires_at ON urls(expires_at);
+
+CREATE TABLE IF NOT EXISTS expired_urls (
+	id INTEGER PRIMARY KEY,
+	url TEXT NOT NULL,
+	short_code TEXT NOT NULL,
+	created_at DATETIME NOT NULL,
+	updated_at DATETIME NOT NULL,
+	access_count INTEGER NOT NULL DEFAULT 0,
+	expires_at DATETIME NOT NULL,
+	archived_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_expired_urls_short_code ON expired_urls(short_code);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_click_events_url_id_clicked_at;
+DROP TABLE IF EXISTS click_events;
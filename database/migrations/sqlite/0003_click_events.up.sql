@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS click_events (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	url_id INTEGER NOT NULL,
+	clicked_at DATETIME NOT NULL,
+	referrer_host TEXT NOT NULL DEFAULT '',
+	browser TEXT NOT NULL DEFAULT '',
+	os TEXT NOT NULL DEFAULT '',
+	device TEXT NOT NULL DEFAULT '',
+	ip TEXT NOT NULL DEFAULT '',
+	country TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS idx_click_events_url_id_clicked_at ON click_events(url_id, clicked_at);
@@ -0,0 +1,7 @@
+ALTER TABLE urls ADD COLUMN owner TEXT NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS idx_urls_owner ON urls(owner, id);
+
+ALTER TABLE expired_urls ADD COLUMN owner TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE api_keys ADD COLUMN owner TEXT NOT NULL DEFAULT '';
+UPDATE api_keys SET owner = name WHERE owner = '';
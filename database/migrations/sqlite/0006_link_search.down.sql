@@ -0,0 +1,13 @@
+DROP TRIGGER IF EXISTS urls_fts_ai;
+DROP TRIGGER IF EXISTS urls_fts_au;
+DROP TRIGGER IF EXISTS urls_fts_bd;
+DROP TRIGGER IF EXISTS urls_fts_bu;
+DROP TABLE IF EXISTS urls_fts;
+
+ALTER TABLE expired_urls DROP COLUMN title;
+
+DROP INDEX IF EXISTS idx_urls_access_count;
+DROP INDEX IF EXISTS idx_urls_created_id;
+DROP INDEX IF EXISTS idx_urls_host;
+ALTER TABLE urls DROP COLUMN host;
+ALTER TABLE urls DROP COLUMN title;
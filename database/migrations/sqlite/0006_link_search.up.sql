@@ -0,0 +1,35 @@
+ALTER TABLE urls ADD COLUMN title TEXT NOT NULL DEFAULT '';
+ALTER TABLE urls ADD COLUMN host TEXT NOT NULL DEFAULT '';
+
+-- Backfill the destination host: strip the scheme, then everything from the
+-- first path, query, fragment or port separator
+UPDATE urls SET host = substr(url, instr(url, '://') + 3) WHERE instr(url, '://') > 0;
+UPDATE urls SET host = substr(host, 1, instr(host, '/') - 1) WHERE instr(host, '/') > 0;
+UPDATE urls SET host = substr(host, 1, instr(host, '?') - 1) WHERE instr(host, '?') > 0;
+UPDATE urls SET host = substr(host, 1, instr(host, '#') - 1) WHERE instr(host, '#') > 0;
+UPDATE urls SET host = substr(host, instr(host, '@') + 1) WHERE instr(host, '@') > 0;
+UPDATE urls SET host = substr(host, 1, instr(host, ':') - 1) WHERE instr(host, ':') > 0;
+UPDATE urls SET host = lower(host);
+
+CREATE INDEX IF NOT EXISTS idx_urls_host ON urls(host, id);
+CREATE INDEX IF NOT EXISTS idx_urls_created_id ON urls(created_at, id);
+CREATE INDEX IF NOT EXISTS idx_urls_access_count ON urls(access_count, id);
+
+ALTER TABLE expired_urls ADD COLUMN title TEXT NOT NULL DEFAULT '';
+
+-- Full-text index over destination and title, kept in sync by triggers
+CREATE VIRTUAL TABLE IF NOT EXISTS urls_fts USING fts4(content="urls", url, title);
+INSERT INTO urls_fts(urls_fts) VALUES('rebuild');
+
+CREATE TRIGGER IF NOT EXISTS urls_fts_bu BEFORE UPDATE OF url, title ON urls BEGIN
+	DELETE FROM urls_fts WHERE docid = old.id;
+END;
+CREATE TRIGGER IF NOT EXISTS urls_fts_bd BEFORE DELETE ON urls BEGIN
+	DELETE FROM urls_fts WHERE docid = old.id;
+END;
+CREATE TRIGGER IF NOT EXISTS urls_fts_au AFTER UPDATE OF url, title ON urls BEGIN
+	INSERT INTO urls_fts(docid, url, title) VALUES (new.id, new.url, new.title);
+END;
+CREATE TRIGGER IF NOT EXISTS urls_fts_ai AFTER INSERT ON urls BEGIN
+	INSERT INTO urls_fts(docid, url, title) VALUES (new.id, new.url, new.title);
+END;
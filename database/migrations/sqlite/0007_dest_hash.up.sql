@@ -0,0 +1,3 @@
+ALTER TABLE urls ADD COLUMN dest_hash TEXT NOT NULL DEFAULT '';
+ALTER TABLE urls ADD COLUMN generated_code INTEGER NOT NULL DEFAULT 0;
+CREATE INDEX IF NOT EXISTS idx_urls_dest_hash ON urls(dest_hash) WHERE dest_hash <> '';
@@ -0,0 +1,4 @@
+CREATE TABLE IF NOT EXISTS code_sequences (
+	name TEXT PRIMARY KEY,
+	next_value INTEGER NOT NULL
+);
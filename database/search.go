@@ -0,0 +1,44 @@
+package database
+
+import (
+	"net/url"
+	"strings"
+	"unicode"
+)
+
+// linkHost returns the lower-cased host of a destination URL, which is what
+// the host filter of List matches against
+func linkHost(raw string) string {
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(parsed.Hostname())
+}
+
+// searchTerms splits a search query into lower-cased words. Anything that is
+// not a letter or digit separates words, so the terms never carry full-text
+// query operators.
+func searchTerms(q string) []string {
+	return strings.FieldsFunc(strings.ToLower(q), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// matchesTerms reports whether every term is a prefix of a word in text
+func matchesTerms(text string, terms []string) bool {
+	words := searchTerms(text)
+	for _, term := range terms {
+		found := false
+		for _, word := range words {
+			if strings.HasPrefix(word, term) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
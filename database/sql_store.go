@@ -0,0 +1,822 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"urlshortner/models"
+
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+)
+
+const (
+	DialectPostgres = "postgres"
+	DialectSQLite   = "sqlite3"
+)
+
+// sqlStore implements Store on top of database/sql. Both supported drivers
+// accept $N placeholders, so the dialect only matters for error mapping.
+type sqlStore struct {
+	db      *sql.DB
+	dialect string
+}
+
+// NewPostgresStore returns a Store backed by a PostgreSQL connection pool
+func NewPostgresStore(db *sql.DB) Store {
+	return &sqlStore{db: db, dialect: DialectPostgres}
+}
+
+// NewSQLiteStore returns a Store backed by a SQLite database
+func NewSQLiteStore(db *sql.DB) Store {
+	return &sqlStore{db: db, dialect: DialectSQLite}
+}
+
+func (s *sqlStore) Create(ctx context.Context, u *models.URL, codes CodeAllocator) error {
+	now := time.Now().UTC()
+	generated := u.GeneratedCode || u.ShortCode == ""
+	u.GeneratedCode = generated
+	for collisions := 0; ; collisions++ {
+		if generated && (collisions > 0 || u.ShortCode == "") {
+			code, err := codes.Next(ctx, collisions)
+			if err != nil {
+				return err
+			}
+			u.ShortCode = code
+		}
+
+		// A taken code inserts nothing, so the unique index decides without a
+		// separate lookup
+		err := s.db.QueryRowContext(ctx,
+			`INSERT INTO urls (url, short_code, created_at, updated_at, expires_at, owner, title, host, dest_hash, generated_code)
+			VALUES ($1, $2, $3, $3, $4, $5, $6, $7, $8, $9)
+			ON CONFLICT (short_code) DO NOTHING RETURNING id`,
+			u.URL, u.ShortCode, now, u.ExpiresAt, u.Owner, u.Title, linkHost(u.URL), u.DestHash, u.GeneratedCode).Scan(&u.ID)
+		if errors.Is(err, sql.ErrNoRows) {
+			if !generated {
+				return ErrConflict
+			}
+			continue
+		} else if err != nil {
+			return s.mapError(err)
+		}
+		u.CreatedAt = now
+		u.UpdatedAt = now
+		return nil
+	}
+}
+
+func (s *sqlStore) CreateBatch(ctx context.Context, urls []*models.URL, codes CodeAllocator, atomic bool) ([]error, error) {
+	errs := make([]error, len(urls))
+	collisions := make([]int, len(urls))
+	var draw []int
+	for i, u := range urls {
+		u.GeneratedCode = u.GeneratedCode || u.ShortCode == ""
+		if u.ShortCode == "" {
+			draw = append(draw, i)
+		}
+	}
+
+	for {
+		// Codes are drawn before the transaction opens: sequence backed
+		// generators reserve numbers through the store, which under SQLite
+		// would wait on the transaction's own write lock
+		for _, i := range draw {
+			code, err := codes.Next(ctx, collisions[i])
+			if errors.Is(err, ErrCodesExhausted) {
+				errs[i] = err
+				if atomic {
+					return errs, nil
+				}
+				continue
+			} else if err != nil {
+				return nil, err
+			}
+			urls[i].ShortCode = code
+		}
+
+		taken, err := s.insertBatch(ctx, urls, errs, atomic)
+		if err != nil || len(taken) == 0 {
+			return errs, err
+		}
+		// Redraw the taken generated codes and insert the batch again
+		for _, i := range taken {
+			collisions[i]++
+		}
+		draw = taken
+	}
+}
+
+// insertBatch inserts the links of urls without an error in one
+// transaction. Taken custom codes are recorded in errs as ErrConflict. When
+// generated codes were taken it rolls back and returns their indexes so they
+// can be redrawn.
+func (s *sqlStore) insertBatch(ctx context.Context, urls []*models.URL, errs []error, atomic bool) ([]int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Taken codes insert nothing instead of aborting the transaction
+	stmt, err := tx.PrepareContext(ctx, `
+	INSERT INTO urls (url, short_code, created_at, updated_at, expires_at, owner, title, host, dest_hash, generated_code)
+	VALUES ($1, $2, $3, $3, $4, $5, $6, $7, $8, $9)
+	ON CONFLICT (short_code) DO NOTHING RETURNING id`)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	now := time.Now().UTC()
+	var taken []int
+	for i, u := range urls {
+		if errs[i] != nil {
+			continue
+		}
+		err := stmt.QueryRowContext(ctx,
+			u.URL, u.ShortCode, now, u.ExpiresAt, u.Owner, u.Title, linkHost(u.URL), u.DestHash, u.GeneratedCode).Scan(&u.ID)
+		if err == nil {
+			u.CreatedAt = now
+			u.UpdatedAt = now
+			continue
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		if u.GeneratedCode {
+			taken = append(taken, i)
+			continue
+		}
+		errs[i] = ErrConflict
+		if atomic {
+			return nil, nil
+		}
+	}
+	if len(taken) > 0 {
+		return taken, nil
+	}
+	return nil, tx.Commit()
+}
+
+func (s *sqlStore) GetByCode(ctx context.Context, code string) (*models.URL, error) {
+	row := s.db.QueryRowContext(ctx,
+		`SELECT `+urlColumns+` FROM urls WHERE short_code = $1`,
+		code)
+
+	u, err := scanURL(row)
+	if err != nil {
+		return nil, s.mapError(err)
+	}
+	return u, nil
+}
+
+func (s *sqlStore) FindReusable(ctx context.Context, owner, destHash string) (*models.URL, error) {
+	row := s.db.QueryRowContext(ctx,
+		`SELECT `+urlColumns+` FROM urls
+		WHERE dest_hash = $1 AND owner = $2 AND generated_code AND expires_at IS NULL
+		ORDER BY id LIMIT 1`,
+		destHash, owner)
+
+	u, err := scanURL(row)
+	if err != nil {
+		return nil, s.mapError(err)
+	}
+	return u, nil
+}
+
+func (s *sqlStore) ListByOwner(ctx context.Context, owner string, afterID, limit int) ([]models.URL, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+urlColumns+` FROM urls WHERE owner = $1 AND id > $2 ORDER BY id LIMIT $3`,
+		owner, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	urls := []models.URL{}
+	for rows.Next() {
+		u, err := scanURL(rows)
+		if err != nil {
+			return nil, err
+		}
+		urls = append(urls, *u)
+	}
+	return urls, rows.Err()
+}
+
+func (s *sqlStore) List(ctx context.Context, f ListFilter) ([]models.URL, error) {
+	var where []string
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	if f.Owner != "" {
+		where = append(where, "owner = "+arg(f.Owner))
+	}
+	if f.Host != "" {
+		where = append(where, "host = "+arg(strings.ToLower(f.Host)))
+	}
+	if !f.CreatedAfter.IsZero() {
+		where = append(where, "created_at >= "+arg(f.CreatedAfter.UTC()))
+	}
+	if !f.CreatedBefore.IsZero() {
+		where = append(where, "created_at < "+arg(f.CreatedBefore.UTC()))
+	}
+	if f.MinAccessCount > 0 {
+		where = append(where, "access_count >= "+arg(f.MinAccessCount))
+	}
+	if f.CodePrefix != "" {
+		where = append(where, s.prefixExpr(f.CodePrefix, arg))
+	}
+	if terms := searchTerms(f.Search); len(terms) > 0 {
+		where = append(where, s.searchExpr(terms, arg))
+	}
+	if f.ThreatStatus != "" {
+		where = append(where, "threat_status = "+arg(f.ThreatStatus))
+	}
+
+	column := sortColumn(f.Sort)
+	op, dir := ">", "ASC"
+	if f.Desc {
+		op, dir = "<", "DESC"
+	}
+	if c := f.After; c != nil {
+		switch column {
+		case SortID:
+			where = append(where, "id "+op+" "+arg(c.ID))
+		case SortCreatedAt:
+			where = append(where, "(created_at, id) "+op+" ("+arg(c.CreatedAt.UTC())+", "+arg(c.ID)+")")
+		case SortAccessCount:
+			where = append(where, "(access_count, id) "+op+" ("+arg(c.AccessCount)+", "+arg(c.ID)+")")
+		case SortShortCode:
+			where = append(where, "short_code "+op+" "+arg(c.ShortCode))
+		}
+	}
+
+	query := `SELECT ` + urlColumns + ` FROM urls`
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, " AND ")
+	}
+	// Short codes are unique, so they need no id tie-breaker
+	query += ` ORDER BY ` + column + ` ` + dir
+	if column != SortID && column != SortShortCode {
+		query += `, id ` + dir
+	}
+	query += ` LIMIT ` + arg(f.Limit)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	urls := []models.URL{}
+	for rows.Next() {
+		u, err := scanURL(rows)
+		if err != nil {
+			return nil, err
+		}
+		urls = append(urls, *u)
+	}
+	return urls, rows.Err()
+}
+
+func sortColumn(sort string) string {
+	switch sort {
+	case SortCreatedAt, SortAccessCount, SortShortCode:
+		return sort
+	}
+	return SortID
+}
+
+// prefixExpr matches short codes starting with prefix in a way the dialect
+// can answer from an index
+func (s *sqlStore) prefixExpr(prefix string, arg func(interface{}) string) string {
+	pattern := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(prefix) + "%"
+	if s.dialect == DialectSQLite {
+		// LIKE is case-insensitive in SQLite and cannot use the index, but the
+		// BINARY collated unique index answers a range scan
+		return "short_code >= " + arg(prefix) + " AND short_code < " + arg(prefix+"\U0010FFFF")
+	}
+	return "short_code LIKE " + arg(pattern) + ` ESCAPE '\'`
+}
+
+// pgSearchVector is the expression indexed by idx_urls_search
+const pgSearchVector = `to_tsvector('simple', regexp_replace(url || ' ' || title, '[^[:alnum:]]+', ' ', 'g'))`
+
+// searchExpr matches links containing every term as a word prefix through the
+// dialect's full-text index
+func (s *sqlStore) searchExpr(terms []string, arg func(interface{}) string) string {
+	if s.dialect == DialectSQLite {
+		return "id IN (SELECT docid FROM urls_fts WHERE urls_fts MATCH " + arg(strings.Join(terms, "* ")+"*") + ")"
+	}
+	return pgSearchVector + " @@ to_tsquery('simple', " + arg(strings.Join(terms, ":* & ")+":*") + ")"
+}
+
+func (s *sqlStore) ForEachURL(ctx context.Context, fn func(*models.URL) error) error {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+urlColumns+` FROM urls ORDER BY id`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		u, err := scanURL(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(u); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (s *sqlStore) ImportBatch(ctx context.Context, urls []*models.URL, onConflict string) ([]error, error) {
+	errs := make([]error, len(urls))
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	conflict := `DO NOTHING`
+	if onConflict == ConflictOverwrite {
+		conflict = `DO UPDATE SET url = excluded.url, access_count = excluded.access_count,
+		created_at = excluded.created_at, updated_at = excluded.updated_at, expires_at = excluded.expires_at,
+		owner = excluded.owner, title = excluded.title, host = excluded.host,
+		dest_hash = excluded.dest_hash, generated_code = excluded.generated_code,
+		threat_status = excluded.threat_status, threat_match = excluded.threat_match`
+	}
+	stmt, err := tx.PrepareContext(ctx, `
+	INSERT INTO urls (url, short_code, access_count, created_at, updated_at, expires_at, owner, title, host, dest_hash,
+		generated_code, threat_status, threat_match)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+	ON CONFLICT (short_code) `+conflict+` RETURNING id`)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	for i, u := range urls {
+		err := stmt.QueryRowContext(ctx,
+			u.URL, u.ShortCode, u.AccessCount, u.CreatedAt.UTC(), u.UpdatedAt.UTC(), u.ExpiresAt, u.Owner, u.Title, linkHost(u.URL), u.DestHash,
+			u.GeneratedCode, u.ThreatStatus, u.ThreatMatch).Scan(&u.ID)
+		if errors.Is(err, sql.ErrNoRows) {
+			errs[i] = ErrConflict
+			if onConflict == ConflictFail {
+				return errs, nil
+			}
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	return errs, tx.Commit()
+}
+
+// urlColumns are the columns read by scanURL, in order
+const urlColumns = `id, url, short_code, access_count, created_at, updated_at, expires_at, owner, title, threat_status, threat_match, dest_hash, generated_code`
+
+func scanURL(row scanner) (*models.URL, error) {
+	var u models.URL
+	var expiresAt sql.NullTime
+	if err := row.Scan(&u.ID, &u.URL, &u.ShortCode, &u.AccessCount, &u.CreatedAt, &u.UpdatedAt, &expiresAt, &u.Owner, &u.Title, &u.ThreatStatus, &u.ThreatMatch, &u.DestHash, &u.GeneratedCode); err != nil {
+		return nil, err
+	}
+	if expiresAt.Valid {
+		u.ExpiresAt = &expiresAt.Time
+	}
+	return &u, nil
+}
+
+func (s *sqlStore) UpdateLink(ctx context.Context, code, newURL, newCode string) (*models.URL, error) {
+	sets := []string{"updated_at = $1"}
+	args := []interface{}{time.Now().UTC()}
+	if newURL != "" {
+		args = append(args, newURL, linkHost(newURL))
+		sets = append(sets, "url = $2", "host = $3", "dest_hash = ''", "threat_status = ''", "threat_match = ''")
+	}
+	if newCode != "" {
+		args = append(args, newCode)
+		sets = append(sets, "short_code = $"+strconv.Itoa(len(args)))
+	} else {
+		newCode = code
+	}
+	args = append(args, code)
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx,
+		`UPDATE urls SET `+strings.Join(sets, ", ")+` WHERE short_code = $`+strconv.Itoa(len(args)),
+		args...)
+	if err != nil {
+		return nil, s.mapError(err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return nil, err
+	} else if n == 0 {
+		return nil, ErrNotFound
+	}
+
+	u, err := scanURL(tx.QueryRowContext(ctx, `SELECT `+urlColumns+` FROM urls WHERE short_code = $1`, newCode))
+	if err != nil {
+		return nil, s.mapError(err)
+	}
+	return u, tx.Commit()
+}
+
+func (s *sqlStore) SetThreatStatus(ctx context.Context, code, url, status, match string) error {
+	return s.execOne(ctx, `UPDATE urls SET threat_status = $1, threat_match = $2 WHERE short_code = $3 AND url = $4`,
+		status, match, code, url)
+}
+
+func (s *sqlStore) Delete(ctx context.Context, code string) error {
+	return s.execOne(ctx, `DELETE FROM urls WHERE short_code = $1`, code)
+}
+
+func (s *sqlStore) IncrementAccess(ctx context.Context, code string) error {
+	return s.execOne(ctx,
+		`UPDATE urls SET access_count = access_count + 1, updated_at = CURRENT_TIMESTAMP WHERE short_code = $1`,
+		code)
+}
+
+func (s *sqlStore) IncrementAccessBatch(ctx context.Context, counts map[string]int) error {
+	if len(counts) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx,
+		`UPDATE urls SET access_count = access_count + $1, updated_at = CURRENT_TIMESTAMP WHERE short_code = $2`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for code, n := range counts {
+		// Links deleted since the redirect simply match no rows
+		if _, err := stmt.ExecContext(ctx, n, code); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *sqlStore) RecordClicks(ctx context.Context, events []*models.ClickEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `
+	INSERT INTO click_events (url_id, clicked_at, referrer_host, browser, os, device, ip, country)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, e := range events {
+		_, err := stmt.ExecContext(ctx,
+			e.URLID, e.ClickedAt.UTC(), e.ReferrerHost, e.Browser, e.OS, e.Device, e.IP, e.Country)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *sqlStore) ClickStats(ctx context.Context, urlID int, since time.Time, bucket string, topN int) (*models.ClickStats, error) {
+	stats := &models.ClickStats{
+		Clicks:       []models.BucketCount{},
+		TopReferrers: []models.ReferrerCount{},
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+	SELECT `+s.bucketExpr(bucket)+` AS bucket, COUNT(*)
+	FROM click_events WHERE url_id = $1 AND clicked_at >= $2
+	GROUP BY bucket ORDER BY bucket`,
+		urlID, since.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var bc models.BucketCount
+		if err := rows.Scan(&bc.Bucket, &bc.Count); err != nil {
+			return nil, err
+		}
+		stats.Clicks = append(stats.Clicks, bc)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	refRows, err := s.db.QueryContext(ctx, `
+	SELECT referrer_host, COUNT(*) AS clicks
+	FROM click_events WHERE url_id = $1 AND clicked_at >= $2
+	GROUP BY referrer_host ORDER BY clicks DESC, referrer_host LIMIT $3`,
+		urlID, since.UTC(), topN)
+	if err != nil {
+		return nil, err
+	}
+	defer refRows.Close()
+	for refRows.Next() {
+		var rc models.ReferrerCount
+		if err := refRows.Scan(&rc.Referrer, &rc.Count); err != nil {
+			return nil, err
+		}
+		stats.TopReferrers = append(stats.TopReferrers, rc)
+	}
+	return stats, refRows.Err()
+}
+
+// bucketExpr renders clicked_at truncated to the bucket as an RFC 3339 string
+func (s *sqlStore) bucketExpr(bucket string) string {
+	if s.dialect == DialectSQLite {
+		if bucket == BucketHour {
+			return `strftime('%Y-%m-%dT%H:00:00Z', clicked_at)`
+		}
+		return `strftime('%Y-%m-%dT00:00:00Z', clicked_at)`
+	}
+	if bucket == BucketHour {
+		return `to_char(clicked_at AT TIME ZONE 'UTC', 'YYYY-MM-DD"T"HH24":00:00Z"')`
+	}
+	return `to_char(clicked_at AT TIME ZONE 'UTC', 'YYYY-MM-DD"T00:00:00Z"')`
+}
+
+func (s *sqlStore) SweepExpired(ctx context.Context, before time.Time, limit int, archive bool) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx,
+		`SELECT id FROM urls WHERE expires_at IS NOT NULL AND expires_at <= $1 ORDER BY expires_at LIMIT $2`,
+		before.UTC(), limit)
+	if err != nil {
+		return 0, err
+	}
+	var ids []interface{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	in := placeholders(1, len(ids))
+	if archive {
+		args := append([]interface{}{time.Now().UTC()}, ids...)
+		_, err := tx.ExecContext(ctx, `
+		INSERT INTO expired_urls (id, url, short_code, created_at, updated_at, access_count, expires_at, owner, title, archived_at)
+		SELECT id, url, short_code, created_at, updated_at, access_count, expires_at, owner, title, $1
+		FROM urls WHERE id IN (`+placeholders(2, len(ids))+`)`, args...)
+		if err != nil {
+			return 0, err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM urls WHERE id IN (`+in+`)`, ids...); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(ids), nil
+}
+
+func (s *sqlStore) IsArchived(ctx context.Context, code string) (bool, error) {
+	var archived bool
+	err := s.db.QueryRowContext(ctx,
+		`SELECT EXISTS (SELECT 1 FROM expired_urls WHERE short_code = $1)`,
+		code).Scan(&archived)
+	return archived, err
+}
+
+func (s *sqlStore) ReserveSequence(ctx context.Context, name string, n int) (int64, error) {
+	var end int64
+	err := s.db.QueryRowContext(ctx, `
+	INSERT INTO code_sequences (name, next_value) VALUES ($1, 1 + $2)
+	ON CONFLICT (name) DO UPDATE SET next_value = code_sequences.next_value + $2
+	RETURNING next_value`, name, n).Scan(&end)
+	if err != nil {
+		return 0, err
+	}
+	return end - int64(n), nil
+}
+
+func (s *sqlStore) CreateAPIKey(ctx context.Context, k *models.APIKey, hash string) error {
+	now := time.Now().UTC()
+	row := s.db.QueryRowContext(ctx,
+		`INSERT INTO api_keys (name, owner, key_prefix, key_hash, scopes, created_at) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`,
+		k.Name, k.Owner, k.Prefix, hash, strings.Join(k.Scopes, ","), now)
+	if err := row.Scan(&k.ID); err != nil {
+		return s.mapError(err)
+	}
+	k.CreatedAt = now
+	return nil
+}
+
+func (s *sqlStore) GetAPIKeyByHash(ctx context.Context, hash string) (*models.APIKey, error) {
+	row := s.db.QueryRowContext(ctx,
+		`SELECT id, name, owner, key_prefix, scopes, created_at, revoked_at FROM api_keys WHERE key_hash = $1`,
+		hash)
+	k, err := scanAPIKey(row)
+	if err != nil {
+		return nil, s.mapError(err)
+	}
+	return k, nil
+}
+
+func (s *sqlStore) ListAPIKeys(ctx context.Context) ([]models.APIKey, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, name, owner, key_prefix, scopes, created_at, revoked_at FROM api_keys ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *k)
+	}
+	return keys, rows.Err()
+}
+
+func (s *sqlStore) RevokeAPIKey(ctx context.Context, id int) error {
+	return s.execOne(ctx,
+		`UPDATE api_keys SET revoked_at = $1 WHERE id = $2 AND revoked_at IS NULL`,
+		time.Now().UTC(), id)
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanAPIKey(row scanner) (*models.APIKey, error) {
+	var k models.APIKey
+	var scopes string
+	var revokedAt sql.NullTime
+	if err := row.Scan(&k.ID, &k.Name, &k.Owner, &k.Prefix, &scopes, &k.CreatedAt, &revokedAt); err != nil {
+		return nil, err
+	}
+	k.Scopes = splitScopes(scopes)
+	if revokedAt.Valid {
+		k.RevokedAt = &revokedAt.Time
+	}
+	return &k, nil
+}
+
+func splitScopes(scopes string) []string {
+	if scopes == "" {
+		return []string{}
+	}
+	return strings.Split(scopes, ",")
+}
+
+func (s *sqlStore) AssignUnowned(ctx context.Context, owner string) (int, error) {
+	res, err := s.db.ExecContext(ctx, `UPDATE urls SET owner = $1 WHERE owner = ''`, owner)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+func (s *sqlStore) BackfillDestHashes(ctx context.Context, hash func(url string) string, limit int) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx,
+		`SELECT id, url FROM urls WHERE dest_hash = '' AND NOT generated_code ORDER BY id LIMIT $1`, limit)
+	if err != nil {
+		return 0, err
+	}
+	hashes := make(map[int]string)
+	for rows.Next() {
+		var id int
+		var url string
+		if err := rows.Scan(&id, &url); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		hashes[id] = hash(url)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for id, h := range hashes {
+		if _, err := tx.ExecContext(ctx, `UPDATE urls SET dest_hash = $1 WHERE id = $2`, h, id); err != nil {
+			return 0, err
+		}
+	}
+	return len(hashes), tx.Commit()
+}
+
+func (s *sqlStore) Stats(ctx context.Context) Stats {
+	stats := s.db.Stats()
+	return Stats{
+		Connected:       s.db.PingContext(ctx) == nil,
+		OpenConnections: stats.OpenConnections,
+		InUse:           stats.InUse,
+		Idle:            stats.Idle,
+	}
+}
+
+func (s *sqlStore) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+// execOne runs a statement that is expected to touch exactly one row
+func (s *sqlStore) execOne(ctx context.Context, query string, args ...interface{}) error {
+	res, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return s.mapError(err)
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// placeholders renders "$start, $start+1, ..." for count arguments
+func placeholders(start, count int) string {
+	var b strings.Builder
+	for i := 0; i < count; i++ {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString("$" + strconv.Itoa(start+i))
+	}
+	return b.String()
+}
+
+// mapError translates driver specific errors into the Store sentinel errors
+func (s *sqlStore) mapError(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if isUniqueViolation(err) {
+		return ErrConflict
+	}
+	return err
+}
+
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return true
+	}
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+		return true
+	}
+	return false
+}
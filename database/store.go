@@ -0,0 +1,176 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"urlshortner/models"
+)
+
+var (
+	// ErrNotFound is returned when no row matches the requested short code or key
+	ErrNotFound = errors.New("not found")
+	// ErrConflict is returned when a short code is already taken
+	ErrConflict = errors.New("short code already exists")
+	// ErrCodesExhausted is returned when every generated short code tried
+	// within the retry budget was taken
+	ErrCodesExhausted = errors.New("no free short code found within the retry budget")
+)
+
+// CodeAllocator supplies generated short codes to Create and CreateBatch.
+// Next is called for every insert attempt with the number of codes already
+// found taken for the link, and returns ErrCodesExhausted once that exceeds
+// its retry budget.
+type CodeAllocator interface {
+	Next(ctx context.Context, collisions int) (string, error)
+}
+
+// How ImportBatch treats short codes that are already taken
+const (
+	ConflictSkip      = "skip"
+	ConflictOverwrite = "overwrite"
+	ConflictFail      = "fail"
+)
+
+// Click statistics bucket sizes
+const (
+	BucketHour = "hour"
+	BucketDay  = "day"
+)
+
+// Sort orders accepted by List
+const (
+	SortID          = "id"
+	SortCreatedAt   = "created_at"
+	SortAccessCount = "access_count"
+	SortShortCode   = "short_code"
+)
+
+// ListFilter selects, orders and pages the links returned by List. Zero
+// fields do not filter.
+type ListFilter struct {
+	Owner          string
+	Host           string
+	CreatedAfter   time.Time
+	CreatedBefore  time.Time
+	MinAccessCount int
+	CodePrefix     string
+	// Search matches links whose destination or title contain every word,
+	// each word also matching as a prefix
+	Search string
+	// ThreatStatus selects links the threat re-scan flagged or disabled
+	ThreatStatus string
+
+	Sort string
+	Desc bool
+	// After continues a listing past the link it was taken from
+	After *Cursor
+	Limit int
+}
+
+// Cursor is the position of a link in a List ordering
+type Cursor struct {
+	ID          int       `json:"id"`
+	CreatedAt   time.Time `json:"created_at,omitzero"`
+	AccessCount int       `json:"access_count,omitempty"`
+	ShortCode   string    `json:"short_code,omitempty"`
+}
+
+// CursorFor returns the position of u under the given sort order
+func CursorFor(u *models.URL, sort string) *Cursor {
+	c := &Cursor{ID: u.ID}
+	switch sort {
+	case SortCreatedAt:
+		c.CreatedAt = u.CreatedAt
+	case SortAccessCount:
+		c.AccessCount = u.AccessCount
+	case SortShortCode:
+		c.ShortCode = u.ShortCode
+	}
+	return c
+}
+
+// Stats describes the health of the backing storage
+type Stats struct {
+	Connected       bool
+	OpenConnections int
+	InUse           int
+	Idle            int
+}
+
+// Store is the persistence layer used by the HTTP handlers
+type Store interface {
+	// Create inserts u. A link without a short code gets one from codes,
+	// inserted and redrawn on collision until codes gives up; a taken custom
+	// code is ErrConflict.
+	Create(ctx context.Context, u *models.URL, codes CodeAllocator) error
+	// CreateBatch inserts urls in one transaction and reports one error per
+	// link, ErrConflict for a taken custom code and ErrCodesExhausted when no
+	// generated code was free. Links without a short code, or with
+	// GeneratedCode set, get one from codes, drawn again on collision. With
+	// atomic set the first failure rolls back every insert.
+	CreateBatch(ctx context.Context, urls []*models.URL, codes CodeAllocator, atomic bool) ([]error, error)
+	GetByCode(ctx context.Context, code string) (*models.URL, error)
+	// FindReusable returns the oldest link of owner with a generated code, no
+	// expiry and the given destination hash
+	FindReusable(ctx context.Context, owner, destHash string) (*models.URL, error)
+	// ListByOwner returns up to limit links of owner with an id above afterID
+	ListByOwner(ctx context.Context, owner string, afterID, limit int) ([]models.URL, error)
+	// List returns the links matching f in the requested order
+	List(ctx context.Context, f ListFilter) ([]models.URL, error)
+	// ForEachURL calls fn with every link in id order, stopping at the first
+	// error fn returns
+	ForEachURL(ctx context.Context, fn func(*models.URL) error) error
+	// ImportBatch writes links as given, keeping their timestamps and access
+	// counts, in one transaction. Taken short codes are reported as
+	// ErrConflict and left alone under ConflictSkip, replaced under
+	// ConflictOverwrite, and roll back the whole batch under ConflictFail.
+	ImportBatch(ctx context.Context, urls []*models.URL, onConflict string) ([]error, error)
+	// AssignUnowned gives every link without an owner to owner
+	AssignUnowned(ctx context.Context, owner string) (int, error)
+	// BackfillDestHashes sets the destination hash, as computed by hash, on
+	// at most limit links that predate destination hashes and returns how
+	// many it updated. Generated links without a hash were retargeted and
+	// stay out of reuse, so they are left alone.
+	BackfillDestHashes(ctx context.Context, hash func(url string) string, limit int) (int, error)
+	// UpdateLink points the link at newURL and renames it to newCode, leaving
+	// either unchanged when empty, and returns the updated link. Retargeted
+	// links are no longer offered for reuse and lose their threat status.
+	UpdateLink(ctx context.Context, code, newURL, newCode string) (*models.URL, error)
+	// SetThreatStatus records the threat status of a link and the feed entry
+	// behind it, both empty once the destination is no longer listed. It
+	// returns ErrNotFound unless the link still points at url, so a verdict
+	// about a destination the link was retargeted away from is dropped.
+	SetThreatStatus(ctx context.Context, code, url, status, match string) error
+	Delete(ctx context.Context, code string) error
+	IncrementAccess(ctx context.Context, code string) error
+	// IncrementAccessBatch adds counts[code] to each code's access count in a
+	// single transaction
+	IncrementAccessBatch(ctx context.Context, counts map[string]int) error
+	RecordClicks(ctx context.Context, events []*models.ClickEvent) error
+	// ClickStats buckets the clicks on urlID since the given time by hour or
+	// day and lists the topN referrer hosts
+	ClickStats(ctx context.Context, urlID int, since time.Time, bucket string, topN int) (*models.ClickStats, error)
+	// SweepExpired removes at most limit links that expired before the given
+	// time, copying them to expired_urls first when archive is set. It
+	// returns how many links were removed.
+	SweepExpired(ctx context.Context, before time.Time, limit int, archive bool) (int, error)
+	// IsArchived reports whether a link with code was moved to expired_urls
+	IsArchived(ctx context.Context, code string) (bool, error)
+
+	// ReserveSequence reserves n consecutive numbers of the named sequence,
+	// which starts at 1, and returns the first
+	ReserveSequence(ctx context.Context, name string, n int) (int64, error)
+
+	// CreateAPIKey stores k along with the hash of its secret
+	CreateAPIKey(ctx context.Context, k *models.APIKey, hash string) error
+	// GetAPIKeyByHash returns the key with the given secret hash, revoked or not
+	GetAPIKeyByHash(ctx context.Context, hash string) (*models.APIKey, error)
+	ListAPIKeys(ctx context.Context) ([]models.APIKey, error)
+	// RevokeAPIKey marks an active key as revoked
+	RevokeAPIKey(ctx context.Context, id int) error
+
+	Stats(ctx context.Context) Stats
+	Ping(ctx context.Context) error
+}
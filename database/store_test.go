@@ -0,0 +1,487 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"urlshortner/models"
+)
+
+// newTestSQLiteStore returns a SQLite store in a fresh, fully migrated file
+func newTestSQLiteStore(t *testing.T) (Store, *sql.DB) {
+	t.Helper()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	m, err := NewMigrator(db, DialectSQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return NewSQLiteStore(db), db
+}
+
+// forEachStore runs fn against every Store implementation
+func forEachStore(t *testing.T, fn func(t *testing.T, s Store)) {
+	t.Run("memory", func(t *testing.T) { fn(t, NewMemoryStore()) })
+	t.Run("sqlite", func(t *testing.T) {
+		s, _ := newTestSQLiteStore(t)
+		fn(t, s)
+	})
+}
+
+// fixedCodes hands out its codes in order, one per insert attempt
+type fixedCodes []string
+
+func (c fixedCodes) Next(ctx context.Context, collisions int) (string, error) {
+	if collisions >= len(c) {
+		return "", ErrCodesExhausted
+	}
+	return c[collisions], nil
+}
+
+// sequenceCodes numbers codes from a store sequence, like the sequence and
+// hashids generators do, so every code takes a write of its own
+type sequenceCodes struct{ store Store }
+
+func (c sequenceCodes) Next(ctx context.Context, collisions int) (string, error) {
+	if collisions > 2 {
+		return "", ErrCodesExhausted
+	}
+	n, err := c.store.ReserveSequence(ctx, "short_code", 1)
+	if err != nil {
+		return "", err
+	}
+	return "seq" + strconv.FormatInt(n, 10), nil
+}
+
+func mustCreate(t *testing.T, s Store, u *models.URL) {
+	t.Helper()
+	if err := s.Create(context.Background(), u, nil); err != nil {
+		t.Fatalf("Create(%s): %v", u.ShortCode, err)
+	}
+}
+
+func TestStoreCreate(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		u := &models.URL{URL: "https://example.com/", ShortCode: "custom", Owner: "alice"}
+		mustCreate(t, s, u)
+		if u.ID == 0 || u.CreatedAt.IsZero() {
+			t.Errorf("created link = %+v, want its id and timestamps set", u)
+		}
+
+		if err := s.Create(ctx, &models.URL{URL: "https://example.com/", ShortCode: "custom"}, nil); !errors.Is(err, ErrConflict) {
+			t.Errorf("taken custom code: err = %v, want ErrConflict", err)
+		}
+
+		// The first generated code collides with the custom one and is redrawn
+		u = &models.URL{URL: "https://example.com/gen"}
+		if err := s.Create(ctx, u, fixedCodes{"custom", "gen001"}); err != nil {
+			t.Fatal(err)
+		}
+		if u.ShortCode != "gen001" || !u.GeneratedCode {
+			t.Errorf("generated link = %q (generated %v), want gen001", u.ShortCode, u.GeneratedCode)
+		}
+		if err := s.Create(ctx, &models.URL{URL: "https://example.com/"}, fixedCodes{"custom"}); !errors.Is(err, ErrCodesExhausted) {
+			t.Errorf("exhausted allocator: err = %v, want ErrCodesExhausted", err)
+		}
+
+		got, err := s.GetByCode(ctx, "custom")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.URL != "https://example.com/" || got.Owner != "alice" || got.GeneratedCode {
+			t.Errorf("GetByCode = %+v", got)
+		}
+		if _, err := s.GetByCode(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("missing code: err = %v, want ErrNotFound", err)
+		}
+	})
+}
+
+func TestStoreOwners(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		mustCreate(t, s, &models.URL{URL: "https://example.com/1", ShortCode: "a1", Owner: "alice"})
+		mustCreate(t, s, &models.URL{URL: "https://example.com/2", ShortCode: "legacy"})
+		mustCreate(t, s, &models.URL{URL: "https://example.com/3", ShortCode: "a2", Owner: "alice"})
+
+		if n, err := s.AssignUnowned(ctx, "alice"); err != nil || n != 1 {
+			t.Fatalf("AssignUnowned = %d, %v, want 1", n, err)
+		}
+		urls, err := s.ListByOwner(ctx, "alice", 0, 2)
+		if err != nil || len(urls) != 2 || urls[0].ShortCode != "a1" || urls[1].ShortCode != "legacy" {
+			t.Fatalf("first page = %v, %v", urls, err)
+		}
+		if urls, _ = s.ListByOwner(ctx, "alice", urls[1].ID, 2); len(urls) != 1 || urls[0].ShortCode != "a2" {
+			t.Errorf("second page = %v, want a2", urls)
+		}
+		if urls, _ = s.ListByOwner(ctx, "bob", 0, 10); len(urls) != 0 {
+			t.Errorf("bob's links = %v, want none", urls)
+		}
+	})
+}
+
+func TestStoreCreateBatch(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		mustCreate(t, s, &models.URL{URL: "https://example.com/", ShortCode: "taken"})
+
+		batch := []*models.URL{
+			{URL: "https://a.example/", ShortCode: "new1"},
+			{URL: "https://b.example/", ShortCode: "taken"},
+		}
+		errs, err := s.CreateBatch(ctx, batch, nil, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if errs[0] != nil || !errors.Is(errs[1], ErrConflict) {
+			t.Errorf("best effort batch errors = %v", errs)
+		}
+		if _, err := s.GetByCode(ctx, "new1"); err != nil {
+			t.Errorf("best effort batch dropped the good link: %v", err)
+		}
+
+		batch = []*models.URL{
+			{URL: "https://c.example/", ShortCode: "new2"},
+			{URL: "https://d.example/", ShortCode: "taken"},
+		}
+		if _, err := s.CreateBatch(ctx, batch, nil, true); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.GetByCode(ctx, "new2"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("atomic batch kept a link after a conflict: %v", err)
+		}
+
+		// Generated codes are redrawn on collision
+		batch = []*models.URL{{URL: "https://e.example/"}}
+		if errs, err := s.CreateBatch(ctx, batch, fixedCodes{"taken", "gen001"}, false); err != nil || errs[0] != nil {
+			t.Fatalf("generated batch = %v, %v", errs, err)
+		}
+		if batch[0].ShortCode != "gen001" {
+			t.Errorf("generated code = %q, want gen001", batch[0].ShortCode)
+		}
+	})
+}
+
+func TestStoreCreateBatchSequenceCodes(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		mustCreate(t, s, &models.URL{URL: "https://example.com/", ShortCode: "seq2"})
+
+		for _, atomic := range []bool{false, true} {
+			batch := []*models.URL{{URL: "https://a.example/"}, {URL: "https://b.example/"}, {URL: "https://c.example/"}}
+			errs, err := s.CreateBatch(ctx, batch, sequenceCodes{s}, atomic)
+			if err != nil {
+				t.Fatalf("atomic %v: %v", atomic, err)
+			}
+			for i, u := range batch {
+				if errs[i] != nil {
+					t.Errorf("atomic %v: link %d: %v", atomic, i, errs[i])
+					continue
+				}
+				if got, err := s.GetByCode(ctx, u.ShortCode); err != nil || got.URL != u.URL {
+					t.Errorf("atomic %v: link %d stored as %q: %+v, %v", atomic, i, u.ShortCode, got, err)
+				}
+			}
+		}
+	})
+}
+
+func TestStoreFindReusable(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		future := time.Now().Add(time.Hour)
+		mustCreate(t, s, &models.URL{URL: "https://example.com/", ShortCode: "custom", Owner: "alice", DestHash: "h"})
+		mustCreate(t, s, &models.URL{URL: "https://example.com/", ShortCode: "expiring", Owner: "alice", DestHash: "h", GeneratedCode: true, ExpiresAt: &future})
+		mustCreate(t, s, &models.URL{URL: "https://example.com/", ShortCode: "gen1", Owner: "alice", DestHash: "h", GeneratedCode: true})
+		mustCreate(t, s, &models.URL{URL: "https://example.com/", ShortCode: "gen2", Owner: "alice", DestHash: "h", GeneratedCode: true})
+
+		u, err := s.FindReusable(ctx, "alice", "h")
+		if err != nil || u.ShortCode != "gen1" {
+			t.Fatalf("FindReusable = %+v, %v, want the oldest generated link", u, err)
+		}
+		if _, err := s.FindReusable(ctx, "bob", "h"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("other owner: err = %v, want ErrNotFound", err)
+		}
+		if _, err := s.FindReusable(ctx, "alice", "other"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("other destination: err = %v, want ErrNotFound", err)
+		}
+	})
+}
+
+func TestStoreUpdateLink(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		mustCreate(t, s, &models.URL{URL: "https://old.example/", ShortCode: "abc", DestHash: "h"})
+		mustCreate(t, s, &models.URL{URL: "https://other.example/", ShortCode: "taken"})
+		if err := s.SetThreatStatus(ctx, "abc", "https://old.example/", models.ThreatFlagged, "host old.example"); err != nil {
+			t.Fatal(err)
+		}
+
+		u, err := s.UpdateLink(ctx, "abc", "https://new.example/", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if u.URL != "https://new.example/" || u.DestHash != "" || u.ThreatStatus != "" || u.ThreatMatch != "" {
+			t.Errorf("retargeted link = %+v, want reuse hash and threat status cleared", u)
+		}
+		// A verdict about the old destination no longer applies
+		if err := s.SetThreatStatus(ctx, "abc", "https://old.example/", models.ThreatDisabled, "host old.example"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("stale threat verdict: err = %v, want ErrNotFound", err)
+		}
+
+		if u, err = s.UpdateLink(ctx, "abc", "", "renamed"); err != nil || u.ShortCode != "renamed" || u.URL != "https://new.example/" {
+			t.Fatalf("rename = %+v, %v", u, err)
+		}
+		if _, err := s.GetByCode(ctx, "abc"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("old code still resolves after rename: %v", err)
+		}
+		if _, err := s.UpdateLink(ctx, "renamed", "", "taken"); !errors.Is(err, ErrConflict) {
+			t.Errorf("rename onto a taken code: err = %v, want ErrConflict", err)
+		}
+		if _, err := s.UpdateLink(ctx, "missing", "https://x.example/", ""); !errors.Is(err, ErrNotFound) {
+			t.Errorf("update of unknown code: err = %v, want ErrNotFound", err)
+		}
+
+		if err := s.Delete(ctx, "renamed"); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Delete(ctx, "renamed"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("second delete: err = %v, want ErrNotFound", err)
+		}
+	})
+}
+
+func TestStoreAccessCountsAndSweep(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		past := time.Now().Add(-time.Hour)
+		mustCreate(t, s, &models.URL{URL: "https://example.com/", ShortCode: "live"})
+		mustCreate(t, s, &models.URL{URL: "https://example.com/", ShortCode: "old1", ExpiresAt: &past})
+		mustCreate(t, s, &models.URL{URL: "https://example.com/", ShortCode: "old2", ExpiresAt: &past})
+
+		if err := s.IncrementAccessBatch(ctx, map[string]int{"live": 3, "old1": 1}); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.IncrementAccess(ctx, "live"); err != nil {
+			t.Fatal(err)
+		}
+		if u, _ := s.GetByCode(ctx, "live"); u.AccessCount != 4 {
+			t.Errorf("access count = %d, want 4", u.AccessCount)
+		}
+		if err := s.Ping(ctx); err != nil {
+			t.Errorf("Ping: %v", err)
+		}
+
+		n, err := s.SweepExpired(ctx, time.Now(), 1, true)
+		if err != nil || n != 1 {
+			t.Fatalf("first sweep removed %d: %v", n, err)
+		}
+		if n, err = s.SweepExpired(ctx, time.Now(), 10, false); err != nil || n != 1 {
+			t.Fatalf("second sweep removed %d: %v", n, err)
+		}
+		if _, err := s.GetByCode(ctx, "live"); err != nil {
+			t.Errorf("sweep removed a live link: %v", err)
+		}
+
+		// Only the first sweep archived its link
+		archived := 0
+		for _, code := range []string{"live", "old1", "old2"} {
+			ok, err := s.IsArchived(ctx, code)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok {
+				archived++
+			}
+		}
+		if ok, _ := s.IsArchived(ctx, "live"); ok || archived != 1 {
+			t.Errorf("archived %d links (live %v), want one expired link", archived, ok)
+		}
+	})
+}
+
+func TestStoreBackfillDestHashes(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		mustCreate(t, s, &models.URL{URL: "https://a.example/", ShortCode: "old1"})
+		mustCreate(t, s, &models.URL{URL: "https://b.example/", ShortCode: "old2"})
+		mustCreate(t, s, &models.URL{URL: "https://c.example/", ShortCode: "old3"})
+		mustCreate(t, s, &models.URL{URL: "https://d.example/", ShortCode: "hashed", DestHash: "kept"})
+		mustCreate(t, s, &models.URL{URL: "https://e.example/", ShortCode: "retargeted", GeneratedCode: true})
+
+		hash := func(url string) string { return "h:" + url }
+		if n, err := s.BackfillDestHashes(ctx, hash, 2); err != nil || n != 2 {
+			t.Fatalf("first batch = %d, %v, want 2", n, err)
+		}
+		if n, err := s.BackfillDestHashes(ctx, hash, 2); err != nil || n != 1 {
+			t.Fatalf("second batch = %d, %v, want 1", n, err)
+		}
+		if n, err := s.BackfillDestHashes(ctx, hash, 2); err != nil || n != 0 {
+			t.Errorf("third batch = %d, %v, want nothing left", n, err)
+		}
+
+		want := map[string]string{
+			"old1":       "h:https://a.example/",
+			"old2":       "h:https://b.example/",
+			"old3":       "h:https://c.example/",
+			"hashed":     "kept",
+			"retargeted": "",
+		}
+		for code, hash := range want {
+			u, err := s.GetByCode(ctx, code)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if u.DestHash != hash {
+				t.Errorf("%s: dest hash %q, want %q", code, u.DestHash, hash)
+			}
+		}
+	})
+}
+
+func TestStoreImportBatch(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		mustCreate(t, s, &models.URL{URL: "https://old.example/", ShortCode: "taken"})
+		created := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+		rows := func() []*models.URL {
+			return []*models.URL{
+				{URL: "https://new.example/", ShortCode: "taken", AccessCount: 7, CreatedAt: created, UpdatedAt: created},
+				{URL: "https://fresh.example/", ShortCode: "fresh", AccessCount: 2, CreatedAt: created, UpdatedAt: created, DestHash: "h", GeneratedCode: true},
+			}
+		}
+
+		errs, err := s.ImportBatch(ctx, rows(), ConflictSkip)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !errors.Is(errs[0], ErrConflict) || errs[1] != nil {
+			t.Errorf("skip errors = %v", errs)
+		}
+		if u, _ := s.GetByCode(ctx, "taken"); u.URL != "https://old.example/" {
+			t.Errorf("skip replaced the existing link with %q", u.URL)
+		}
+		u, err := s.GetByCode(ctx, "fresh")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if u.AccessCount != 2 || !u.CreatedAt.Equal(created) || !u.GeneratedCode {
+			t.Errorf("imported link = %+v, want its access count, timestamps and generated flag kept", u)
+		}
+		if u, err := s.FindReusable(ctx, "", "h"); err != nil || u.ShortCode != "fresh" {
+			t.Errorf("FindReusable after import = %+v, %v, want the generated link", u, err)
+		}
+
+		if errs, err = s.ImportBatch(ctx, rows(), ConflictOverwrite); err != nil || errs[0] != nil || errs[1] != nil {
+			t.Fatalf("overwrite = %v, %v", errs, err)
+		}
+		if u, _ := s.GetByCode(ctx, "taken"); u.URL != "https://new.example/" || u.AccessCount != 7 {
+			t.Errorf("overwritten link = %+v", u)
+		}
+
+		failing := []*models.URL{
+			{URL: "https://other.example/", ShortCode: "another", CreatedAt: created, UpdatedAt: created},
+			{URL: "https://other.example/", ShortCode: "taken", CreatedAt: created, UpdatedAt: created},
+		}
+		errs, err = s.ImportBatch(ctx, failing, ConflictFail)
+		if err == nil && !errors.Is(errs[1], ErrConflict) {
+			t.Errorf("fail on conflict = %v, %v, want the conflict reported", errs, err)
+		}
+		if _, err := s.GetByCode(ctx, "another"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("failed import kept a row: %v", err)
+		}
+	})
+}
+
+func TestStoreSequencesAndKeys(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		if first, err := s.ReserveSequence(ctx, "short_code", 10); err != nil || first != 1 {
+			t.Fatalf("first reservation = %d, %v, want 1", first, err)
+		}
+		if next, err := s.ReserveSequence(ctx, "short_code", 5); err != nil || next != 11 {
+			t.Errorf("second reservation = %d, %v, want 11", next, err)
+		}
+		if other, err := s.ReserveSequence(ctx, "other", 1); err != nil || other != 1 {
+			t.Errorf("separate sequence = %d, %v, want 1", other, err)
+		}
+
+		k := &models.APIKey{Name: "ci", Owner: "ops", Prefix: "us_abcd", Scopes: []string{"create", "stats"}}
+		if err := s.CreateAPIKey(ctx, k, "hash1"); err != nil {
+			t.Fatal(err)
+		}
+		got, err := s.GetAPIKeyByHash(ctx, "hash1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.ID != k.ID || got.Owner != "ops" || len(got.Scopes) != 2 || got.RevokedAt != nil {
+			t.Errorf("stored key = %+v", got)
+		}
+		if err := s.RevokeAPIKey(ctx, k.ID); err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := s.GetAPIKeyByHash(ctx, "hash1"); got.RevokedAt == nil {
+			t.Error("revoked key has no revoked_at")
+		}
+		if err := s.RevokeAPIKey(ctx, k.ID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("second revoke: err = %v, want ErrNotFound", err)
+		}
+		if _, err := s.GetAPIKeyByHash(ctx, "nope"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("unknown hash: err = %v, want ErrNotFound", err)
+		}
+	})
+}
+
+func TestStoreList(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		ctx := context.Background()
+		mustCreate(t, s, &models.URL{URL: "https://docs.example/guide", ShortCode: "aaa", Owner: "alice", Title: "Install guide"})
+		mustCreate(t, s, &models.URL{URL: "https://blog.example/post", ShortCode: "bbb", Owner: "alice"})
+		mustCreate(t, s, &models.URL{URL: "https://docs.example/api", ShortCode: "ccc", Owner: "alice"})
+		mustCreate(t, s, &models.URL{URL: "https://docs.example/bob", ShortCode: "ddd", Owner: "bob"})
+
+		codes := func(f ListFilter) string {
+			t.Helper()
+			urls, err := s.List(ctx, f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, u := range urls {
+				got = append(got, u.ShortCode)
+			}
+			return strings.Join(got, ",")
+		}
+
+		tests := []struct {
+			name string
+			f    ListFilter
+			want string
+		}{
+			{"owner", ListFilter{Owner: "alice", Sort: SortShortCode, Limit: 10}, "aaa,bbb,ccc"},
+			{"host", ListFilter{Host: "docs.example", Sort: SortShortCode, Limit: 10}, "aaa,ccc,ddd"},
+			{"prefix", ListFilter{CodePrefix: "bb", Limit: 10}, "bbb"},
+			{"search", ListFilter{Search: "instal", Limit: 10}, "aaa"},
+			{"descending", ListFilter{Owner: "alice", Sort: SortShortCode, Desc: true, Limit: 2}, "ccc,bbb"},
+			{"cursor", ListFilter{Sort: SortShortCode, After: &Cursor{ID: 2, ShortCode: "bbb"}, Limit: 10}, "ccc,ddd"},
+		}
+		for _, tt := range tests {
+			if got := codes(tt.f); got != tt.want {
+				t.Errorf("%s: listed %q, want %q", tt.name, got, tt.want)
+			}
+		}
+	})
+}
@@ -0,0 +1,136 @@
+package expiry
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"urlshortner/database"
+	"urlshortner/logging"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+var logger = logging.Component("expiry")
+
+// Modes accepted by ParseMode
+const (
+	ModeArchive = "archive"
+	ModePurge   = "purge"
+)
+
+// ParseMode reports whether mode archives expired links rather than
+// purging them, rejecting anything but archive and purge
+func ParseMode(mode string) (archive bool, err error) {
+	switch mode {
+	case ModeArchive:
+		return true, nil
+	case ModePurge:
+		return false, nil
+	}
+	return false, fmt.Errorf("unknown expiry mode %q, want %s or %s", mode, ModeArchive, ModePurge)
+}
+
+// Sweeper periodically removes expired links from the store in batches
+type Sweeper struct {
+	store     database.Store
+	interval  time.Duration
+	batchSize int
+	archive   bool
+
+	runs         atomic.Int64
+	removed      atomic.Int64
+	errors       atomic.Int64
+	lastRun      atomic.Int64 // unix seconds
+	lastDuration atomic.Int64 // nanoseconds
+}
+
+// NewSweeper creates a Sweeper. When archive is set expired links are moved
+// to expired_urls, otherwise they are deleted outright.
+func NewSweeper(store database.Store, interval time.Duration, batchSize int, archive bool) *Sweeper {
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+	return &Sweeper{
+		store:     store,
+		interval:  interval,
+		batchSize: batchSize,
+		archive:   archive,
+	}
+}
+
+// Run sweeps on every tick until ctx is cancelled
+func (s *Sweeper) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.Sweep(ctx)
+		}
+	}
+}
+
+// Sweep drains every currently expired link batch by batch and returns how
+// many were removed
+func (s *Sweeper) Sweep(ctx context.Context) int {
+	start := time.Now()
+	total := 0
+
+	for {
+		n, err := s.store.SweepExpired(ctx, time.Now(), s.batchSize, s.archive)
+		if err != nil {
+			s.errors.Add(1)
+			logger.WithError(err).Error("Failed to sweep expired links")
+			break
+		}
+		total += n
+		s.removed.Add(int64(n))
+		if n < s.batchSize || ctx.Err() != nil {
+			break
+		}
+	}
+
+	s.runs.Add(1)
+	s.lastRun.Store(time.Now().Unix())
+	s.lastDuration.Store(int64(time.Since(start)))
+
+	if total > 0 {
+		logger.WithFields(logrus.Fields{
+			"removed": total,
+			"archive": s.archive,
+		}).Info("Swept expired links")
+	}
+	return total
+}
+
+var (
+	sweepsDesc       = prometheus.NewDesc("urlshortener_expiry_sweeps_total", "Number of expiry sweeps run", nil, nil)
+	removedDesc      = prometheus.NewDesc("urlshortener_expiry_links_removed_total", "Expired links archived or purged", nil, nil)
+	errorsDesc       = prometheus.NewDesc("urlshortener_expiry_errors_total", "Expiry sweeps that failed", nil, nil)
+	lastRunDesc      = prometheus.NewDesc("urlshortener_expiry_last_run_timestamp_seconds", "Unix time of the last sweep", nil, nil)
+	lastDurationDesc = prometheus.NewDesc("urlshortener_expiry_last_duration_seconds", "Duration of the last sweep", nil, nil)
+)
+
+// Describe implements prometheus.Collector
+func (s *Sweeper) Describe(ch chan<- *prometheus.Desc) {
+	ch <- sweepsDesc
+	ch <- removedDesc
+	ch <- errorsDesc
+	ch <- lastRunDesc
+	ch <- lastDurationDesc
+}
+
+// Collect implements prometheus.Collector
+func (s *Sweeper) Collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(sweepsDesc, prometheus.CounterValue, float64(s.runs.Load()))
+	ch <- prometheus.MustNewConstMetric(removedDesc, prometheus.CounterValue, float64(s.removed.Load()))
+	ch <- prometheus.MustNewConstMetric(errorsDesc, prometheus.CounterValue, float64(s.errors.Load()))
+	ch <- prometheus.MustNewConstMetric(lastRunDesc, prometheus.GaugeValue, float64(s.lastRun.Load()))
+	ch <- prometheus.MustNewConstMetric(lastDurationDesc, prometheus.GaugeValue, time.Duration(s.lastDuration.Load()).Seconds())
+}
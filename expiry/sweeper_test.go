@@ -0,0 +1,76 @@
+package expiry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"urlshortner/database"
+	"urlshortner/models"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestParseMode(t *testing.T) {
+	tests := []struct {
+		mode    string
+		archive bool
+		wantErr bool
+	}{
+		{"archive", true, false},
+		{"purge", false, false},
+		{"Archive", false, true},
+		{"archiv", false, true},
+		{"", false, true},
+	}
+	for _, tt := range tests {
+		archive, err := ParseMode(tt.mode)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseMode(%q) error = %v, want error %v", tt.mode, err, tt.wantErr)
+			continue
+		}
+		if archive != tt.archive {
+			t.Errorf("ParseMode(%q) = %v, want %v", tt.mode, archive, tt.archive)
+		}
+	}
+}
+
+func TestSweepDrainsInBatches(t *testing.T) {
+	ctx := context.Background()
+	store := database.NewMemoryStore()
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+	for i := 0; i < 5; i++ {
+		u := &models.URL{URL: "https://example.com/", ShortCode: fmt.Sprintf("old%d", i), ExpiresAt: &past}
+		if err := store.Create(ctx, u, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	live := &models.URL{URL: "https://example.com/", ShortCode: "live", ExpiresAt: &future}
+	if err := store.Create(ctx, live, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewSweeper(store, time.Minute, 2, false)
+	if n := s.Sweep(ctx); n != 5 {
+		t.Fatalf("Sweep removed %d links, want 5", n)
+	}
+	if _, err := store.GetByCode(ctx, "old0"); !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("expired link still present, err = %v", err)
+	}
+	if _, err := store.GetByCode(ctx, "live"); err != nil {
+		t.Errorf("unexpired link removed: %v", err)
+	}
+
+	want := `
+# HELP urlshortener_expiry_links_removed_total Expired links archived or purged
+# TYPE urlshortener_expiry_links_removed_total counter
+urlshortener_expiry_links_removed_total 5
+`
+	if err := testutil.CollectAndCompare(s, strings.NewReader(want), "urlshortener_expiry_links_removed_total"); err != nil {
+		t.Error(err)
+	}
+}
@@ -35,7 +35,26 @@ const Sidebar = ({ selected, setSelected }) => (
     </div>
 );
 
-const CreateForm = ({ setResult }) => {
+// The API key is kept for the browser tab only and sent with every request
+const KEY_STORAGE = "urlshortener.apiKey";
+
+const authHeaders = (apiKey, headers = {}) =>
+    apiKey ? { ...headers, Authorization: `Bearer ${apiKey}` } : headers;
+
+const ApiKeyField = ({ apiKey, setApiKey }) => (
+    <div style={{ display: "flex", flexDirection: "column", gap: 6, maxWidth: 400, marginBottom: 24 }}>
+        <label>API Key</label>
+        <input
+            type="password"
+            value={apiKey}
+            onChange={e => setApiKey(e.target.value)}
+            placeholder="us_..."
+            autoComplete="off"
+        />
+    </div>
+);
+
+const CreateForm = ({ apiKey, setResult }) => {
     const [url, setUrl] = useState("");
     const [code, setCode] = useState("");
     return (
@@ -47,10 +66,10 @@ const CreateForm = ({ setResult }) => {
                 try {
                     const res = await fetch("/shorten", {
                         method: "POST",
-                        headers: { "Content-Type": "application/json" },
+                        headers: authHeaders(apiKey, { "Content-Type": "application/json" }),
                         body: JSON.stringify(body),
                     });
-                    const data = await res.json();
+                    const data = await res.json().catch(() => ({}));
                     if (res.ok) {
                         setResult(
                             <div className="result">Short URL: <a href={data.short_url} target="_blank" rel="noopener noreferrer">{data.short_url}</a></div>
@@ -73,7 +92,7 @@ const CreateForm = ({ setResult }) => {
     );
 };
 
-const UpdateForm = ({ setResult }) => {
+const UpdateForm = ({ apiKey, setResult }) => {
     const [code, setCode] = useState("");
     const [url, setUrl] = useState("");
     const [newCode, setNewCode] = useState("");
@@ -82,15 +101,18 @@ const UpdateForm = ({ setResult }) => {
             onSubmit={async (e) => {
                 e.preventDefault();
                 setResult("");
-                const body = newCode ? { url, short_code: newCode } : { url };
+                const body = {};
+                if (url) body.url = url;
+                if (newCode) body.short_code = newCode;
                 try {
                     const res = await fetch(`/u/${code}`, {
-                        method: "PUT",
-                        headers: { "Content-Type": "application/json" },
+                        method: "PATCH",
+                        headers: authHeaders(apiKey, { "Content-Type": "application/json" }),
                         body: JSON.stringify(body),
                     });
                     if (res.ok) {
-                        setResult(<div className="result">Short URL updated successfully.</div>);
+                        const data = await res.json();
+                        setResult(<div className="result">Short URL updated: <a href={data.short_url}>{data.short_url}</a> → {data.url}</div>);
                     } else {
                         const data = await res.json().catch(() => ({}));
                         setResult(<div className="error">{data.error || `Error: ${res.status}`}</div>);
@@ -103,8 +125,8 @@ const UpdateForm = ({ setResult }) => {
         >
             <label>Short Code to Update</label>
             <input type="text" value={code} onChange={e => setCode(e.target.value)} placeholder="e.g. exmp" required />
-            <label>New Long URL</label>
-            <input type="url" value={url} onChange={e => setUrl(e.target.value)} placeholder="https://new-url.com" required />
+            <label>New Long URL (optional)</label>
+            <input type="url" value={url} onChange={e => setUrl(e.target.value)} placeholder="https://new-url.com" />
             <label>New Short Code (optional)</label>
             <input type="text" value={newCode} onChange={e => setNewCode(e.target.value)} placeholder="e.g. newcode" />
             <button type="submit">Update</button>
@@ -112,7 +134,7 @@ const UpdateForm = ({ setResult }) => {
     );
 };
 
-const DeleteForm = ({ setResult }) => {
+const DeleteForm = ({ apiKey, setResult }) => {
     const [code, setCode] = useState("");
     return (
         <form
@@ -120,7 +142,7 @@ const DeleteForm = ({ setResult }) => {
                 e.preventDefault();
                 setResult("");
                 try {
-                    const res = await fetch(`/u/${code}`, { method: "DELETE" });
+                    const res = await fetch(`/u/${code}`, { method: "DELETE", headers: authHeaders(apiKey) });
                     if (res.ok) {
                         setResult(<div className="result">Short URL deleted successfully.</div>);
                     } else {
@@ -139,7 +161,7 @@ const DeleteForm = ({ setResult }) => {
     );
 };
 
-const StatsForm = ({ setResult }) => {
+const StatsForm = ({ apiKey, setResult }) => {
     const [code, setCode] = useState("");
     return (
         <form
@@ -147,7 +169,7 @@ const StatsForm = ({ setResult }) => {
                 e.preventDefault();
                 setResult("");
                 try {
-                    const res = await fetch(`/stats/${code}`);
+                    const res = await fetch(`/stats/${code}`, { headers: authHeaders(apiKey) });
                     if (res.ok) {
                         const data = await res.json();
                         setResult(<div className="result">Access count: {data.access_count}</div>);
@@ -170,16 +192,23 @@ const StatsForm = ({ setResult }) => {
 const Main = () => {
     const [selected, setSelected] = useState("create");
     const [result, setResult] = useState("");
+    const [apiKey, setApiKeyState] = useState(() => sessionStorage.getItem(KEY_STORAGE) || "");
+    const setApiKey = (key) => {
+        setApiKeyState(key);
+        if (key) sessionStorage.setItem(KEY_STORAGE, key);
+        else sessionStorage.removeItem(KEY_STORAGE);
+    };
     let content;
-    if (selected === "create") content = <CreateForm setResult={setResult} />;
-    if (selected === "update") content = <UpdateForm setResult={setResult} />;
-    if (selected === "delete") content = <DeleteForm setResult={setResult} />;
-    if (selected === "stats") content = <StatsForm setResult={setResult} />;
+    if (selected === "create") content = <CreateForm apiKey={apiKey} setResult={setResult} />;
+    if (selected === "update") content = <UpdateForm apiKey={apiKey} setResult={setResult} />;
+    if (selected === "delete") content = <DeleteForm apiKey={apiKey} setResult={setResult} />;
+    if (selected === "stats") content = <StatsForm apiKey={apiKey} setResult={setResult} />;
     return (
         <div style={{ display: "flex" }}>
             <Sidebar selected={selected} setSelected={setSelected} />
             <div style={{ marginLeft: 160, padding: 40, width: "100%" }}>
                 <h1 style={{ color: "#333" }}>URL Shortener</h1>
+                <ApiKeyField apiKey={apiKey} setApiKey={setApiKey} />
                 {content}
                 <div style={{ marginTop: 24 }}>{result}</div>
             </div>
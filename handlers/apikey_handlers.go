@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"urlshortner/auth"
+	"urlshortner/database"
+	"urlshortner/models"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+// CreateAPIKey issues a new API key. The secret is only returned in this
+// response; afterwards only its prefix is shown.
+func (h *Handler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		Name   string   `json:"name"`
+		Owner  string   `json:"owner"`
+		Scopes []string `json:"scopes"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		requestLogger(r).WithError(err).Warn("Invalid JSON input for API key")
+		http.Error(w, "invalid input", http.StatusBadRequest)
+		return
+	}
+
+	payload.Name = strings.TrimSpace(payload.Name)
+	if payload.Name == "" || len(payload.Name) > 100 {
+		http.Error(w, "name is required and must be at most 100 characters", http.StatusBadRequest)
+		return
+	}
+	payload.Owner = strings.TrimSpace(payload.Owner)
+	if payload.Owner == "" {
+		payload.Owner = payload.Name
+	}
+	if len(payload.Scopes) == 0 {
+		http.Error(w, "at least one scope is required", http.StatusBadRequest)
+		return
+	}
+	for _, scope := range payload.Scopes {
+		if !auth.ValidScope(scope) {
+			http.Error(w, "unknown scope "+strconv.Quote(scope), http.StatusBadRequest)
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), 5*time.Second)
+	defer cancel()
+
+	key, k, err := IssueAPIKey(ctx, h.store, payload.Name, payload.Owner, payload.Scopes)
+	if err != nil {
+		requestLogger(r).WithError(err).Error("Error creating API key")
+		http.Error(w, "error creating API key", http.StatusInternalServerError)
+		return
+	}
+
+	requestLogger(r).WithFields(logrus.Fields{
+		"key_id": k.ID,
+		"name":   k.Name,
+		"owner":  k.Owner,
+		"scopes": k.Scopes,
+	}).Info("Created API key")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(struct {
+		*models.APIKey
+		Key string `json:"key"`
+	}{k, key})
+}
+
+// IssueAPIKey generates and stores a new key, returning the secret
+func IssueAPIKey(ctx context.Context, store database.Store, name, owner string, scopes []string) (string, *models.APIKey, error) {
+	key, prefix, hash, err := auth.GenerateKey()
+	if err != nil {
+		return "", nil, err
+	}
+
+	k := &models.APIKey{Name: name, Owner: owner, Prefix: prefix, Scopes: scopes}
+	if err := store.CreateAPIKey(ctx, k, hash); err != nil {
+		return "", nil, err
+	}
+	return key, k, nil
+}
+
+func (h *Handler) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), 5*time.Second)
+	defer cancel()
+
+	keys, err := h.store.ListAPIKeys(ctx)
+	if err != nil {
+		requestLogger(r).WithError(err).Error("Error listing API keys")
+		http.Error(w, "error listing API keys", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(keys)
+}
+
+func (h *Handler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "invalid key id", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), 5*time.Second)
+	defer cancel()
+
+	err = h.store.RevokeAPIKey(ctx, id)
+	if errors.Is(err, database.ErrNotFound) {
+		http.Error(w, "API key not found or already revoked", http.StatusNotFound)
+		return
+	} else if err != nil {
+		requestLogger(r).WithError(err).Error("Error revoking API key")
+		http.Error(w, "error revoking API key", http.StatusInternalServerError)
+		return
+	}
+	h.auth.Forget()
+
+	requestLogger(r).WithField("key_id", id).Info("Revoked API key")
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"urlshortner/auth"
+	"urlshortner/models"
+)
+
+func TestAPIKeyLifecycle(t *testing.T) {
+	s := newTestServer(t)
+	admin := s.issueKey("ops", auth.ScopeAdmin)
+
+	rec := s.do("POST", "/admin/keys", admin, `{"name":"ci","owner":"team-a","scopes":["create","manage"]}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create key = %d %s", rec.Code, rec.Body)
+	}
+	var created struct {
+		models.APIKey
+		Key string `json:"key"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+	if created.Owner != "team-a" || created.Key == "" || created.Prefix != created.Key[:len(created.Prefix)] {
+		t.Errorf("created key = %+v", created)
+	}
+
+	// The new key works right away and carries its owner
+	rec = s.do("POST", "/shorten", created.Key, `{"url":"https://example.com/","short_code":"teamlink"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("shorten with the new key = %d %s", rec.Code, rec.Body)
+	}
+
+	rec = s.do("GET", "/admin/keys", admin, "")
+	var keys []map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &keys); err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range keys {
+		if _, leaked := k["key"]; leaked {
+			t.Errorf("key listing exposes a secret: %v", k)
+		}
+	}
+	if len(keys) != 2 {
+		t.Errorf("listed %d keys, want 2", len(keys))
+	}
+
+	path := "/admin/keys/" + strconv.Itoa(created.ID)
+	if rec := s.do("DELETE", path, admin, ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("revoke = %d %s", rec.Code, rec.Body)
+	}
+	// Revocation drops the cached lookup, so the key stops working at once
+	if rec := s.do("POST", "/shorten", created.Key, `{"url":"https://example.com/"}`); rec.Code != http.StatusUnauthorized {
+		t.Errorf("shorten with a revoked key = %d, want 401", rec.Code)
+	}
+	if rec := s.do("DELETE", path, admin, ""); rec.Code != http.StatusNotFound {
+		t.Errorf("second revoke = %d, want 404", rec.Code)
+	}
+}
+
+func TestCreateAPIKeyRejects(t *testing.T) {
+	s := newTestServer(t)
+	admin := s.issueKey("ops", auth.ScopeAdmin)
+	for _, body := range []string{
+		`{"scopes":["create"]}`,
+		`{"name":"ci"}`,
+		`{"name":"ci","scopes":["delete"]}`,
+		`{"name":`,
+	} {
+		if rec := s.do("POST", "/admin/keys", admin, body); rec.Code != http.StatusBadRequest {
+			t.Errorf("create key with %s = %d, want 400", body, rec.Code)
+		}
+	}
+	if rec := s.do("POST", "/admin/keys", s.issueKey("alice", auth.ScopeCreate, auth.ScopeManage), `{"name":"ci","scopes":["admin"]}`); rec.Code != http.StatusForbidden {
+		t.Errorf("key creation by a non-admin = %d, want 403", rec.Code)
+	}
+	if rec := s.do("DELETE", "/admin/keys/abc", admin, ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("revoke with a bad id = %d, want 400", rec.Code)
+	}
+}
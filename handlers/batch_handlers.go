@@ -0,0 +1,268 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"time"
+
+	"urlshortner/database"
+	"urlshortner/models"
+	"urlshortner/monitoring"
+	"urlshortner/policy"
+
+	"github.com/sirupsen/logrus"
+)
+
+// maxBatchBytes caps the body of POST /shorten/batch
+const maxBatchBytes = 16 << 20
+
+// errBatchTooLarge is returned while parsing a batch with too many items
+var errBatchTooLarge = errors.New("batch too large")
+
+// Batch item outcomes
+const (
+	batchCreated    = "created"
+	batchReused     = "reused"
+	batchFailed     = "failed"
+	batchRolledBack = "rolled_back"
+)
+
+// batchResult reports the outcome of one item of a batch, in request order
+type batchResult struct {
+	Index     int        `json:"index"`
+	Status    string     `json:"status"`
+	ShortCode string     `json:"short_code,omitempty"`
+	ShortURL  string     `json:"short_url,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Error     string     `json:"error,omitempty"`
+	// Rule names the policy rule that rejected the destination
+	Rule string `json:"rule,omitempty"`
+}
+
+// CreateShortURLBatch shortens many URLs in one request. The body is a JSON
+// array of POST /shorten payloads, or one payload per line when sent as
+// application/x-ndjson. Every item gets its own result; by default valid
+// items are created even when others fail, while ?mode=atomic creates
+// nothing unless every item succeeds.
+func (h *Handler) CreateShortURLBatch(w http.ResponseWriter, r *http.Request) {
+	atomic := false
+	switch r.URL.Query().Get("mode") {
+	case "", "per_item":
+	case "atomic":
+		atomic = true
+	default:
+		http.Error(w, "mode must be per_item or atomic", http.StatusBadRequest)
+		return
+	}
+
+	items, err := h.readBatch(w, r)
+	if errors.Is(err, errBatchTooLarge) {
+		http.Error(w, fmt.Sprintf("batch may contain at most %d items", h.cfg.BatchMaxSize), http.StatusRequestEntityTooLarge)
+		return
+	} else if err != nil {
+		requestLogger(r).WithError(err).Warn("Invalid batch input")
+		http.Error(w, "invalid input", http.StatusBadRequest)
+		return
+	}
+	if len(items) == 0 {
+		http.Error(w, "batch is empty", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), 30*time.Second)
+	defer cancel()
+
+	results := make([]batchResult, len(items))
+	var links []*models.URL
+	var positions []int
+	// Reusable items share the link of an earlier item with the same destination
+	firstByHash := make(map[string]int)
+	sameAs := make(map[int]int)
+	now := time.Now().UTC()
+	for i, raw := range items {
+		results[i] = batchResult{Index: i}
+
+		var req createRequest
+		if err := json.Unmarshal(raw, &req); err != nil {
+			results[i].Status, results[i].Error = batchFailed, "invalid JSON"
+			continue
+		}
+		u, err := h.prepareLink(r, req, now)
+		if err != nil {
+			results[i].Status, results[i].Error = batchFailed, err.Error()
+			var violation *policy.Violation
+			if errors.As(err, &violation) {
+				results[i].Rule = violation.Rule
+			}
+			continue
+		}
+		if h.reusable(req, &u) {
+			existing, err := h.store.FindReusable(ctx, u.Owner, u.DestHash)
+			if err == nil {
+				results[i].Status = batchReused
+				results[i].ShortCode = existing.ShortCode
+				results[i].ShortURL = h.cfg.BaseURL + "/u/" + existing.ShortCode
+				continue
+			} else if !errors.Is(err, database.ErrNotFound) {
+				requestLogger(r).WithError(err).Error("Error looking up existing URL")
+				http.Error(w, "error inserting URLs", http.StatusInternalServerError)
+				return
+			}
+			if first, ok := firstByHash[u.DestHash]; ok {
+				sameAs[i] = first
+				continue
+			}
+			firstByHash[u.DestHash] = i
+		}
+		links = append(links, &u)
+		positions = append(positions, i)
+	}
+
+	failed := 0
+	for _, res := range results {
+		if res.Status == batchFailed {
+			failed++
+		}
+	}
+	if !atomic || failed == 0 {
+		// Codes are drawn up front so sequence generators reserve numbers
+		// outside the insert transaction
+		for _, u := range links {
+			if u.ShortCode != "" {
+				continue
+			}
+			if u.ShortCode, err = h.codes.Next(ctx, 0); err != nil {
+				requestLogger(r).WithError(err).Error("Error generating short codes")
+				http.Error(w, "error inserting URLs", http.StatusInternalServerError)
+				return
+			}
+			u.GeneratedCode = true
+		}
+		errs, err := h.store.CreateBatch(ctx, links, h.codes, atomic)
+		if err != nil {
+			requestLogger(r).WithError(err).Error("Error inserting URL batch")
+			http.Error(w, "error inserting URLs", http.StatusInternalServerError)
+			return
+		}
+		for j, u := range links {
+			res := &results[positions[j]]
+			res.ShortCode = u.ShortCode
+			if errs[j] != nil {
+				res.Status, res.Error = batchFailed, "short code already exists"
+				if errors.Is(errs[j], database.ErrCodesExhausted) {
+					res.ShortCode, res.Error = "", "no free short code available"
+				}
+				failed++
+				continue
+			}
+			res.Status = batchCreated
+			res.ShortURL = h.cfg.BaseURL + "/u/" + u.ShortCode
+			res.ExpiresAt = u.ExpiresAt
+		}
+		for i, first := range sameAs {
+			results[i] = results[first]
+			results[i].Index = i
+			if results[i].Status == batchCreated {
+				results[i].Status = batchReused
+			} else {
+				failed++
+			}
+		}
+	}
+
+	// An atomic batch keeps nothing once an item failed
+	if atomic && failed > 0 {
+		for i := range results {
+			if results[i].Status != batchFailed {
+				results[i] = batchResult{Index: i, Status: batchRolledBack}
+			}
+		}
+	}
+
+	var created []string
+	for _, res := range results {
+		if res.Status == batchCreated {
+			created = append(created, res.ShortCode)
+		}
+	}
+	h.resolver.Invalidate(created...)
+	modes := make(map[string]int)
+	for j, u := range links {
+		if results[positions[j]].Status == batchCreated {
+			modes[h.creationMode(u)]++
+		}
+	}
+	for mode, n := range modes {
+		monitoring.RecordLinksCreated(mode, n)
+	}
+
+	requestLogger(r).WithFields(logrus.Fields{
+		"items":   len(items),
+		"created": len(created),
+		"failed":  failed,
+		"atomic":  atomic,
+	}).Info("Processed URL batch")
+
+	status := http.StatusOK
+	if atomic && failed > 0 {
+		status = http.StatusUnprocessableEntity
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"created": len(created),
+		"failed":  failed,
+		"results": results,
+	})
+}
+
+// readBatch splits the request body into raw items, either from a JSON array
+// or from newline delimited JSON
+func (h *Handler) readBatch(w http.ResponseWriter, r *http.Request) ([]json.RawMessage, error) {
+	body := http.MaxBytesReader(w, r.Body, maxBatchBytes)
+	var items []json.RawMessage
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "application/x-ndjson" || mediaType == "application/ndjson" {
+		scanner := bufio.NewScanner(body)
+		scanner.Buffer(make([]byte, 64*1024), 1<<20)
+		for scanner.Scan() {
+			line := bytes.TrimSpace(scanner.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+			if len(items) == h.cfg.BatchMaxSize {
+				return nil, errBatchTooLarge
+			}
+			items = append(items, json.RawMessage(append([]byte(nil), line...)))
+		}
+		return items, scanner.Err()
+	}
+
+	dec := json.NewDecoder(body)
+	if tok, err := dec.Token(); err != nil {
+		return nil, err
+	} else if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+		return nil, errors.New("expected a JSON array")
+	}
+	for dec.More() {
+		if len(items) == h.cfg.BatchMaxSize {
+			return nil, errBatchTooLarge
+		}
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return nil, err
+		}
+		items = append(items, raw)
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
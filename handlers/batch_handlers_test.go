@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"urlshortner/auth"
+	"urlshortner/database"
+	"urlshortner/models"
+	"urlshortner/policy"
+)
+
+// batchStatuses returns the status of every result of a batch response
+func batchStatuses(t *testing.T, body map[string]interface{}) []string {
+	t.Helper()
+	results, _ := body["results"].([]interface{})
+	statuses := make([]string, len(results))
+	for i, r := range results {
+		statuses[i], _ = r.(map[string]interface{})["status"].(string)
+	}
+	return statuses
+}
+
+func TestCreateShortURLBatchPerItem(t *testing.T) {
+	s := newTestServer(t)
+	key := s.issueKey("alice", auth.ScopeCreate)
+	if err := s.store.Create(context.Background(), &models.URL{URL: "https://example.com/", ShortCode: "taken"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := s.do("POST", "/shorten/batch", key, `[
+		{"url":"https://a.example/","short_code":"first"},
+		{"url":"https://b.example/","short_code":"taken"},
+		{"url":"not a url"},
+		{"url":"http://127.0.0.1/"},
+		{"url":"https://c.example/"}
+	]`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("batch = %d %s", rec.Code, rec.Body)
+	}
+	body := decode(t, rec)
+	want := []string{batchCreated, batchFailed, batchFailed, batchFailed, batchCreated}
+	if got := batchStatuses(t, body); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("statuses = %v, want %v", got, want)
+	}
+	if body["created"] != float64(2) || body["failed"] != float64(3) {
+		t.Errorf("created %v failed %v, want 2 and 3", body["created"], body["failed"])
+	}
+	results := body["results"].([]interface{})
+	if rule := results[3].(map[string]interface{})["rule"]; rule != policy.RulePrivateAddress {
+		t.Errorf("policy failure rule = %v", rule)
+	}
+	if u, err := s.store.GetByCode(context.Background(), "first"); err != nil || u.Owner != "alice" {
+		t.Errorf("created link = %+v, %v", u, err)
+	}
+}
+
+func TestCreateShortURLBatchAtomic(t *testing.T) {
+	s := newTestServer(t)
+	key := s.issueKey("alice", auth.ScopeCreate)
+	if err := s.store.Create(context.Background(), &models.URL{URL: "https://example.com/", ShortCode: "taken"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Newline delimited input is accepted as well as a JSON array
+	req := httptest.NewRequest("POST", "/shorten/batch?mode=atomic", strings.NewReader(
+		"{\"url\":\"https://a.example/\",\"short_code\":\"first\"}\n\n{\"url\":\"https://b.example/\",\"short_code\":\"taken\"}\n"))
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	req.Header.Set("Authorization", "Bearer "+key)
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("atomic batch with a conflict = %d %s", rec.Code, rec.Body)
+	}
+	want := []string{batchRolledBack, batchFailed}
+	if got := batchStatuses(t, decode(t, rec)); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("statuses = %v, want %v", got, want)
+	}
+	if _, err := s.store.GetByCode(context.Background(), "first"); !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("atomic batch kept a link: %v", err)
+	}
+
+	rec = s.do("POST", "/shorten/batch?mode=atomic", key, `[{"url":"https://a.example/"},{"url":"https://b.example/"}]`)
+	if rec.Code != http.StatusOK || decode(t, rec)["created"] != float64(2) {
+		t.Errorf("clean atomic batch = %d %s", rec.Code, rec.Body)
+	}
+}
+
+func TestCreateShortURLBatchRejects(t *testing.T) {
+	s := newTestServer(t)
+	key := s.issueKey("alice", auth.ScopeCreate)
+	six := "[" + strings.Repeat(`{"url":"https://a.example/"},`, 5) + `{"url":"https://a.example/"}]`
+
+	tests := []struct {
+		name string
+		path string
+		body string
+		want int
+	}{
+		{"too many items", "/shorten/batch", six, http.StatusRequestEntityTooLarge},
+		{"empty", "/shorten/batch", `[]`, http.StatusBadRequest},
+		{"broken json", "/shorten/batch", `[{"url":`, http.StatusBadRequest},
+		{"unknown mode", "/shorten/batch?mode=all_or_nothing", `[{"url":"https://a.example/"}]`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if rec := s.do("POST", tt.path, key, tt.body); rec.Code != tt.want {
+			t.Errorf("%s: batch = %d %s, want %d", tt.name, rec.Code, rec.Body, tt.want)
+		}
+	}
+}
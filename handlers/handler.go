@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync/atomic"
+
+	"urlshortner/auth"
+	"urlshortner/cache"
+	"urlshortner/config"
+	"urlshortner/database"
+	"urlshortner/health"
+	"urlshortner/models"
+	"urlshortner/policy"
+	"urlshortner/threat"
+	"urlshortner/tracking"
+	"urlshortner/urlnorm"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Deps are the collaborators a Handler is built from
+type Deps struct {
+	Store      database.Store
+	Resolver   *cache.Resolver
+	Tracker    *tracking.Aggregator
+	Auth       *auth.Authenticator
+	Normalizer *urlnorm.Normalizer
+	Policy     *policy.Engine
+	Threats    *threat.Feed
+	Codes      database.CodeAllocator
+	Health     *health.Checker
+	Config     *config.Config
+}
+
+// Handler serves the URL shortener API on top of an injected Store
+type Handler struct {
+	store      database.Store
+	resolver   *cache.Resolver
+	tracker    *tracking.Aggregator
+	auth       *auth.Authenticator
+	normalizer *urlnorm.Normalizer
+	policy     *policy.Engine
+	threats    *threat.Feed
+	codes      database.CodeAllocator
+	health     *health.Checker
+	cfg        *config.Config
+
+	// draining is set once shutdown starts so health checks fail
+	draining atomic.Bool
+}
+
+// New creates a Handler from its dependencies
+func New(d Deps) *Handler {
+	return &Handler{
+		store:      d.Store,
+		resolver:   d.Resolver,
+		tracker:    d.Tracker,
+		auth:       d.Auth,
+		normalizer: d.Normalizer,
+		policy:     d.Policy,
+		threats:    d.Threats,
+		codes:      d.Codes,
+		health:     d.Health,
+		cfg:        d.Config,
+	}
+}
+
+// StartDraining makes health checks report the instance as going away
+func (h *Handler) StartDraining() {
+	h.draining.Store(true)
+}
+
+// loadOwnedLink fetches the link for code and checks that the caller owns it
+// or is an admin. On failure it writes the error response and returns nil.
+func (h *Handler) loadOwnedLink(ctx context.Context, w http.ResponseWriter, r *http.Request, code string) *models.URL {
+	u, err := h.store.GetByCode(ctx, code)
+	if errors.Is(err, database.ErrNotFound) {
+		requestLogger(r).WithField("short_code", code).Warn("Short code not found")
+		http.Error(w, "Short code not found", http.StatusNotFound)
+		return nil
+	} else if err != nil {
+		requestLogger(r).WithError(err).Error("Database error fetching short code")
+		http.Error(w, "Error fetching URL", http.StatusInternalServerError)
+		return nil
+	}
+
+	p, ok := auth.FromContext(r.Context())
+	if !ok || !p.CanAccess(u.Owner) {
+		fields := logrus.Fields{"short_code": code}
+		if ok {
+			fields["key_id"] = p.KeyID
+		}
+		requestLogger(r).WithFields(fields).Warn("Caller does not own short code")
+		http.Error(w, "you do not own this short code", http.StatusForbidden)
+		return nil
+	}
+	return u
+}
+
+// writeViolation answers with 422 and the policy rule that rejected the
+// destination
+func writeViolation(w http.ResponseWriter, v *policy.Violation) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error": v.Error(),
+		"rule":  v.Rule,
+	})
+}
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"urlshortner/buildinfo"
+	"urlshortner/health"
+
+	"github.com/sirupsen/logrus"
+)
+
+// HealthCheck endpoint for monitoring
+func (h *Handler) HealthCheck(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Fail while shutting down so load balancers stop sending traffic
+	if h.draining.Load() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]string{
+			"status": "draining",
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), 5*time.Second)
+	defer cancel()
+
+	// Check database connectivity
+	if err := h.store.Ping(ctx); err != nil {
+		requestLogger(r).WithError(err).Error("Health check failed - database unreachable")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]string{
+			"status": "unhealthy",
+			"error":  "database unreachable",
+		})
+		return
+	}
+
+	build := buildinfo.Get()
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":      "healthy",
+		"timestamp":   time.Now().UTC(),
+		"version":     build.Version,
+		"commit":      build.Commit,
+		"environment": h.cfg.Environment,
+	})
+}
+
+// Livez reports that the process is up and serving. It never touches
+// dependencies, so a slow database does not get the process restarted.
+func (h *Handler) Livez(w http.ResponseWriter, r *http.Request) {
+	resp := map[string]interface{}{"status": "alive"}
+	if verbose(r) {
+		resp["build"] = buildinfo.Get()
+		resp["timestamp"] = time.Now().UTC()
+	}
+	writeProbe(w, http.StatusOK, resp)
+}
+
+// Readyz reports whether this instance should receive traffic: not shutting
+// down, database reachable with every migration applied, and Redis reachable
+// if configured. ?verbose=1 adds latency, errors and build info per check.
+func (h *Handler) Readyz(w http.ResponseWriter, r *http.Request) {
+	shutdown := health.Result{Name: "shutdown", Status: health.StatusOK, Critical: true}
+	if h.draining.Load() {
+		shutdown.Status = health.StatusFailing
+		shutdown.Error = "draining"
+	}
+
+	ready, results := h.health.Run(r.Context())
+	results = append([]health.Result{shutdown}, results...)
+	ready = ready && shutdown.Status == health.StatusOK
+
+	status, code := "ready", http.StatusOK
+	if !ready {
+		status, code = "not_ready", http.StatusServiceUnavailable
+	}
+	for _, result := range results {
+		if result.Status != health.StatusOK && result.Name != "shutdown" {
+			requestLogger(r).WithFields(logrus.Fields{"check": result.Name, "error": result.Error}).Warn("Readiness check failed")
+		}
+	}
+
+	resp := map[string]interface{}{"status": status}
+	if verbose(r) {
+		resp["checks"] = results
+		resp["build"] = buildinfo.Get()
+		resp["environment"] = h.cfg.Environment
+		resp["timestamp"] = time.Now().UTC()
+	} else {
+		checks := make(map[string]string, len(results))
+		for _, result := range results {
+			checks[result.Name] = result.Status
+		}
+		resp["checks"] = checks
+	}
+	writeProbe(w, code, resp)
+}
+
+func verbose(r *http.Request) bool {
+	v, _ := strconv.ParseBool(r.URL.Query().Get("verbose"))
+	return v
+}
+
+func writeProbe(w http.ResponseWriter, code int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(body)
+}
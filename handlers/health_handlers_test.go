@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"urlshortner/config"
+	"urlshortner/database"
+	"urlshortner/health"
+)
+
+func probe(t *testing.T, handler http.HandlerFunc, path string) (int, map[string]interface{}) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest("GET", path, nil))
+	if rec.Header().Get("Cache-Control") != "no-store" {
+		t.Errorf("%s: probe response may be cached", path)
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("%s: %q: %v", path, rec.Body, err)
+	}
+	return rec.Code, body
+}
+
+func TestProbes(t *testing.T) {
+	var dbErr error
+	checker := health.NewChecker(time.Second)
+	checker.Add("database", true, func(ctx context.Context) error { return dbErr })
+	h := New(Deps{Store: database.NewMemoryStore(), Health: checker, Config: &config.Config{}})
+
+	if code, body := probe(t, h.Readyz, "/readyz"); code != http.StatusOK || body["status"] != "ready" {
+		t.Errorf("readyz = %d %v", code, body)
+	}
+
+	dbErr = errors.New("connection refused")
+	code, body := probe(t, h.Readyz, "/readyz?verbose=1")
+	if code != http.StatusServiceUnavailable || body["status"] != "not_ready" {
+		t.Errorf("readyz with the database down = %d %v", code, body)
+	}
+	if checks, _ := body["checks"].([]interface{}); len(checks) != 2 {
+		t.Errorf("verbose checks = %v, want shutdown and database", body["checks"])
+	}
+	// Liveness must not depend on the database
+	if code, _ := probe(t, h.Livez, "/livez"); code != http.StatusOK {
+		t.Errorf("livez with the database down = %d", code)
+	}
+
+	dbErr = nil
+	h.StartDraining()
+	code, body = probe(t, h.Readyz, "/readyz")
+	if checks, _ := body["checks"].(map[string]interface{}); code != http.StatusServiceUnavailable || checks["shutdown"] != health.StatusFailing {
+		t.Errorf("readyz while draining = %d %v", code, body)
+	}
+	if code, _ := probe(t, h.Livez, "/livez"); code != http.StatusOK {
+		t.Errorf("livez while draining = %d", code)
+	}
+}
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"html/template"
+	"net/http"
+
+	"urlshortner/models"
+)
+
+var interstitialTemplate = template.Must(template.New("interstitial").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="robots" content="noindex">
+<title>Warning: link disabled</title>
+<style>
+body { font-family: sans-serif; background: #b3261e; color: #fff; margin: 0; }
+main { max-width: 40em; margin: 10vh auto; padding: 0 1em; }
+code { background: rgba(0,0,0,.25); padding: .2em .4em; word-break: break-all; }
+</style>
+</head>
+<body>
+<main>
+<h1>This link has been disabled</h1>
+<p>The short link <code>{{.ShortCode}}</code> points to a site reported as phishing or malware, so it no longer redirects.</p>
+<p>Destination: <code>{{.URL}}</code></p>
+<p>If you trust this site you can copy the address, but we recommend that you do not visit it.</p>
+</main>
+</body>
+</html>
+`))
+
+// serveInterstitial answers a disabled link with a warning page instead of
+// redirecting. The destination is shown as text, never as a link.
+func serveInterstitial(w http.ResponseWriter, u *models.URL) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusForbidden)
+	if err := interstitialTemplate.Execute(w, u); err != nil {
+		logger.WithError(err).Error("Error rendering interstitial page")
+	}
+}
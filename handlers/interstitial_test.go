@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"urlshortner/auth"
+	"urlshortner/models"
+	"urlshortner/threat"
+)
+
+func TestDisabledLinksShowInterstitial(t *testing.T) {
+	s := newTestServer(t)
+	ctx := context.Background()
+	for _, u := range []*models.URL{
+		{URL: "https://phish.example/login?next=<b>", ShortCode: "bad"},
+		{URL: "https://maybe.example/", ShortCode: "flagged"},
+	} {
+		if err := s.store.Create(ctx, u, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.store.SetThreatStatus(ctx, "bad", "https://phish.example/login?next=<b>", models.ThreatDisabled, "host phish.example"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.store.SetThreatStatus(ctx, "flagged", "https://maybe.example/", models.ThreatFlagged, "host maybe.example"); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := s.do("GET", "/u/bad", "", "")
+	if rec.Code != http.StatusForbidden || rec.Header().Get("Location") != "" {
+		t.Fatalf("disabled link = %d to %q, want a 403 page", rec.Code, rec.Header().Get("Location"))
+	}
+	body := rec.Body.String()
+	if !strings.Contains(body, "This link has been disabled") || strings.Contains(body, "<b>") || strings.Contains(body, "href=") {
+		t.Errorf("interstitial must show the escaped destination as text:\n%s", body)
+	}
+
+	// Flagged links keep working until an operator disables them
+	if rec := s.do("GET", "/u/flagged", "", ""); rec.Code != http.StatusFound {
+		t.Errorf("flagged link = %d, want a redirect", rec.Code)
+	}
+}
+
+func TestCreateRejectsListedDestinations(t *testing.T) {
+	s := newTestServer(t)
+	file := filepath.Join(t.TempDir(), "feed.txt")
+	if err := os.WriteFile(file, []byte("host phish.example\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s.h.threats = threat.NewFeed([]string{file}, 0)
+	if err := s.h.threats.Load(); err != nil {
+		t.Fatal(err)
+	}
+	key := s.issueKey("alice", auth.ScopeCreate, auth.ScopeManage)
+
+	rec := s.do("POST", "/shorten", key, `{"url":"https://login.phish.example/"}`)
+	if rec.Code != http.StatusUnprocessableEntity || decode(t, rec)["rule"] != threat.RuleFeed {
+		t.Errorf("listed destination = %d %s, want a %s violation", rec.Code, rec.Body, threat.RuleFeed)
+	}
+
+	if err := s.store.Create(context.Background(), &models.URL{URL: "https://example.com/", ShortCode: "abc", Owner: "alice"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if rec := s.do("PATCH", "/u/abc", key, `{"url":"https://phish.example/"}`); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("retarget to a listed destination = %d, want 422", rec.Code)
+	}
+}
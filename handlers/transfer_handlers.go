@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"time"
+
+	"urlshortner/database"
+	"urlshortner/monitoring"
+	"urlshortner/transfer"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ExportURLs streams every link as CSV or, with ?format=jsonl, as one JSON
+// object per line
+func (h *Handler) ExportURLs(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = transfer.FormatCSV
+	}
+	if !transfer.ValidFormat(format) {
+		http.Error(w, "format must be csv or jsonl", http.StatusBadRequest)
+		return
+	}
+
+	contentType := "text/csv; charset=utf-8"
+	if format == transfer.FormatJSONL {
+		contentType = "application/x-ndjson"
+	}
+	// Large exports outlast the server write timeout
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="urls-`+time.Now().UTC().Format("20060102")+`.`+format+`"`)
+
+	// Headers are already sent once rows stream, so failures can only be logged
+	count, err := transfer.Export(r.Context(), h.store, w, format)
+	if err != nil {
+		requestLogger(r).WithError(err).WithField("rows", count).Error("Export failed")
+		return
+	}
+	requestLogger(r).WithFields(logrus.Fields{"format": format, "rows": count}).Info("Exported links")
+}
+
+// ImportURLs loads links from a CSV or JSONL body (?format, or inferred from
+// the Content-Type). Taken short codes are handled by ?on_conflict=skip
+// (default), overwrite or fail. Destinations are normalized and checked like
+// those of new links. The response summarises imported, skipped and
+// rejected rows.
+func (h *Handler) ImportURLs(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	format := query.Get("format")
+	if format == "" {
+		switch mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType {
+		case "text/csv":
+			format = transfer.FormatCSV
+		case "application/x-ndjson", "application/ndjson":
+			format = transfer.FormatJSONL
+		}
+	}
+	if !transfer.ValidFormat(format) {
+		http.Error(w, "format must be csv or jsonl", http.StatusBadRequest)
+		return
+	}
+
+	onConflict := query.Get("on_conflict")
+	if onConflict == "" {
+		onConflict = database.ConflictSkip
+	}
+	if !transfer.ValidConflictPolicy(onConflict) {
+		http.Error(w, "on_conflict must be skip, overwrite or fail", http.StatusBadRequest)
+		return
+	}
+
+	// Large imports outlast the server read and write timeouts
+	rc := http.NewResponseController(w)
+	rc.SetReadDeadline(time.Time{})
+	rc.SetWriteDeadline(time.Time{})
+
+	checks := transfer.Checks{Normalizer: h.normalizer, Policy: h.policy, Threats: h.threats}
+	summary, err := transfer.Import(r.Context(), h.store, r.Body, format, onConflict, checks, h.resolver.Invalidate)
+	monitoring.RecordLinksCreated("import", summary.Imported)
+
+	fields := logrus.Fields{
+		"format":   format,
+		"imported": summary.Imported,
+		"skipped":  summary.Skipped,
+		"rejected": summary.Rejected,
+		"aborted":  summary.Aborted,
+	}
+	status := http.StatusOK
+	resp := map[string]interface{}{"summary": summary}
+	var inputErr *transfer.InputError
+	switch {
+	case errors.As(err, &inputErr):
+		// Batches written before the bad input stay imported
+		requestLogger(r).WithError(err).WithFields(fields).Warn("Import stopped on invalid input")
+		status = http.StatusBadRequest
+		resp["error"] = err.Error()
+	case err != nil:
+		requestLogger(r).WithError(err).WithFields(fields).Error("Import failed")
+		status = http.StatusInternalServerError
+		resp["error"] = "error importing URLs"
+	case summary.Aborted:
+		requestLogger(r).WithFields(fields).Warn("Import aborted on conflicting short code")
+		status = http.StatusConflict
+	default:
+		requestLogger(r).WithFields(fields).Info("Imported links")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
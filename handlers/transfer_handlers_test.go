@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"urlshortner/auth"
+	"urlshortner/models"
+)
+
+// importBody posts body to /admin/import with the given content type
+func (s *testServer) importBody(path, key, contentType, body string) *httptest.ResponseRecorder {
+	s.t.Helper()
+	req := httptest.NewRequest("POST", path, strings.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Authorization", "Bearer "+key)
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestExportImportOverHTTP(t *testing.T) {
+	src := newTestServer(t)
+	ctx := context.Background()
+	for _, u := range []*models.URL{
+		{URL: "https://a.example/", ShortCode: "aaa", Owner: "alice"},
+		{URL: "https://b.example/", ShortCode: "bbb"},
+	} {
+		if err := src.store.Create(ctx, u, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rec := src.do("GET", "/admin/export", src.issueKey("ops", auth.ScopeAdmin), "")
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/csv") {
+		t.Fatalf("export = %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(rec.Header().Get("Content-Disposition"), ".csv") {
+		t.Errorf("export is not offered as a CSV download: %q", rec.Header().Get("Content-Disposition"))
+	}
+	export := rec.Body.String()
+
+	dst := newTestServer(t)
+	admin := dst.issueKey("ops", auth.ScopeAdmin)
+	if err := dst.store.Create(ctx, &models.URL{URL: "https://old.example/", ShortCode: "bbb"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	// Cache the old destination so the import has to invalidate it
+	dst.do("GET", "/u/bbb", "", "")
+
+	rec = dst.importBody("/admin/import?on_conflict=fail", admin, "text/csv", export)
+	if rec.Code != http.StatusConflict {
+		t.Errorf("import onto a taken code with on_conflict=fail = %d %s", rec.Code, rec.Body)
+	}
+
+	rec = dst.importBody("/admin/import?on_conflict=overwrite", admin, "text/csv", export)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("import = %d %s", rec.Code, rec.Body)
+	}
+	if summary := decode(t, rec)["summary"].(map[string]interface{}); summary["imported"] != float64(2) {
+		t.Errorf("summary = %v, want 2 imported", summary)
+	}
+	if rec := dst.do("GET", "/u/bbb", "", ""); rec.Header().Get("Location") != "https://b.example/" {
+		t.Errorf("overwritten link redirects to %q", rec.Header().Get("Location"))
+	}
+	if u, err := dst.store.GetByCode(ctx, "aaa"); err != nil || u.Owner != "alice" {
+		t.Errorf("imported link = %+v, %v", u, err)
+	}
+}
+
+func TestImportRejects(t *testing.T) {
+	s := newTestServer(t)
+	admin := s.issueKey("ops", auth.ScopeAdmin)
+
+	tests := []struct {
+		name        string
+		path        string
+		contentType string
+		body        string
+		want        int
+	}{
+		{"unknown format", "/admin/import", "application/xml", "<urls/>", http.StatusBadRequest},
+		{"unknown conflict policy", "/admin/import?on_conflict=merge", "text/csv", "short_code,url\n", http.StatusBadRequest},
+		{"broken jsonl", "/admin/import", "application/x-ndjson", "{broken\n", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if rec := s.importBody(tt.path, admin, tt.contentType, tt.body); rec.Code != tt.want {
+			t.Errorf("%s: import = %d %s, want %d", tt.name, rec.Code, rec.Body, tt.want)
+		}
+	}
+	if rec := s.importBody("/admin/import", s.issueKey("alice", auth.ScopeCreate), "text/csv", "short_code,url\n"); rec.Code != http.StatusForbidden {
+		t.Errorf("import by a non-admin = %d, want 403", rec.Code)
+	}
+	if rec := s.do("GET", "/admin/export?format=xml", admin, ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("export in an unknown format = %d, want 400", rec.Code)
+	}
+}
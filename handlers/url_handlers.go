@@ -2,159 +2,298 @@ package handlers
 
 import (
 	"context"
-	"database/sql"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
-	"urlshortner/config"
+	"urlshortner/analytics"
+	"urlshortner/auth"
 	"urlshortner/database"
+	"urlshortner/expiry"
+	"urlshortner/logging"
+	"urlshortner/middleware"
 	"urlshortner/models"
+	"urlshortner/monitoring"
+	"urlshortner/policy"
+	"urlshortner/threat"
 	"urlshortner/utils"
 
 	"github.com/gorilla/mux"
-	"github.com/lib/pq"
-	"github.com/mattn/go-sqlite3"
 	"github.com/sirupsen/logrus"
 )
 
-var logger = logrus.New()
-var cfg *config.Config
+var logger = logging.Component("handlers")
 
-func init() {
-	logger.SetFormatter(&logrus.JSONFormatter{})
-	logger.SetLevel(logrus.InfoLevel)
-	cfg = config.Load()
+// requestLogger returns the logger of the request, carrying its request ID,
+// route, principal and trace
+func requestLogger(r *http.Request) *logrus.Entry {
+	return logging.FromContext(r.Context())
 }
 
-func CreateShortURL(w http.ResponseWriter, r *http.Request) {
-	var u models.URL
-	if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
-		logger.WithError(err).Warn("Invalid JSON input")
+const maxTitleLength = 200
+
+// createRequest is the body of POST /shorten and of each POST /shorten/batch item
+type createRequest struct {
+	models.URL
+	TTLSeconds int64 `json:"ttl_seconds"`
+	// ReuseExisting overrides the REUSE_EXISTING server default
+	ReuseExisting *bool `json:"reuse_existing"`
+}
+
+// reusable reports whether the link built from req may be answered with an
+// existing link of the same destination: only links with a generated code
+// and no expiry are shared
+func (h *Handler) reusable(req createRequest, u *models.URL) bool {
+	reuse := h.cfg.ReuseExisting
+	if req.ReuseExisting != nil {
+		reuse = *req.ReuseExisting
+	}
+	return reuse && u.ShortCode == "" && u.ExpiresAt == nil
+}
+
+// checkDestination returns a *policy.Violation when the normalized dest is
+// refused by the destination policy or listed on the threat feed
+func (h *Handler) checkDestination(dest string) error {
+	if err := h.policy.Check(dest); err != nil {
+		logger.WithError(err).WithField("url", dest).Warn("Destination rejected by policy")
+		return err
+	}
+	if m := h.threats.Check(dest); m != nil {
+		logger.WithFields(logrus.Fields{"url": dest, "match": m.String()}).Warn("Destination is on threat feed")
+		// The matching entry stays in the log rather than helping evade it
+		return &policy.Violation{Rule: threat.RuleFeed, Reason: "destination is listed as malicious"}
+	}
+	return nil
+}
+
+// prepareLink validates a create request and fills in the fields the server
+// controls. The error message is meant for the client; destinations refused
+// by the policy come back as a *policy.Violation.
+func (h *Handler) prepareLink(r *http.Request, req createRequest, now time.Time) (models.URL, error) {
+	u := req.URL
+
+	// Resolve link lifetime, either absolute or relative to now
+	if req.TTLSeconds != 0 && u.ExpiresAt != nil {
+		return u, errors.New("specify either expires_at or ttl_seconds, not both")
+	}
+	if req.TTLSeconds < 0 {
+		return u, errors.New("ttl_seconds must be positive")
+	}
+	if req.TTLSeconds > 0 {
+		expiresAt := now.Add(time.Duration(req.TTLSeconds) * time.Second)
+		u.ExpiresAt = &expiresAt
+	} else if u.ExpiresAt != nil {
+		if !u.ExpiresAt.After(now) {
+			return u, errors.New("expires_at must be in the future")
+		}
+		expiresAt := u.ExpiresAt.UTC()
+		u.ExpiresAt = &expiresAt
+	}
+
+	u.Title = strings.TrimSpace(u.Title)
+	if len(u.Title) > maxTitleLength {
+		return u, errors.New("title must be at most 200 characters")
+	}
+
+	// Links belong to the caller; anonymous links go to the default owner
+	u.Owner = h.cfg.DefaultOwner
+	if p, ok := auth.FromContext(r.Context()); ok {
+		u.Owner = p.Owner
+	}
+
+	// Normalize and validate URL
+	normalized, err := h.normalizer.Normalize(u.URL)
+	if err != nil || !utils.IsValidURL(normalized) {
+		requestLogger(r).WithField("url", u.URL).Warn("Invalid URL provided")
+		return u, errors.New("invalid URL format")
+	}
+	u.URL = normalized
+	if err := h.checkDestination(u.URL); err != nil {
+		return u, err
+	}
+	u.DestHash = utils.URLHash(u.URL)
+	u.ThreatStatus, u.ThreatMatch = "", ""
+
+	// Validate custom short code
+	if u.ShortCode != "" && !utils.IsValidShortCode(u.ShortCode) {
+		requestLogger(r).WithField("short_code", u.ShortCode).Warn("Invalid short code format")
+		return u, errors.New("invalid short code format")
+	}
+	return u, nil
+}
+
+func (h *Handler) CreateShortURL(w http.ResponseWriter, r *http.Request) {
+	var req createRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		requestLogger(r).WithError(err).Warn("Invalid JSON input")
 		http.Error(w, "invalid input", http.StatusBadRequest)
 		return
 	}
 
-	// Sanitize and validate URL
-	u.URL = utils.SanitizeURL(u.URL)
-	if !utils.IsValidURL(u.URL) {
-		logger.WithField("url", u.URL).Warn("Invalid URL provided")
-		http.Error(w, "invalid URL format", http.StatusBadRequest)
+	u, err := h.prepareLink(r, req, time.Now().UTC())
+	var violation *policy.Violation
+	if errors.As(err, &violation) {
+		writeViolation(w, violation)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	logger.WithFields(logrus.Fields{
+	requestLogger(r).WithFields(logrus.Fields{
 		"url":        u.URL,
 		"short_code": u.ShortCode,
 	}).Info("Received CreateShortURL request")
 
-	if u.ShortCode == "" {
-		u.ShortCode = utils.GenerateUniqueCode(6)
-		logger.WithField("short_code", u.ShortCode).Info("Generated new short code")
-	} else {
-		// Validate custom short code
-		if !utils.IsValidShortCode(u.ShortCode) {
-			logger.WithField("short_code", u.ShortCode).Warn("Invalid short code format")
-			http.Error(w, "invalid short code format", http.StatusBadRequest)
-			return
-		}
-
-		var exists bool
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), 5*time.Second)
+	defer cancel()
 
-		err := database.DB.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM urls WHERE short_code = $1)", u.ShortCode).Scan(&exists)
-		if err != nil {
-			logger.WithError(err).Error("Database error checking short code existence")
-			http.Error(w, "database error", http.StatusInternalServerError)
+	if h.reusable(req, &u) {
+		existing, err := h.store.FindReusable(ctx, u.Owner, u.DestHash)
+		if err == nil {
+			requestLogger(r).WithField("short_code", existing.ShortCode).Info("Reusing existing short URL")
+			h.writeCreated(w, http.StatusOK, existing, true)
 			return
-		}
-		if exists {
-			logger.WithField("short_code", u.ShortCode).Warn("Short code already exists")
-			http.Error(w, "short code already exists", http.StatusConflict)
+		} else if !errors.Is(err, database.ErrNotFound) {
+			requestLogger(r).WithError(err).Error("Error looking up existing URL")
+			http.Error(w, "error inserting URL", http.StatusInternalServerError)
 			return
 		}
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	stmt := `INSERT INTO urls (url, short_code) VALUES ($1, $2)`
-	_, err := database.DB.ExecContext(ctx, stmt, u.URL, u.ShortCode)
-	if err != nil {
-		// Handle PostgreSQL constraint violations
-		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+	// Links without a custom code get a generated one from the store
+	if err := h.store.Create(ctx, &u, h.codes); err != nil {
+		if errors.Is(err, database.ErrConflict) {
+			requestLogger(r).WithField("short_code", u.ShortCode).Warn("Short code already exists")
 			http.Error(w, "short code already exists", http.StatusConflict)
 			return
 		}
-		// Handle SQLite constraint violations
-		if sqliteErr, ok := err.(sqlite3.Error); ok && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
-			http.Error(w, "short code already exists", http.StatusConflict)
+		if errors.Is(err, database.ErrCodesExhausted) {
+			requestLogger(r).WithError(err).Error("No free short code")
+			http.Error(w, "no free short code available, try again or choose a custom code", http.StatusServiceUnavailable)
 			return
 		}
 
-		logger.WithError(err).Error("Error inserting URL")
+		requestLogger(r).WithError(err).Error("Error inserting URL")
 		http.Error(w, "error inserting URL", http.StatusInternalServerError)
 		return
 	}
+	h.resolver.Invalidate(u.ShortCode)
+	monitoring.RecordLinksCreated(h.creationMode(&u), 1)
 
-	logger.WithFields(logrus.Fields{
+	requestLogger(r).WithFields(logrus.Fields{
 		"short_code": u.ShortCode,
+		"generated":  u.GeneratedCode,
 		"url":        u.URL,
 	}).Info("Successfully created short URL")
 
+	h.writeCreated(w, http.StatusCreated, &u, false)
+}
+
+// creationMode labels a new link for the links created metric: the
+// generator strategy for generated codes, otherwise custom
+func (h *Handler) creationMode(u *models.URL) string {
+	if u.GeneratedCode {
+		return h.cfg.CodeGenerator
+	}
+	return "custom"
+}
+
+// writeCreated answers a create request with the link's short URL
+func (h *Handler) writeCreated(w http.ResponseWriter, status int, u *models.URL, reused bool) {
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
+	w.WriteHeader(status)
 
-	resp := map[string]string{
+	resp := map[string]interface{}{
 		"short_code": u.ShortCode,
-		"short_url":  cfg.BaseURL + "/u/" + u.ShortCode,
+		"short_url":  h.cfg.BaseURL + "/u/" + u.ShortCode,
+	}
+	if u.ExpiresAt != nil {
+		resp["expires_at"] = u.ExpiresAt
+	}
+	if reused {
+		resp["reused"] = true
 	}
 	json.NewEncoder(w).Encode(resp)
 }
 
-func GetOriginalURL(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) GetOriginalURL(w http.ResponseWriter, r *http.Request) {
 	shortCode := mux.Vars(r)["code"]
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), 5*time.Second)
 	defer cancel()
 
-	row := database.DB.QueryRowContext(ctx, `SELECT url, access_count FROM urls WHERE short_code = $1`, shortCode)
-
-	var url string
-	var count int
-	err := row.Scan(&url, &count)
-
-	if err == sql.ErrNoRows {
-		logger.WithField("short_code", shortCode).Warn("Short code not found")
+	u, err := h.resolver.Resolve(ctx, shortCode)
+	if errors.Is(err, database.ErrNotFound) {
+		// The sweeper may have archived the link since it expired
+		if h.cfg.ExpiryMode == expiry.ModeArchive {
+			archived, aerr := h.store.IsArchived(ctx, shortCode)
+			if aerr != nil {
+				requestLogger(r).WithError(aerr).Warn("Error checking for an archived link")
+			} else if archived {
+				monitoring.RecordRedirect(monitoring.RedirectExpired)
+				requestLogger(r).WithField("short_code", shortCode).Info("Short code has expired")
+				http.Error(w, "short URL has expired", http.StatusGone)
+				return
+			}
+		}
+		monitoring.RecordRedirect(monitoring.RedirectMiss)
+		requestLogger(r).WithField("short_code", shortCode).Warn("Short code not found")
 		http.NotFound(w, r)
 		return
 	} else if err != nil {
-		logger.WithError(err).Error("Error fetching URL")
+		monitoring.RecordRedirect(monitoring.RedirectError)
+		requestLogger(r).WithError(err).Error("Error fetching URL")
 		http.Error(w, "Error fetching URL", http.StatusInternalServerError)
 		return
 	}
 
-	// Update access count asynchronously
-	go func() {
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-		_, err := database.DB.ExecContext(ctx, `UPDATE urls SET access_count = access_count + 1, updated_at = CURRENT_TIMESTAMP WHERE short_code = $1`, shortCode)
-		if err != nil {
-			logger.WithError(err).Error("Failed to update access count")
-		}
-	}()
+	if u.IsExpired(time.Now()) {
+		monitoring.RecordRedirect(monitoring.RedirectExpired)
+		requestLogger(r).WithField("short_code", shortCode).Info("Short code has expired")
+		http.Error(w, "short URL has expired", http.StatusGone)
+		return
+	}
+
+	if u.ThreatStatus == models.ThreatDisabled {
+		monitoring.RecordRedirect(monitoring.RedirectBlocked)
+		requestLogger(r).WithFields(logrus.Fields{"short_code": shortCode, "match": u.ThreatMatch}).Warn("Blocked redirect to listed destination")
+		serveInterstitial(w, u)
+		return
+	}
+	monitoring.RecordRedirect(monitoring.RedirectHit)
 
-	logger.WithFields(logrus.Fields{
-		"short_code":   shortCode,
-		"redirect_url": url,
-		"access_count": count + 1,
-	}).Info("Redirecting user")
+	// Access count and click event are written in the next batch flush
+	h.tracker.Record(shortCode, analytics.NewClickEvent(r, u.ID, middleware.ClientIP(r)))
 
-	http.Redirect(w, r, url, http.StatusFound)
+	// Redirects are the bulk of the traffic, so their logs may be sampled
+	if ok, dropped := logging.SampleRedirect(); ok {
+		fields := logrus.Fields{
+			"short_code":   shortCode,
+			"redirect_url": u.URL,
+			"access_count": u.AccessCount + 1,
+		}
+		if dropped > 0 {
+			fields["sampled_out"] = dropped
+		}
+		requestLogger(r).WithFields(fields).Info("Redirecting user")
+	} else {
+		logging.Suppress(r.Context())
+	}
+
+	http.Redirect(w, r, u.URL, http.StatusFound)
 }
 
-func UpdateShortCode(w http.ResponseWriter, r *http.Request) {
+// UpdateShortURL changes the link at /u/{code}: an optional "url" retargets
+// it and an optional "short_code" renames it. At least one must be given.
+// The updated link is returned.
+func (h *Handler) UpdateShortURL(w http.ResponseWriter, r *http.Request) {
+	shortCode := mux.Vars(r)["code"]
+
 	// Parse input JSON
 	var payload struct {
 		URL       string `json:"url"`
@@ -162,134 +301,347 @@ func UpdateShortCode(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-		logger.WithError(err).Warn("Invalid JSON input for update")
+		requestLogger(r).WithError(err).Warn("Invalid JSON input for update")
 		http.Error(w, "Invalid input", http.StatusBadRequest)
 		return
 	}
 
 	// Validate input
-	if !utils.IsValidURL(payload.URL) {
-		logger.WithField("url", payload.URL).Warn("Invalid URL in update request")
-		http.Error(w, "Invalid URL format", http.StatusBadRequest)
+	if payload.URL == "" && payload.ShortCode == "" {
+		http.Error(w, "Nothing to update, give url and/or short_code", http.StatusBadRequest)
 		return
 	}
+	if payload.URL != "" {
+		normalized, err := h.normalizer.Normalize(payload.URL)
+		if err != nil || !utils.IsValidURL(normalized) {
+			requestLogger(r).WithField("url", payload.URL).Warn("Invalid URL in update request")
+			http.Error(w, "Invalid URL format", http.StatusBadRequest)
+			return
+		}
+		payload.URL = normalized
 
-	if !utils.IsValidShortCode(payload.ShortCode) {
-		logger.WithField("short_code", payload.ShortCode).Warn("Invalid short code in update request")
+		var violation *policy.Violation
+		if err := h.checkDestination(payload.URL); errors.As(err, &violation) {
+			writeViolation(w, violation)
+			return
+		}
+	}
+	if payload.ShortCode != "" && !utils.IsValidShortCode(payload.ShortCode) {
+		requestLogger(r).WithField("short_code", payload.ShortCode).Warn("Invalid short code in update request")
 		http.Error(w, "Invalid short code format", http.StatusBadRequest)
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), 5*time.Second)
 	defer cancel()
 
-	// Prepare update statement: update short_code where url matches
-	stmt := `UPDATE urls SET short_code = $1, updated_at = CURRENT_TIMESTAMP WHERE url = $2`
-
-	res, err := database.DB.ExecContext(ctx, stmt, payload.ShortCode, payload.URL)
-	if err != nil {
-		// Check for UNIQUE constraint violation
-		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
-			http.Error(w, "Short code already exists", http.StatusConflict)
-			return
-		}
-		if sqliteErr, ok := err.(sqlite3.Error); ok && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
-			http.Error(w, "Short code already exists", http.StatusConflict)
-			return
-		}
-
-		logger.WithError(err).Error("Database error during update")
-		http.Error(w, "Update failed", http.StatusInternalServerError)
+	if h.loadOwnedLink(ctx, w, r, shortCode) == nil {
 		return
 	}
 
-	rowsAffected, err := res.RowsAffected()
-	if err != nil || rowsAffected == 0 {
-		logger.WithFields(logrus.Fields{
-			"url":        payload.URL,
-			"short_code": payload.ShortCode,
-		}).Warn("URL not found for update")
-		http.Error(w, "URL not found or no changes made", http.StatusNotFound)
+	u, err := h.store.UpdateLink(ctx, shortCode, payload.URL, payload.ShortCode)
+	h.resolver.Invalidate(shortCode, payload.ShortCode)
+	if errors.Is(err, database.ErrConflict) {
+		http.Error(w, "Short code already exists", http.StatusConflict)
+		return
+	} else if errors.Is(err, database.ErrNotFound) {
+		requestLogger(r).WithField("short_code", shortCode).Warn("Short code not found for update")
+		http.Error(w, "Short code not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		requestLogger(r).WithError(err).Error("Database error during update")
+		http.Error(w, "Update failed", http.StatusInternalServerError)
 		return
 	}
 
-	logger.WithFields(logrus.Fields{
-		"url":        payload.URL,
-		"short_code": payload.ShortCode,
-	}).Info("Successfully updated short code")
+	requestLogger(r).WithFields(logrus.Fields{
+		"short_code":     shortCode,
+		"new_url":        payload.URL,
+		"new_short_code": payload.ShortCode,
+	}).Info("Successfully updated short URL")
 
-	w.WriteHeader(http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		*models.URL
+		ShortURL string `json:"short_url"`
+	}{u, h.cfg.BaseURL + "/u/" + u.ShortCode})
 }
 
-func DeleteShortURL(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) DeleteShortURL(w http.ResponseWriter, r *http.Request) {
 	shortCode := mux.Vars(r)["code"]
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), 5*time.Second)
 	defer cancel()
 
-	stmt := `DELETE FROM urls WHERE short_code = $1`
-	res, err := database.DB.ExecContext(ctx, stmt, shortCode)
-	if err != nil {
-		logger.WithError(err).Error("Database error during delete")
-		http.Error(w, "Delete failed", http.StatusInternalServerError)
+	if h.loadOwnedLink(ctx, w, r, shortCode) == nil {
 		return
 	}
 
-	rowsAffected, err := res.RowsAffected()
-	if err != nil || rowsAffected == 0 {
-		logger.WithField("short_code", shortCode).Warn("Short code not found for deletion")
+	err := h.store.Delete(ctx, shortCode)
+	h.resolver.Invalidate(shortCode)
+	if errors.Is(err, database.ErrNotFound) {
+		requestLogger(r).WithField("short_code", shortCode).Warn("Short code not found for deletion")
 		http.Error(w, "Short code not found", http.StatusNotFound)
 		return
+	} else if err != nil {
+		requestLogger(r).WithError(err).Error("Database error during delete")
+		http.Error(w, "Delete failed", http.StatusInternalServerError)
+		return
 	}
 
-	logger.WithField("short_code", shortCode).Info("Successfully deleted short URL")
+	requestLogger(r).WithField("short_code", shortCode).Info("Successfully deleted short URL")
 	w.WriteHeader(http.StatusOK)
 }
 
-func GetStats(w http.ResponseWriter, r *http.Request) {
+// GetStats reports the access count of a short URL together with click
+// counts bucketed by ?bucket=hour|day since ?since (RFC 3339, default 30
+// days ago) and the ?top (default 10) most common referrer hosts.
+func (h *Handler) GetStats(w http.ResponseWriter, r *http.Request) {
 	shortCode := mux.Vars(r)["code"]
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+	query := r.URL.Query()
+	bucket := query.Get("bucket")
+	if bucket == "" {
+		bucket = database.BucketDay
+	}
+	if bucket != database.BucketDay && bucket != database.BucketHour {
+		http.Error(w, "bucket must be hour or day", http.StatusBadRequest)
+		return
+	}
+
+	since := time.Now().UTC().AddDate(0, 0, -30)
+	if v := query.Get("since"); v != "" {
+		parsed, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "since must be an RFC 3339 timestamp", http.StatusBadRequest)
+			return
+		}
+		since = parsed
+	}
 
-	row := database.DB.QueryRowContext(ctx, `SELECT access_count FROM urls WHERE short_code = $1`, shortCode)
-	var count int
-	if err := row.Scan(&count); err != nil {
-		if err == sql.ErrNoRows {
-			logger.WithField("short_code", shortCode).Warn("Short code not found for stats")
-			http.NotFound(w, r)
+	top := 10
+	if v := query.Get("top"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 100 {
+			http.Error(w, "top must be between 1 and 100", http.StatusBadRequest)
 			return
 		}
-		logger.WithError(err).Error("Database error fetching stats")
+		top = n
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), 5*time.Second)
+	defer cancel()
+
+	u := h.loadOwnedLink(ctx, w, r, shortCode)
+	if u == nil {
+		return
+	}
+
+	clicks, err := h.store.ClickStats(ctx, u.ID, since, bucket, top)
+	if err != nil {
+		requestLogger(r).WithError(err).Error("Database error fetching click stats")
 		http.Error(w, "Error fetching stats", http.StatusInternalServerError)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]int{"access_count": count})
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_count":  u.AccessCount,
+		"bucket":        bucket,
+		"since":         since,
+		"clicks":        clicks.Clicks,
+		"top_referrers": clicks.TopReferrers,
+	})
 }
 
-// HealthCheck endpoint for monitoring
-func HealthCheck(w http.ResponseWriter, r *http.Request) {
-	// Check database connectivity
-	if err := database.HealthCheck(); err != nil {
-		logger.WithError(err).Error("Health check failed - database unreachable")
-		w.WriteHeader(http.StatusServiceUnavailable)
-		json.NewEncoder(w).Encode(map[string]string{
-			"status": "unhealthy",
-			"error":  "database unreachable",
-		})
+// ListMyURLs returns the caller's links ordered by id, ?limit (default 50,
+// max 500) at a time. Pass the returned next_after as ?after for the next page.
+func (h *Handler) ListMyURLs(w http.ResponseWriter, r *http.Request) {
+	p, ok := auth.FromContext(r.Context())
+	if !ok {
+		http.Error(w, "API key required", http.StatusUnauthorized)
+		return
+	}
+
+	query := r.URL.Query()
+	limit := 50
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 500 {
+			http.Error(w, "limit must be between 1 and 500", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	after := 0
+	if v := query.Get("after"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, "after must be a link id", http.StatusBadRequest)
+			return
+		}
+		after = n
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), 5*time.Second)
+	defer cancel()
+
+	urls, err := h.store.ListByOwner(ctx, p.Owner, after, limit)
+	if err != nil {
+		requestLogger(r).WithError(err).Error("Database error listing links")
+		http.Error(w, "Error listing URLs", http.StatusInternalServerError)
 		return
 	}
 
+	resp := map[string]interface{}{"urls": urls}
+	if len(urls) == limit {
+		resp["next_after"] = urls[len(urls)-1].ID
+	}
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"status":      "healthy",
-		"timestamp":   time.Now().UTC(),
-		"version":     "1.0.0",
-		"environment": cfg.Environment,
-	})
+	json.NewEncoder(w).Encode(resp)
+}
+
+// ListURLs pages through links, newest first by default. Filters: ?host,
+// ?created_after and ?created_before (RFC 3339), ?min_access, ?prefix (short
+// code), ?q (words in the destination or title) and ?threat_status
+// (flagged or disabled). Order with
+// ?sort=id|created_at|access_count|short_code and ?order=asc|desc. Pass the
+// returned next_cursor as ?cursor for the next page. Non-admin keys only see
+// their own links; admin keys see all of them or those of ?owner.
+func (h *Handler) ListURLs(w http.ResponseWriter, r *http.Request) {
+	p, ok := auth.FromContext(r.Context())
+	if !ok {
+		http.Error(w, "API key required", http.StatusUnauthorized)
+		return
+	}
+
+	query := r.URL.Query()
+	f := database.ListFilter{
+		Owner:      p.Owner,
+		Host:       query.Get("host"),
+		CodePrefix: query.Get("prefix"),
+		Search:     query.Get("q"),
+		Sort:       database.SortCreatedAt,
+		Desc:       true,
+		Limit:      50,
+	}
+	if p.HasScope(auth.ScopeAdmin) {
+		f.Owner = query.Get("owner")
+	}
+
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 500 {
+			http.Error(w, "limit must be between 1 and 500", http.StatusBadRequest)
+			return
+		}
+		f.Limit = n
+	}
+	for param, dst := range map[string]*time.Time{"created_after": &f.CreatedAfter, "created_before": &f.CreatedBefore} {
+		if v := query.Get(param); v != "" {
+			parsed, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				http.Error(w, param+" must be an RFC 3339 timestamp", http.StatusBadRequest)
+				return
+			}
+			*dst = parsed
+		}
+	}
+	if v := query.Get("min_access"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, "min_access must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+		f.MinAccessCount = n
+	}
+	switch v := query.Get("threat_status"); v {
+	case "", models.ThreatFlagged, models.ThreatDisabled:
+		f.ThreatStatus = v
+	default:
+		http.Error(w, "threat_status must be flagged or disabled", http.StatusBadRequest)
+		return
+	}
+	if len(f.CodePrefix) > 20 || strings.IndexFunc(f.CodePrefix, func(c rune) bool {
+		return !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9')
+	}) >= 0 {
+		http.Error(w, "prefix must be up to 20 alphanumeric characters", http.StatusBadRequest)
+		return
+	}
+	switch v := query.Get("sort"); v {
+	case "":
+	case database.SortID, database.SortCreatedAt, database.SortAccessCount, database.SortShortCode:
+		f.Sort = v
+	default:
+		http.Error(w, "sort must be id, created_at, access_count or short_code", http.StatusBadRequest)
+		return
+	}
+	switch query.Get("order") {
+	case "", "desc":
+	case "asc":
+		f.Desc = false
+	default:
+		http.Error(w, "order must be asc or desc", http.StatusBadRequest)
+		return
+	}
+	if v := query.Get("cursor"); v != "" {
+		c, err := decodeCursor(v, f.Sort, f.Desc)
+		if err != nil {
+			http.Error(w, "invalid cursor", http.StatusBadRequest)
+			return
+		}
+		f.After = c
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), 5*time.Second)
+	defer cancel()
+
+	// Fetch one extra row to know whether there is another page
+	limit := f.Limit
+	f.Limit++
+	urls, err := h.store.List(ctx, f)
+	if err != nil {
+		requestLogger(r).WithError(err).Error("Database error listing links")
+		http.Error(w, "Error listing URLs", http.StatusInternalServerError)
+		return
+	}
+
+	resp := map[string]interface{}{}
+	if len(urls) > limit {
+		urls = urls[:limit]
+		resp["next_cursor"] = encodeCursor(database.CursorFor(&urls[limit-1], f.Sort), f.Sort, f.Desc)
+	}
+	resp["urls"] = urls
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// listCursor is the opaque ?cursor of ListURLs. It remembers the ordering it
+// was issued for so it cannot be replayed against a different one.
+type listCursor struct {
+	Sort string `json:"s"`
+	Desc bool   `json:"d,omitempty"`
+	database.Cursor
+}
+
+func encodeCursor(c *database.Cursor, sort string, desc bool) string {
+	data, _ := json.Marshal(listCursor{Sort: sort, Desc: desc, Cursor: *c})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s, sort string, desc bool) (*database.Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	var c listCursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, err
+	}
+	if c.Sort != sort || c.Desc != desc {
+		return nil, errors.New("cursor was issued for a different ordering")
+	}
+	return &c.Cursor, nil
 }
 
 // ServeShortenPage serves the HTML form for shortening URLs
@@ -0,0 +1,514 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"urlshortner/auth"
+	"urlshortner/cache"
+	"urlshortner/codegen"
+	"urlshortner/config"
+	"urlshortner/database"
+	"urlshortner/expiry"
+	"urlshortner/models"
+	"urlshortner/policy"
+	"urlshortner/threat"
+	"urlshortner/tracking"
+	"urlshortner/urlnorm"
+
+	"github.com/gorilla/mux"
+)
+
+// testServer is the URL API routed as in main, on top of a memory store
+type testServer struct {
+	t      *testing.T
+	store  database.Store
+	h      *Handler
+	router *mux.Router
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	store := database.NewMemoryStore()
+	gen, err := codegen.New(codegen.StrategyRandom, "", 6, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authenticator := auth.NewAuthenticator(store)
+	h := New(Deps{
+		Store:      store,
+		Resolver:   cache.NewResolver(store, nil, 0, time.Minute, time.Minute),
+		Tracker:    tracking.NewAggregator(store, time.Hour, 100),
+		Auth:       authenticator,
+		Normalizer: urlnorm.New(nil, false),
+		Policy:     policy.New([]string{"sho.rt"}, nil, false),
+		Threats:    threat.NewFeed(nil, 0),
+		Codes:      codegen.NewAllocator(gen, 5),
+		Config: &config.Config{
+			BaseURL:       "http://sho.rt",
+			ExpiryMode:    expiry.ModeArchive,
+			CodeGenerator: codegen.StrategyRandom,
+			BatchMaxSize:  5,
+		},
+	})
+
+	requireCreate := auth.Require(auth.ScopeCreate)
+	requireManage := auth.Require(auth.ScopeManage)
+	requireAdmin := auth.Require(auth.ScopeAdmin)
+	r := mux.NewRouter()
+	r.Use(authenticator.Middleware)
+	r.Handle("/shorten", requireCreate(http.HandlerFunc(h.CreateShortURL))).Methods("POST")
+	r.Handle("/shorten/batch", requireCreate(http.HandlerFunc(h.CreateShortURLBatch))).Methods("POST")
+	r.HandleFunc("/u/{code}", h.GetOriginalURL).Methods("GET")
+	r.Handle("/u/{code}", requireManage(http.HandlerFunc(h.UpdateShortURL))).Methods("PUT", "PATCH")
+	r.Handle("/u/{code}", requireManage(http.HandlerFunc(h.DeleteShortURL))).Methods("DELETE")
+	r.Handle("/stats/{code}", auth.Require(auth.ScopeStats)(http.HandlerFunc(h.GetStats))).Methods("GET")
+	r.Handle("/urls", auth.Authenticated(http.HandlerFunc(h.ListURLs))).Methods("GET")
+	r.Handle("/me/urls", auth.Authenticated(http.HandlerFunc(h.ListMyURLs))).Methods("GET")
+	r.Handle("/admin/export", requireAdmin(http.HandlerFunc(h.ExportURLs))).Methods("GET")
+	r.Handle("/admin/import", requireAdmin(http.HandlerFunc(h.ImportURLs))).Methods("POST")
+	r.Handle("/admin/keys", requireAdmin(http.HandlerFunc(h.CreateAPIKey))).Methods("POST")
+	r.Handle("/admin/keys", requireAdmin(http.HandlerFunc(h.ListAPIKeys))).Methods("GET")
+	r.Handle("/admin/keys/{id}", requireAdmin(http.HandlerFunc(h.RevokeAPIKey))).Methods("DELETE")
+	return &testServer{t: t, store: store, h: h, router: r}
+}
+
+// issueKey stores a new API key for owner and returns its secret
+func (s *testServer) issueKey(owner string, scopes ...string) string {
+	s.t.Helper()
+	key, _, err := IssueAPIKey(context.Background(), s.store, owner, owner, scopes)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	return key
+}
+
+func (s *testServer) do(method, path, key, body string) *httptest.ResponseRecorder {
+	s.t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if key != "" {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+	return rec
+}
+
+func decode(t *testing.T, rec *httptest.ResponseRecorder) map[string]interface{} {
+	t.Helper()
+	var body map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("response %q: %v", rec.Body.String(), err)
+	}
+	return body
+}
+
+func TestCreateShortURL(t *testing.T) {
+	s := newTestServer(t)
+	key := s.issueKey("alice", auth.ScopeCreate)
+
+	rec := s.do("POST", "/shorten", key, `{"url":"https://example.com/a","short_code":"mine"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create = %d %s", rec.Code, rec.Body)
+	}
+	if got := decode(t, rec)["short_url"]; got != "http://sho.rt/u/mine" {
+		t.Errorf("short_url = %v", got)
+	}
+	u, err := s.store.GetByCode(context.Background(), "mine")
+	if err != nil || u.Owner != "alice" {
+		t.Fatalf("stored link %+v, %v, want one owned by alice", u, err)
+	}
+
+	rec = s.do("POST", "/shorten", key, `{"url":"https://example.com/b"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create with generated code = %d %s", rec.Code, rec.Body)
+	}
+	if code, _ := decode(t, rec)["short_code"].(string); len(code) != 6 {
+		t.Errorf("generated code %q, want 6 characters", code)
+	}
+
+	rec = s.do("POST", "/shorten", key, `{"url":"https://example.com/e","ttl_seconds":60}`)
+	if rec.Code != http.StatusCreated || decode(t, rec)["expires_at"] == nil {
+		t.Errorf("create with ttl = %d %s, want an expiry", rec.Code, rec.Body)
+	}
+
+	tests := []struct {
+		name string
+		key  string
+		body string
+		want int
+	}{
+		{"duplicate code", key, `{"url":"https://example.com/c","short_code":"mine"}`, http.StatusConflict},
+		{"invalid url", key, `{"url":"not a url"}`, http.StatusBadRequest},
+		{"invalid json", key, `{"url":`, http.StatusBadRequest},
+		{"invalid code", key, `{"url":"https://example.com/d","short_code":"a b"}`, http.StatusBadRequest},
+		{"negative ttl", key, `{"url":"https://example.com/d","ttl_seconds":-1}`, http.StatusBadRequest},
+		{"past expiry", key, `{"url":"https://example.com/d","expires_at":"2001-01-01T00:00:00Z"}`, http.StatusBadRequest},
+		{"ttl and expiry", key, `{"url":"https://example.com/d","ttl_seconds":60,"expires_at":"2101-01-01T00:00:00Z"}`, http.StatusBadRequest},
+		{"no key", "", `{"url":"https://example.com/d"}`, http.StatusUnauthorized},
+		{"missing scope", s.issueKey("bob", auth.ScopeStats), `{"url":"https://example.com/d"}`, http.StatusForbidden},
+		{"self reference", key, `{"url":"https://sho.rt/u/mine"}`, http.StatusUnprocessableEntity},
+	}
+	for _, tt := range tests {
+		if rec := s.do("POST", "/shorten", tt.key, tt.body); rec.Code != tt.want {
+			t.Errorf("%s: create = %d %s, want %d", tt.name, rec.Code, rec.Body, tt.want)
+		}
+	}
+
+	rec = s.do("POST", "/shorten", key, `{"url":"http://10.0.0.1/"}`)
+	if rec.Code != http.StatusUnprocessableEntity || decode(t, rec)["rule"] != policy.RulePrivateAddress {
+		t.Errorf("private destination = %d %s, want a %s violation", rec.Code, rec.Body, policy.RulePrivateAddress)
+	}
+}
+
+func TestGetOriginalURL(t *testing.T) {
+	s := newTestServer(t)
+	ctx := context.Background()
+	past := time.Now().Add(-time.Minute)
+	for _, u := range []*models.URL{
+		{URL: "https://example.com/", ShortCode: "live"},
+		{URL: "https://example.com/old", ShortCode: "gone", ExpiresAt: &past},
+		{URL: "https://example.com/swept", ShortCode: "swept", ExpiresAt: &past},
+	} {
+		if err := s.store.Create(ctx, u, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rec := s.do("GET", "/u/live", "", "")
+	if rec.Code != http.StatusFound || rec.Header().Get("Location") != "https://example.com/" {
+		t.Errorf("redirect = %d to %q", rec.Code, rec.Header().Get("Location"))
+	}
+	if rec := s.do("GET", "/u/missing", "", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown code = %d, want 404", rec.Code)
+	}
+	if rec := s.do("GET", "/u/gone", "", ""); rec.Code != http.StatusGone {
+		t.Errorf("expired code = %d, want 410", rec.Code)
+	}
+	if _, err := s.store.SweepExpired(ctx, time.Now(), 10, true); err != nil {
+		t.Fatal(err)
+	}
+	if rec := s.do("GET", "/u/swept", "", ""); rec.Code != http.StatusGone {
+		t.Errorf("archived code = %d, want 410", rec.Code)
+	}
+
+	if err := s.h.tracker.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if u, _ := s.store.GetByCode(ctx, "live"); u.AccessCount != 1 {
+		t.Errorf("access count = %d, want 1", u.AccessCount)
+	}
+}
+
+func TestUpdateShortURL(t *testing.T) {
+	s := newTestServer(t)
+	ctx := context.Background()
+	for _, u := range []*models.URL{
+		{URL: "https://example.com/", ShortCode: "abc", Owner: "alice"},
+		{URL: "https://example.com/other", ShortCode: "taken", Owner: "alice"},
+	} {
+		if err := s.store.Create(ctx, u, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	alice := s.issueKey("alice", auth.ScopeManage)
+
+	// Resolve once so the update has a cached entry to invalidate
+	s.do("GET", "/u/abc", "", "")
+	rec := s.do("PATCH", "/u/abc", alice, `{"url":"https://example.com/new"}`)
+	if rec.Code != http.StatusOK || decode(t, rec)["url"] != "https://example.com/new" {
+		t.Fatalf("retarget = %d %s", rec.Code, rec.Body)
+	}
+	if rec := s.do("GET", "/u/abc", "", ""); rec.Header().Get("Location") != "https://example.com/new" {
+		t.Errorf("redirect after retarget goes to %q", rec.Header().Get("Location"))
+	}
+
+	rec = s.do("PUT", "/u/abc", alice, `{"short_code":"renamed"}`)
+	if rec.Code != http.StatusOK || decode(t, rec)["short_url"] != "http://sho.rt/u/renamed" {
+		t.Fatalf("rename = %d %s", rec.Code, rec.Body)
+	}
+	if rec := s.do("GET", "/u/abc", "", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("old code after rename = %d, want 404", rec.Code)
+	}
+
+	tests := []struct {
+		name string
+		path string
+		key  string
+		body string
+		want int
+	}{
+		{"taken code", "/u/renamed", alice, `{"short_code":"taken"}`, http.StatusConflict},
+		{"unknown code", "/u/missing", alice, `{"url":"https://example.com/"}`, http.StatusNotFound},
+		{"nothing to update", "/u/renamed", alice, `{}`, http.StatusBadRequest},
+		{"invalid url", "/u/renamed", alice, `{"url":"ftp://example.com/file"}`, http.StatusBadRequest},
+		{"policy violation", "/u/renamed", alice, `{"url":"http://127.0.0.1/"}`, http.StatusUnprocessableEntity},
+		{"other owner", "/u/renamed", s.issueKey("bob", auth.ScopeManage), `{"url":"https://example.com/"}`, http.StatusForbidden},
+		{"no key", "/u/renamed", "", `{"url":"https://example.com/"}`, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		if rec := s.do("PATCH", tt.path, tt.key, tt.body); rec.Code != tt.want {
+			t.Errorf("%s: update = %d %s, want %d", tt.name, rec.Code, rec.Body, tt.want)
+		}
+	}
+}
+
+func TestDeleteShortURL(t *testing.T) {
+	s := newTestServer(t)
+	if err := s.store.Create(context.Background(), &models.URL{URL: "https://example.com/", ShortCode: "abc", Owner: "alice"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if rec := s.do("DELETE", "/u/abc", "", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("delete without a key = %d, want 401", rec.Code)
+	}
+	if rec := s.do("DELETE", "/u/abc", s.issueKey("bob", auth.ScopeManage), ""); rec.Code != http.StatusForbidden {
+		t.Errorf("delete by another owner = %d, want 403", rec.Code)
+	}
+	key := s.issueKey("alice", auth.ScopeManage)
+	if rec := s.do("DELETE", "/u/abc", key, ""); rec.Code != http.StatusOK {
+		t.Fatalf("delete = %d %s", rec.Code, rec.Body)
+	}
+	if rec := s.do("GET", "/u/abc", "", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("redirect after delete = %d, want 404", rec.Code)
+	}
+	if rec := s.do("DELETE", "/u/abc", key, ""); rec.Code != http.StatusNotFound {
+		t.Errorf("second delete = %d, want 404", rec.Code)
+	}
+}
+
+func TestGetStats(t *testing.T) {
+	s := newTestServer(t)
+	ctx := context.Background()
+	if err := s.store.Create(ctx, &models.URL{URL: "https://example.com/", ShortCode: "abc", Owner: "alice"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest("GET", "/u/abc", nil)
+		req.Header.Set("Referer", "https://news.example/item")
+		s.router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	if err := s.h.tracker.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	key := s.issueKey("alice", auth.ScopeStats)
+	rec := s.do("GET", "/stats/abc?bucket=hour", key, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("stats = %d %s", rec.Code, rec.Body)
+	}
+	body := decode(t, rec)
+	if body["access_count"] != float64(3) || body["bucket"] != "hour" {
+		t.Errorf("stats = %v, want 3 accesses in hourly buckets", body)
+	}
+	if refs, _ := body["top_referrers"].([]interface{}); len(refs) != 1 {
+		t.Errorf("top_referrers = %v, want one host", body["top_referrers"])
+	}
+
+	tests := []struct {
+		name string
+		path string
+		key  string
+		want int
+	}{
+		{"unknown code", "/stats/missing", key, http.StatusNotFound},
+		{"bad bucket", "/stats/abc?bucket=week", key, http.StatusBadRequest},
+		{"bad since", "/stats/abc?since=yesterday", key, http.StatusBadRequest},
+		{"bad top", "/stats/abc?top=0", key, http.StatusBadRequest},
+		{"other owner", "/stats/abc", s.issueKey("bob", auth.ScopeStats), http.StatusForbidden},
+		{"missing scope", "/stats/abc", s.issueKey("alice", auth.ScopeCreate), http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		if rec := s.do("GET", tt.path, tt.key, ""); rec.Code != tt.want {
+			t.Errorf("%s: stats = %d %s, want %d", tt.name, rec.Code, rec.Body, tt.want)
+		}
+	}
+}
+
+// listCodes returns the short codes of a list response in order
+func listCodes(t *testing.T, body map[string]interface{}) []string {
+	t.Helper()
+	urls, _ := body["urls"].([]interface{})
+	codes := make([]string, len(urls))
+	for i, u := range urls {
+		codes[i], _ = u.(map[string]interface{})["short_code"].(string)
+	}
+	return codes
+}
+
+func TestListURLs(t *testing.T) {
+	s := newTestServer(t)
+	ctx := context.Background()
+	for _, u := range []*models.URL{
+		{URL: "https://docs.example/guide", ShortCode: "aaa", Owner: "alice", Title: "Install guide"},
+		{URL: "https://blog.example/post", ShortCode: "bbb", Owner: "alice"},
+		{URL: "https://docs.example/api", ShortCode: "ccc", Owner: "alice"},
+		{URL: "https://docs.example/bob", ShortCode: "ddd", Owner: "bob"},
+	} {
+		if err := s.store.Create(ctx, u, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	alice := s.issueKey("alice", auth.ScopeStats)
+
+	// Pages follow each other through the cursor without gaps or repeats
+	var codes []string
+	path := "/urls?sort=short_code&order=asc&limit=2"
+	for page := 0; page < 3; page++ {
+		rec := s.do("GET", path, alice, "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("page %d = %d %s", page, rec.Code, rec.Body)
+		}
+		body := decode(t, rec)
+		codes = append(codes, listCodes(t, body)...)
+		cursor, ok := body["next_cursor"].(string)
+		if !ok {
+			break
+		}
+		path = "/urls?sort=short_code&order=asc&limit=2&cursor=" + cursor
+	}
+	if strings.Join(codes, ",") != "aaa,bbb,ccc" {
+		t.Errorf("alice's pages = %v, want only her links in code order", codes)
+	}
+
+	for query, want := range map[string]string{
+		"/urls?host=docs.example&sort=short_code&order=asc": "aaa,ccc",
+		"/urls?q=install":    "aaa",
+		"/urls?prefix=bb":    "bbb",
+		"/urls?min_access=1": "",
+	} {
+		rec := s.do("GET", query, alice, "")
+		if got := strings.Join(listCodes(t, decode(t, rec)), ","); got != want {
+			t.Errorf("%s = %q, want %q", query, got, want)
+		}
+	}
+
+	admin := s.issueKey("ops", auth.ScopeAdmin)
+	if got := listCodes(t, decode(t, s.do("GET", "/urls?owner=bob", admin, ""))); strings.Join(got, ",") != "ddd" {
+		t.Errorf("admin listing of bob = %v, want ddd", got)
+	}
+	if got := listCodes(t, decode(t, s.do("GET", "/urls", admin, ""))); len(got) != 4 {
+		t.Errorf("admin listing = %v, want every link", got)
+	}
+
+	rec := s.do("GET", "/urls?sort=short_code&limit=1", alice, "")
+	cursor := decode(t, rec)["next_cursor"].(string)
+	for _, query := range []string{
+		"/urls?limit=0",
+		"/urls?sort=title",
+		"/urls?order=up",
+		"/urls?created_after=yesterday",
+		"/urls?min_access=-1",
+		"/urls?threat_status=clean",
+		"/urls?prefix=a-b",
+		"/urls?cursor=garbage",
+		// A cursor only continues the ordering it was issued for
+		"/urls?sort=id&cursor=" + cursor,
+	} {
+		if rec := s.do("GET", query, alice, ""); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s = %d, want 400", query, rec.Code)
+		}
+	}
+	if rec := s.do("GET", "/urls", "", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("listing without a key = %d, want 401", rec.Code)
+	}
+}
+
+func TestOwnership(t *testing.T) {
+	s := newTestServer(t)
+	ctx := context.Background()
+	for _, u := range []*models.URL{
+		{URL: "https://example.com/1", ShortCode: "own1", Owner: "alice"},
+		{URL: "https://example.com/2", ShortCode: "own2", Owner: "alice"},
+		{URL: "https://example.com/3", ShortCode: "own3", Owner: "alice"},
+		{URL: "https://example.com/b", ShortCode: "bobs", Owner: "bob"},
+		{URL: "https://example.com/u", ShortCode: "legacy"},
+	} {
+		if err := s.store.Create(ctx, u, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	alice := s.issueKey("alice", auth.ScopeManage)
+	admin := s.issueKey("ops", auth.ScopeAdmin)
+
+	rec := s.do("GET", "/me/urls?limit=2", alice, "")
+	body := decode(t, rec)
+	if got := listCodes(t, body); strings.Join(got, ",") != "own1,own2" {
+		t.Fatalf("first page = %v", got)
+	}
+	after := int(body["next_after"].(float64))
+	rec = s.do("GET", "/me/urls?limit=2&after="+strconv.Itoa(after), alice, "")
+	if got := listCodes(t, decode(t, rec)); strings.Join(got, ",") != "own3" {
+		t.Errorf("second page = %v, want own3", got)
+	}
+
+	// Links without an owner are reserved for admins
+	if rec := s.do("DELETE", "/u/legacy", alice, ""); rec.Code != http.StatusForbidden {
+		t.Errorf("user delete of an unowned link = %d, want 403", rec.Code)
+	}
+	for _, code := range []string{"legacy", "bobs"} {
+		if rec := s.do("PATCH", "/u/"+code, admin, `{"url":"https://example.com/admin"}`); rec.Code != http.StatusOK {
+			t.Errorf("admin update of %s = %d %s", code, rec.Code, rec.Body)
+		}
+	}
+	// Updates keep the owner
+	if u, _ := s.store.GetByCode(ctx, "bobs"); u.Owner != "bob" {
+		t.Errorf("owner after admin update = %q, want bob", u.Owner)
+	}
+}
+
+func TestCreateReusesExistingLinks(t *testing.T) {
+	s := newTestServer(t)
+	s.h.cfg.ReuseExisting = true
+	alice := s.issueKey("alice", auth.ScopeCreate)
+	bob := s.issueKey("bob", auth.ScopeCreate)
+
+	rec := s.do("POST", "/shorten", alice, `{"url":"https://example.com/page"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("first create = %d %s", rec.Code, rec.Body)
+	}
+	first := decode(t, rec)["short_code"]
+
+	// The same destination after normalization gets the existing link back
+	rec = s.do("POST", "/shorten", alice, `{"url":"HTTPS://EXAMPLE.com/page"}`)
+	body := decode(t, rec)
+	if rec.Code != http.StatusOK || body["short_code"] != first || body["reused"] != true {
+		t.Errorf("repeat create = %d %v, want %v reused", rec.Code, body, first)
+	}
+
+	tests := []struct {
+		name string
+		key  string
+		body string
+	}{
+		{"other owner", bob, `{"url":"https://example.com/page"}`},
+		{"custom code", alice, `{"url":"https://example.com/page","short_code":"mine"}`},
+		{"expiring", alice, `{"url":"https://example.com/page","ttl_seconds":60}`},
+		{"opted out", alice, `{"url":"https://example.com/page","reuse_existing":false}`},
+	}
+	for _, tt := range tests {
+		rec := s.do("POST", "/shorten", tt.key, tt.body)
+		if body := decode(t, rec); rec.Code != http.StatusCreated || body["short_code"] == first {
+			t.Errorf("%s: create = %d %v, want a new link", tt.name, rec.Code, body)
+		}
+	}
+
+	// A retargeted link no longer stands for its old destination
+	if _, err := s.store.UpdateLink(context.Background(), first.(string), "https://example.com/moved", ""); err != nil {
+		t.Fatal(err)
+	}
+	rec = s.do("POST", "/shorten", alice, `{"url":"https://example.com/page"}`)
+	if body := decode(t, rec); body["short_code"] == first {
+		t.Errorf("retargeted link %v reused for its old destination", first)
+	}
+}
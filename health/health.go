@@ -0,0 +1,104 @@
+// Package health runs the dependency checks behind the readiness endpoint
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Check statuses
+const (
+	StatusOK       = "ok"
+	StatusFailing  = "failing"
+	StatusDegraded = "degraded"
+)
+
+// CheckFunc reports a dependency as unavailable by returning an error
+type CheckFunc func(ctx context.Context) error
+
+type check struct {
+	name     string
+	critical bool
+	fn       CheckFunc
+}
+
+// Result is the outcome of one check
+type Result struct {
+	Name      string  `json:"name"`
+	Status    string  `json:"status"`
+	Critical  bool    `json:"critical"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// Checker runs every registered check concurrently, each bounded by timeout
+type Checker struct {
+	timeout time.Duration
+
+	mu     sync.RWMutex
+	checks []check
+}
+
+// NewChecker creates a Checker with no checks
+func NewChecker(timeout time.Duration) *Checker {
+	return &Checker{timeout: timeout}
+}
+
+// Add registers a check. A failing critical check makes the instance not
+// ready; a failing non-critical one is only reported as degraded, for
+// dependencies the service can run without.
+func (c *Checker) Add(name string, critical bool, fn CheckFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks = append(c.checks, check{name: name, critical: critical, fn: fn})
+}
+
+// Run executes the checks and reports whether all critical ones passed.
+// Results are in registration order.
+func (c *Checker) Run(ctx context.Context) (bool, []Result) {
+	c.mu.RLock()
+	checks := append([]check(nil), c.checks...)
+	c.mu.RUnlock()
+
+	results := make([]Result, len(checks))
+	var wg sync.WaitGroup
+	for i, chk := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = c.run(ctx, chk)
+		}()
+	}
+	wg.Wait()
+
+	ready := true
+	for _, r := range results {
+		if r.Critical && r.Status != StatusOK {
+			ready = false
+		}
+	}
+	return ready, results
+}
+
+func (c *Checker) run(ctx context.Context, chk check) Result {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := chk.fn(ctx)
+	result := Result{
+		Name:      chk.name,
+		Status:    StatusOK,
+		Critical:  chk.critical,
+		LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		result.Status = StatusFailing
+		if !chk.critical {
+			result.Status = StatusDegraded
+		}
+		result.Error = err.Error()
+	}
+	return result
+}
@@ -0,0 +1,49 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRunReportsEveryCheck(t *testing.T) {
+	c := NewChecker(50 * time.Millisecond)
+	c.Add("database", true, func(ctx context.Context) error { return nil })
+	c.Add("redis", false, func(ctx context.Context) error { return errors.New("connection refused") })
+
+	ready, results := c.Run(context.Background())
+	if !ready {
+		t.Error("a failing non-critical check made the instance not ready")
+	}
+	if len(results) != 2 || results[0].Name != "database" || results[1].Name != "redis" {
+		t.Fatalf("results = %+v, want both checks in registration order", results)
+	}
+	if results[0].Status != StatusOK || results[0].Error != "" {
+		t.Errorf("database = %+v", results[0])
+	}
+	if results[1].Status != StatusDegraded || results[1].Error != "connection refused" {
+		t.Errorf("redis = %+v, want degraded with its error", results[1])
+	}
+}
+
+func TestRunFailsOnSlowCriticalCheck(t *testing.T) {
+	c := NewChecker(20 * time.Millisecond)
+	c.Add("database", true, func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	c.Add("migrations", true, func(ctx context.Context) error { return nil })
+
+	start := time.Now()
+	ready, results := c.Run(context.Background())
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Run took %v, want it bounded by the check timeout", elapsed)
+	}
+	if ready {
+		t.Error("instance ready with a critical check timing out")
+	}
+	if results[0].Status != StatusFailing || results[1].Status != StatusOK {
+		t.Errorf("results = %+v", results)
+	}
+}
@@ -0,0 +1,64 @@
+package logging
+
+import (
+	"context"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+type scopeKey struct{}
+
+// scope is the request logger shared by every handler and middleware of a
+// request, so fields added deep in the chain, like the principal, also
+// reach the request completion entry
+type scope struct {
+	mu         sync.Mutex
+	entry      *logrus.Entry
+	suppressed bool
+}
+
+// NewContext returns a copy of ctx carrying entry as its request logger
+func NewContext(ctx context.Context, entry *logrus.Entry) context.Context {
+	return context.WithValue(ctx, scopeKey{}, &scope{entry: entry})
+}
+
+// FromContext returns the request logger of ctx, or Logger when there is
+// none, bound to ctx so entries carry its trace
+func FromContext(ctx context.Context) *logrus.Entry {
+	if s, ok := ctx.Value(scopeKey{}).(*scope); ok {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.entry.WithContext(ctx)
+	}
+	return Logger.WithContext(ctx)
+}
+
+// AddFields adds fields to the request logger of ctx for every later entry
+func AddFields(ctx context.Context, fields logrus.Fields) {
+	if s, ok := ctx.Value(scopeKey{}).(*scope); ok {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.entry = s.entry.WithFields(fields)
+	}
+}
+
+// Suppress marks the request as sampled out, so its successful completion
+// is not logged
+func Suppress(ctx context.Context) {
+	if s, ok := ctx.Value(scopeKey{}).(*scope); ok {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.suppressed = true
+	}
+}
+
+// Suppressed reports whether Suppress was called for the request
+func Suppressed(ctx context.Context) bool {
+	if s, ok := ctx.Value(scopeKey{}).(*scope); ok {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.suppressed
+	}
+	return false
+}
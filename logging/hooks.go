@@ -0,0 +1,94 @@
+package logging
+
+import (
+	"net/url"
+	"strings"
+	"sync/atomic"
+
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// traceHook adds trace_id and span_id to entries logged with a context
+// that carries a span
+type traceHook struct{}
+
+func (traceHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (traceHook) Fire(entry *logrus.Entry) error {
+	if entry.Context == nil {
+		return nil
+	}
+	sc := trace.SpanContextFromContext(entry.Context)
+	if !sc.IsValid() {
+		return nil
+	}
+	entry.Data["trace_id"] = sc.TraceID().String()
+	entry.Data["span_id"] = sc.SpanID().String()
+	return nil
+}
+
+// urlFields are the entry fields holding user supplied URLs
+var urlFields = []string{"url", "redirect_url", "new_url", "referrer"}
+
+// redaction passes the URL fields of every entry through RedactURL while
+// enabled
+var redaction = &redactHook{}
+
+type redactHook struct {
+	enabled atomic.Bool
+}
+
+func (h *redactHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *redactHook) Fire(entry *logrus.Entry) error {
+	if !h.enabled.Load() {
+		return nil
+	}
+	for _, key := range urlFields {
+		if raw, ok := entry.Data[key].(string); ok {
+			entry.Data[key] = RedactURL(raw)
+		}
+	}
+	return nil
+}
+
+const redacted = "REDACTED"
+
+// RedactURL hides what may be secret in a URL: the password of its user
+// info, every query value and the fragment. Query keys stay, so the shape of
+// the URL is still visible. Unparsable input is cut at the first '?' or '#'.
+func RedactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		if i := strings.IndexAny(raw, "?#"); i >= 0 {
+			return raw[:i] + "?" + redacted
+		}
+		return raw
+	}
+	if u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), redacted)
+		} else {
+			u.User = url.User(redacted)
+		}
+	}
+	if u.RawQuery != "" {
+		query := u.Query()
+		for key, values := range query {
+			for i := range values {
+				values[i] = redacted
+			}
+			query[key] = values
+		}
+		u.RawQuery = query.Encode()
+	}
+	if u.Fragment != "" {
+		u.Fragment = redacted
+	}
+	return u.String()
+}
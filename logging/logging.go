@@ -0,0 +1,95 @@
+// Package logging owns the one logrus logger every package writes to. It is
+// configured once from config.Config, stamps entries with the trace of their
+// context, redacts logged URLs and carries request scoped loggers through
+// request contexts.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Formats accepted by Options.Format
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
+// Logger is the shared logger. Packages log through Component entries of it.
+var Logger = newLogger()
+
+func newLogger() *logrus.Logger {
+	l := logrus.New()
+	l.SetFormatter(&logrus.JSONFormatter{})
+	l.SetLevel(logrus.InfoLevel)
+	l.AddHook(traceHook{})
+	l.AddHook(redaction)
+	redaction.enabled.Store(true)
+	return l
+}
+
+// Options configures Logger
+type Options struct {
+	// Level is a logrus level name: trace, debug, info, warn, error
+	Level string
+	// Format is FormatJSON or FormatText
+	Format string
+	// Output is stdout, stderr or a file path to append to
+	Output string
+	// RedactURLs hides query values and credentials of logged URLs
+	RedactURLs bool
+	// RedirectsPerSecond caps how many successful redirects are logged each
+	// second, 0 logs every one
+	RedirectsPerSecond int
+}
+
+// Configure applies opts to Logger. It returns the opened log file, if any,
+// for the caller to close on exit.
+func Configure(opts Options) (io.Closer, error) {
+	level, err := logrus.ParseLevel(opts.Level)
+	if err != nil {
+		return nil, fmt.Errorf("invalid log level %q: %w", opts.Level, err)
+	}
+
+	var formatter logrus.Formatter
+	switch strings.ToLower(opts.Format) {
+	case FormatJSON, "":
+		formatter = &logrus.JSONFormatter{}
+	case FormatText:
+		formatter = &logrus.TextFormatter{FullTimestamp: true}
+	default:
+		return nil, fmt.Errorf("invalid log format %q, want json or text", opts.Format)
+	}
+
+	var out io.Writer
+	var closer io.Closer
+	switch opts.Output {
+	case "stderr", "":
+		out = os.Stderr
+	case "stdout":
+		out = os.Stdout
+	default:
+		f, err := os.OpenFile(opts.Output, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("opening log file: %w", err)
+		}
+		out, closer = f, f
+	}
+
+	Logger.SetLevel(level)
+	Logger.SetFormatter(formatter)
+	Logger.SetOutput(out)
+	redaction.enabled.Store(opts.RedactURLs)
+	redirects.setLimit(opts.RedirectsPerSecond)
+	return closer, nil
+}
+
+// Component returns the logger for a package, tagging its entries with the
+// component name
+func Component(name string) *logrus.Entry {
+	return Logger.WithField("component", name)
+}
@@ -0,0 +1,52 @@
+package logging
+
+import (
+	"sync"
+	"time"
+)
+
+var redirects = &sampler{}
+
+// sampler lets through the first limit events of every second and counts
+// the rest
+type sampler struct {
+	mu      sync.Mutex
+	limit   int
+	second  int64
+	seen    int
+	dropped int
+}
+
+func (s *sampler) setLimit(limit int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.limit = limit
+}
+
+// allow reports whether to log the event and, when it does, how many
+// events were dropped since the last logged one
+func (s *sampler) allow(now time.Time) (bool, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.limit <= 0 {
+		return true, 0
+	}
+	if sec := now.Unix(); sec != s.second {
+		s.second, s.seen = sec, 0
+	}
+	s.seen++
+	if s.seen > s.limit {
+		s.dropped++
+		return false, 0
+	}
+	dropped := s.dropped
+	s.dropped = 0
+	return true, dropped
+}
+
+// SampleRedirect decides whether a successful redirect is logged, under
+// the RedirectsPerSecond cap. It returns the number of redirects left
+// unlogged since the last one that was.
+func SampleRedirect() (bool, int) {
+	return redirects.allow(time.Now())
+}
@@ -1,64 +1,311 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+	"urlshortner/auth"
+	"urlshortner/buildinfo"
+	"urlshortner/cache"
+	"urlshortner/codegen"
 	"urlshortner/config"
 	"urlshortner/database"
+	"urlshortner/expiry"
 	"urlshortner/handlers"
+	"urlshortner/health"
+	"urlshortner/logging"
 	"urlshortner/middleware"
 	"urlshortner/monitoring"
+	"urlshortner/policy"
+	"urlshortner/threat"
+	"urlshortner/tracing"
+	"urlshortner/tracking"
+	"urlshortner/urlnorm"
 	"urlshortner/utils"
 
 	"github.com/gorilla/mux"
+	"github.com/redis/go-redis/v9"
 	"github.com/sirupsen/logrus"
 )
 
-var logger = logrus.New()
-
-func init() {
-	logger.SetFormatter(&logrus.JSONFormatter{})
-	logger.SetLevel(logrus.InfoLevel)
-}
+var logger = logging.Component("main")
 
 func main() {
 	cfg := config.Load()
 
+	logFile, err := logging.Configure(logging.Options{
+		Level:              cfg.LogLevel,
+		Format:             cfg.LogFormat,
+		Output:             cfg.LogOutput,
+		RedactURLs:         cfg.LogRedactURLs,
+		RedirectsPerSecond: cfg.LogRedirectsPerSecond,
+	})
+	if err != nil {
+		logger.WithError(err).Fatal("Invalid logging settings")
+	}
+	if logFile != nil {
+		defer logFile.Close()
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(cfg, os.Args[2:]); err != nil {
+			logger.WithError(err).Fatal("Migration failed")
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "apikey" {
+		if err := runAPIKey(cfg, os.Args[2:]); err != nil {
+			logger.WithError(err).Fatal("API key command failed")
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "export" {
+		if err := runExport(cfg, os.Args[2:]); err != nil {
+			logger.WithError(err).Fatal("Export failed")
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		if err := runImport(cfg, os.Args[2:]); err != nil {
+			logger.WithError(err).Fatal("Import failed")
+		}
+		return
+	}
+
+	if err := cfg.Validate(); err != nil {
+		logger.WithError(err).Fatal("Invalid configuration")
+	}
+
 	logger.WithFields(logrus.Fields{
 		"environment": cfg.Environment,
 		"port":        cfg.Port,
 		"base_url":    cfg.BaseURL,
 	}).Info("Starting URL Shortener server")
 
+	// Tracing is set up first so startup work is traced too
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Options{
+		Exporter:    cfg.TracingExporter,
+		Endpoint:    cfg.TracingEndpoint,
+		Insecure:    cfg.TracingInsecure,
+		SampleRatio: cfg.TracingSampleRatio,
+		ServiceName: cfg.TracingServiceName,
+		Environment: cfg.Environment,
+	})
+	if err != nil {
+		logger.WithError(err).Fatal("Invalid tracing settings")
+	}
+
 	// Initialize database
-	database.InitDB(cfg.DatabaseURL)
+	store := database.Instrument(database.InitDB(cfg.DatabaseURL), monitoring.ObserveQuery, tracing.StoreHook)
+	if database.DB != nil {
+		monitoring.RegisterDB(database.DB)
+	}
+
+	// Hand links that predate ownership to the configured default owner
+	if cfg.DefaultOwner != "" {
+		assignCtx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		n, err := store.AssignUnowned(assignCtx, cfg.DefaultOwner)
+		cancel()
+		if err != nil {
+			logger.WithError(err).Fatal("Failed to assign unowned links")
+		}
+		if n > 0 {
+			logger.WithFields(logrus.Fields{"owner": cfg.DefaultOwner, "links": n}).Info("Assigned unowned links to default owner")
+		}
+	}
+
+	// Hash the destinations of links that predate reuse_existing
+	normalizer := urlnorm.New(utils.SplitList(cfg.URLStripParams), cfg.URLSortQuery)
+	if n, err := backfillDestHashes(store, normalizer); err != nil {
+		logger.WithError(err).Fatal("Failed to backfill destination hashes")
+	} else if n > 0 {
+		logger.WithField("links", n).Info("Backfilled destination hashes")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Background loops outlive the signal until in-flight requests are drained
+	workCtx, stopWork := context.WithCancel(context.Background())
+	defer stopWork()
+	var workers sync.WaitGroup
+	startWorker := func(run func(context.Context)) {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			run(workCtx)
+		}()
+	}
+
+	// Start batched access count writer
+	tracker := tracking.NewAggregator(store, cfg.AccessFlushInterval, cfg.AccessFlushSize)
+	monitoring.Register(tracker)
+	go tracker.Run()
+
+	// Start expired link sweeper
+	archive, err := expiry.ParseMode(cfg.ExpiryMode)
+	if err != nil {
+		logger.WithError(err).Fatal("Invalid EXPIRY_MODE")
+	}
+	sweeper := expiry.NewSweeper(store, cfg.ExpirySweepInterval, cfg.ExpirySweepBatch, archive)
+	monitoring.Register(sweeper)
+	startWorker(sweeper.Run)
+
+	// Redis is optional; without it the cache and rate limiter stay in process
+	var shared cache.SharedCache
+	var redisClient *redis.Client
+	readLimiter := middleware.NewLocalLimiter(cfg.RateLimitReadRPS, cfg.RateLimitReadBurst)
+	writeLimiter := middleware.NewLocalLimiter(cfg.RateLimitWriteRPS, cfg.RateLimitWriteBurst)
+	if cfg.RedisURL != "" {
+		opts, err := redis.ParseURL(cfg.RedisURL)
+		if err != nil {
+			logger.WithError(err).Fatal("Invalid REDIS_URL")
+		}
+		client := redis.NewClient(opts)
+		redisClient = client
+		pingCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+		if err := client.Ping(pingCtx).Err(); err != nil {
+			logger.WithError(err).Warn("Redis unreachable, falling back to in-process cache and rate limiting until it recovers")
+		} else {
+			logger.WithField("addr", opts.Addr).Info("Connected to Redis")
+		}
+		cancel()
+
+		shared = cache.NewRedisCache(client)
+		readLimiter = middleware.NewRedisLimiter(client, cfg.RateLimitReadRPS, cfg.RateLimitReadBurst, readLimiter)
+		writeLimiter = middleware.NewRedisLimiter(client, cfg.RateLimitWriteRPS, cfg.RateLimitWriteBurst, writeLimiter)
+	}
+
+	// Cache hot redirect lookups
+	resolver := cache.NewResolver(store, shared, cfg.CacheSize, cfg.CacheTTL, cfg.CacheNegativeTTL)
+	monitoring.Register(resolver)
+	startWorker(resolver.Listen)
+
+	// Readiness: database reachable with the schema migrated, Redis if configured
+	checker := health.NewChecker(cfg.ReadyCheckTimeout)
+	checker.Add("database", true, store.Ping)
+	if database.Migrations != nil {
+		checker.Add("migrations", true, func(ctx context.Context) error {
+			pending, err := database.Migrations.Pending(ctx)
+			if err != nil {
+				return err
+			}
+			if pending > 0 {
+				return fmt.Errorf("%d migrations pending", pending)
+			}
+			return nil
+		})
+	}
+	if redisClient != nil {
+		checker.Add("redis", cfg.ReadyRequireRedis, func(ctx context.Context) error {
+			return redisClient.Ping(ctx).Err()
+		})
+	}
+
+	authenticator := auth.NewAuthenticator(store)
+
+	// Sequence based generators share one counter, reserved in blocks per instance
+	sequence := codegen.NewBlockSequence(store, "short_code", cfg.CodeSequenceBlock)
+	generator, err := codegen.New(cfg.CodeGenerator, cfg.CodeAlphabet, cfg.CodeLength, cfg.CodeSalt, sequence)
+	if err != nil {
+		logger.WithError(err).Fatal("Invalid short code generator settings")
+	}
+	codes := codegen.NewAllocator(generator, cfg.CodeMaxAttempts)
+	monitoring.Register(codes)
+	if cfg.CodeGenerator == codegen.StrategyHashids && cfg.CodeSalt == "" {
+		logger.Warn("CODE_SALT is empty, hashids codes can be decoded with the public algorithm")
+	}
+
+	// Screen destinations against the local threat feed and re-scan existing links
+	threats := threat.NewFeed(utils.SplitList(cfg.ThreatFeedFiles), cfg.ThreatReloadInterval)
+	if threats.Enabled() {
+		if err := threats.Load(); err != nil {
+			logger.WithError(err).Fatal("Failed to load threat feed")
+		}
+		monitoring.Register(threats)
+		startWorker(threats.Run)
 
-	// Print URLs only in development
-	if cfg.Environment == "development" {
-		utils.PrintAllURLs()
+		scanner := threat.NewScanner(store, threats, cfg.ThreatScanInterval, cfg.ThreatAction, resolver.Invalidate)
+		monitoring.Register(scanner)
+		startWorker(scanner.Run)
 	}
 
+	destinationPolicy, err := loadPolicy(cfg)
+	if err != nil {
+		logger.WithError(err).Fatal("Invalid destination policy")
+	}
+
+	h := handlers.New(handlers.Deps{
+		Store:      store,
+		Resolver:   resolver,
+		Tracker:    tracker,
+		Auth:       authenticator,
+		Normalizer: normalizer,
+		Policy:     destinationPolicy,
+		Threats:    threats,
+		Codes:      codes,
+		Health:     checker,
+		Config:     cfg,
+	})
+
 	// Create router with middleware
 	r := mux.NewRouter()
 
+	trustedProxies, err := middleware.ParseTrustedProxies(cfg.TrustedProxies)
+	if err != nil {
+		logger.WithError(err).Fatal("Invalid TRUSTED_PROXIES")
+	}
+
 	// Global middleware
+	r.Use(middleware.RealIP(trustedProxies))
+	r.Use(middleware.Tracing)
 	r.Use(middleware.RequestLogger)
+	r.Use(middleware.Metrics)
 	r.Use(middleware.SecurityHeaders)
 	r.Use(middleware.CORS)
-	r.Use(middleware.RateLimiter(100)) // 100 requests per second
+	r.Use(middleware.RateLimiter(readLimiter, writeLimiter))
+	r.Use(authenticator.Middleware)
+	r.Use(middleware.KeyRateLimiter(readLimiter, writeLimiter))
 	// Health check endpoint
-	r.HandleFunc("/health", handlers.HealthCheck).Methods("GET")
+	r.HandleFunc("/health", h.HealthCheck).Methods("GET")
+	r.HandleFunc("/livez", h.Livez).Methods("GET")
+	r.HandleFunc("/readyz", h.Readyz).Methods("GET")
 
 	// Monitoring endpoints
-	r.HandleFunc("/metrics", monitoring.MetricsHandler).Methods("GET")
-	r.HandleFunc("/metrics/prometheus", monitoring.PrometheusHandler).Methods("GET")
+	r.HandleFunc("/metrics", monitoring.MetricsHandler(store, cfg.Environment)).Methods("GET")
+	r.HandleFunc("/metrics/prometheus", monitoring.PrometheusHandler()).Methods("GET")
 
 	// API routes
+	requireCreate := auth.Require(auth.ScopeCreate)
+	if cfg.AllowAnonymousCreate {
+		requireCreate = func(next http.Handler) http.Handler { return next }
+	}
+	requireManage := auth.Require(auth.ScopeManage)
+	requireStats := auth.Require(auth.ScopeStats)
+	requireAdmin := auth.Require(auth.ScopeAdmin)
+
 	r.HandleFunc("/shorten", handlers.ServeShortenPage).Methods("GET")
-	r.HandleFunc("/shorten", handlers.CreateShortURL).Methods("POST")
-	r.HandleFunc("/u/{code}", handlers.GetOriginalURL).Methods("GET")
-	r.HandleFunc("/u/{code}", handlers.UpdateShortCode).Methods("PUT")
-	r.HandleFunc("/u/{code}", handlers.DeleteShortURL).Methods("DELETE")
-	r.HandleFunc("/stats/{code}", handlers.GetStats).Methods("GET")
+	r.Handle("/shorten", requireCreate(http.HandlerFunc(h.CreateShortURL))).Methods("POST")
+	r.Handle("/shorten/batch", requireCreate(http.HandlerFunc(h.CreateShortURLBatch))).Methods("POST")
+	r.HandleFunc("/u/{code}", h.GetOriginalURL).Methods("GET")
+	r.Handle("/u/{code}", requireManage(http.HandlerFunc(h.UpdateShortURL))).Methods("PUT", "PATCH")
+	r.Handle("/u/{code}", requireManage(http.HandlerFunc(h.DeleteShortURL))).Methods("DELETE")
+	r.Handle("/stats/{code}", requireStats(http.HandlerFunc(h.GetStats))).Methods("GET")
+	r.Handle("/urls", auth.Authenticated(http.HandlerFunc(h.ListURLs))).Methods("GET")
+	r.Handle("/me/urls", auth.Authenticated(http.HandlerFunc(h.ListMyURLs))).Methods("GET")
+
+	// API key management
+	r.Handle("/admin/export", requireAdmin(http.HandlerFunc(h.ExportURLs))).Methods("GET")
+	r.Handle("/admin/import", requireAdmin(http.HandlerFunc(h.ImportURLs))).Methods("POST")
+	r.Handle("/admin/keys", requireAdmin(http.HandlerFunc(h.CreateAPIKey))).Methods("POST")
+	r.Handle("/admin/keys", requireAdmin(http.HandlerFunc(h.ListAPIKeys))).Methods("GET")
+	r.Handle("/admin/keys/{id}", requireAdmin(http.HandlerFunc(h.RevokeAPIKey))).Methods("DELETE")
 
 	// Serve static files from frontend build
 	if cfg.Environment == "production" {
@@ -66,10 +313,119 @@ func main() {
 		r.PathPrefix("/").Handler(fs)
 	}
 
-	port := ":" + cfg.Port
-	logger.WithField("port", port).Info("Server starting")
+	srv := &http.Server{
+		Addr:              ":" + cfg.Port,
+		Handler:           r,
+		ReadTimeout:       cfg.HTTPReadTimeout,
+		ReadHeaderTimeout: cfg.HTTPReadHeaderTimeout,
+		WriteTimeout:      cfg.HTTPWriteTimeout,
+		IdleTimeout:       cfg.HTTPIdleTimeout,
+	}
+	build := buildinfo.Get()
+	logger.WithFields(logrus.Fields{
+		"port":       srv.Addr,
+		"version":    build.Version,
+		"commit":     build.Commit,
+		"build_time": build.BuildTime,
+	}).Info("Server starting")
 
-	if err := http.ListenAndServe(port, r); err != nil {
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serverErr:
 		logger.WithError(err).Fatal("Server failed to start")
+	case <-ctx.Done():
+	}
+	stop()
+	shutdown(srv, h, cfg, stopWork, &workers, tracker, redisClient, shutdownTracing)
+}
+
+// shutdown fails health checks so load balancers stop routing here, drains
+// in-flight requests, stops the background loops, flushes pending access
+// counts and closes connections, all within SHUTDOWN_TIMEOUT
+func shutdown(srv *http.Server, h *handlers.Handler, cfg *config.Config, stopWork context.CancelFunc, workers *sync.WaitGroup, tracker *tracking.Aggregator, redisClient *redis.Client, shutdownTracing func(context.Context) error) {
+	logger.WithField("drain_delay", cfg.ShutdownDrainDelay.String()).Info("Shutting down, draining connections")
+	h.StartDraining()
+	time.Sleep(cfg.ShutdownDrainDelay)
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	if err := srv.Shutdown(ctx); err != nil {
+		logger.WithError(err).Warn("Requests still running at the shutdown deadline, closing connections")
+		srv.Close()
+	}
+
+	stopWork()
+	done := make(chan struct{})
+	go func() {
+		workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		logger.Warn("Background work still running at the shutdown deadline")
+	}
+
+	if err := tracker.Close(ctx); err != nil {
+		logger.WithError(err).Error("Failed to flush pending access counts")
+	}
+	if redisClient != nil {
+		redisClient.Close()
+	}
+	if err := shutdownTracing(ctx); err != nil {
+		logger.WithError(err).Warn("Failed to flush pending spans")
+	}
+	if database.DB != nil {
+		if err := database.DB.Close(); err != nil {
+			logger.WithError(err).Error("Failed to close database")
+		}
+	}
+	logger.Info("Shutdown complete")
+}
+
+// loadPolicy builds the destination policy from the configured rule file.
+// Links may never point back at BASE_URL or POLICY_SELF_HOSTS.
+func loadPolicy(cfg *config.Config) (*policy.Engine, error) {
+	selfHosts := utils.SplitList(cfg.PolicySelfHosts)
+	if base, err := url.Parse(cfg.BaseURL); err == nil && base.Hostname() != "" {
+		selfHosts = append(selfHosts, base.Hostname())
+	}
+
+	var rules []policy.Rule
+	if cfg.PolicyFile != "" {
+		var err error
+		if rules, err = policy.LoadFile(cfg.PolicyFile); err != nil {
+			return nil, err
+		}
+		logger.WithFields(logrus.Fields{"file": cfg.PolicyFile, "rules": len(rules)}).Info("Loaded destination policy")
+	}
+	return policy.New(selfHosts, rules, cfg.PolicyAllowPrivate), nil
+}
+
+// backfillDestHashes hashes the canonical destination of every link that
+// predates destination hashes, in batches, and returns how many it hashed.
+// Destinations the normalizer rejects are hashed as stored.
+func backfillDestHashes(store database.Store, normalizer *urlnorm.Normalizer) (int, error) {
+	hash := func(url string) string {
+		if normalized, err := normalizer.Normalize(url); err == nil {
+			url = normalized
+		}
+		return utils.URLHash(url)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	total := 0
+	for {
+		n, err := store.BackfillDestHashes(ctx, hash, 500)
+		total += n
+		if err != nil || n < 500 {
+			return total, err
+		}
 	}
 }
@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"urlshortner/monitoring"
+
+	"github.com/gorilla/mux"
+)
+
+// Metrics records request counts and latency per route. Routes are labelled
+// by their mux path template, like /u/{code}, so short codes do not each
+// get their own series. It must be installed with Router.Use so the route
+// is known.
+func Metrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		wrapped := &responseWriterWrapper{ResponseWriter: w, statusCode: http.StatusOK}
+
+		next.ServeHTTP(wrapped, r)
+
+		monitoring.ObserveRequest(routeTemplate(r), r.Method, wrapped.statusCode, time.Since(start))
+	})
+}
+
+func routeTemplate(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if tmpl, err := route.GetPathTemplate(); err == nil {
+			return tmpl
+		}
+	}
+	return "unmatched"
+}
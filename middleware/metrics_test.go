@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestRouteTemplate(t *testing.T) {
+	var route string
+	r := mux.NewRouter()
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			next.ServeHTTP(w, req)
+			route = routeTemplate(req)
+		})
+	})
+	r.HandleFunc("/u/{code}", func(w http.ResponseWriter, r *http.Request) {})
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/u/abc123", nil))
+	if route != "/u/{code}" {
+		t.Errorf("route label %q, want the path template", route)
+	}
+
+	req := httptest.NewRequest("GET", "/elsewhere", nil)
+	if got := routeTemplate(req); got != "unmatched" {
+		t.Errorf("route label outside the router %q, want unmatched", got)
+	}
+}
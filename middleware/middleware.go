@@ -1,64 +1,73 @@
 package middleware
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"net/http"
+	"regexp"
 	"time"
 
+	"urlshortner/logging"
+
 	"github.com/sirupsen/logrus"
-	"golang.org/x/time/rate"
 )
 
-var logger = logrus.New()
-
-func init() {
-	logger.SetFormatter(&logrus.JSONFormatter{})
-	logger.SetLevel(logrus.InfoLevel)
-}
+var logger = logging.Component("middleware")
 
-// RateLimiter middleware to prevent abuse
-func RateLimiter(rps int) func(http.Handler) http.Handler {
-	limiter := rate.NewLimiter(rate.Limit(rps), rps*2) // burst = 2x rate
-
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if !limiter.Allow() {
-				logger.WithFields(logrus.Fields{
-					"ip":     r.RemoteAddr,
-					"method": r.Method,
-					"path":   r.URL.Path,
-				}).Warn("Rate limit exceeded")
-
-				http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
-				return
-			}
-			next.ServeHTTP(w, r)
-		})
-	}
-}
+// requestLogger is the base of every request scoped logger
+var requestLogger = logging.Component("http")
 
-// RequestLogger middleware for structured logging
+// RequestLogger gives every request a logger carrying its request ID, route
+// and method, reachable through logging.FromContext, and logs the request
+// once it completes. The request ID is taken from a well formed X-Request-ID
+// header or generated, and echoed in the response. Successful requests
+// marked with logging.Suppress are not logged.
 func RequestLogger(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 
+		requestID := r.Header.Get("X-Request-ID")
+		if !validRequestID.MatchString(requestID) {
+			requestID = newRequestID()
+		}
+		w.Header().Set("X-Request-ID", requestID)
+
+		ctx := logging.NewContext(r.Context(), requestLogger.WithFields(logrus.Fields{
+			"request_id": requestID,
+			"route":      routeTemplate(r),
+			"method":     r.Method,
+		}))
+		r = r.WithContext(ctx)
+
 		// Create a response writer wrapper to capture status code
 		wrapped := &responseWriterWrapper{ResponseWriter: w, statusCode: http.StatusOK}
 
 		next.ServeHTTP(wrapped, r)
 
+		if wrapped.statusCode < http.StatusBadRequest && logging.Suppressed(ctx) {
+			return
+		}
+
 		duration := time.Since(start)
 
-		logger.WithFields(logrus.Fields{
-			"method":      r.Method,
+		logging.FromContext(ctx).WithFields(logrus.Fields{
 			"path":        r.URL.Path,
 			"status_code": wrapped.statusCode,
 			"duration_ms": duration.Milliseconds(),
-			"ip":          r.RemoteAddr,
+			"ip":          ClientIP(r),
 			"user_agent":  r.UserAgent(),
 		}).Info("Request completed")
 	})
 }
 
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+func newRequestID() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
 type responseWriterWrapper struct {
 	http.ResponseWriter
 	statusCode int
@@ -69,12 +78,18 @@ func (w *responseWriterWrapper) WriteHeader(statusCode int) {
 	w.ResponseWriter.WriteHeader(statusCode)
 }
 
+// Unwrap lets http.ResponseController reach the underlying connection
+func (w *responseWriterWrapper) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
 // CORS middleware for cross-origin requests
 func CORS(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Request-ID")
+		w.Header().Set("Access-Control-Expose-Headers", "RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset, Retry-After, X-Request-ID")
 
 		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusOK)
@@ -0,0 +1,248 @@
+package middleware
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"urlshortner/auth"
+	"urlshortner/logging"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/time/rate"
+)
+
+// Decision is the outcome of a rate limit check
+type Decision struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is how long until the bucket is full again
+	Reset time.Duration
+	// RetryAfter is how long until the next request would be allowed
+	RetryAfter time.Duration
+}
+
+// Limiter decides whether a request identified by key may proceed
+type Limiter interface {
+	Allow(ctx context.Context, key string) Decision
+}
+
+// RateLimiter middleware to prevent abuse. Each client IP gets its own
+// bucket; write requests (POST, PUT, PATCH, DELETE) are checked against the
+// write limiter and everything else against the read limiter. It runs before
+// the Authenticator middleware so made-up API keys cannot be used to trigger
+// key lookups faster than the limit allows.
+func RateLimiter(read, write Limiter) func(http.Handler) http.Handler {
+	return limit(read, write, func(r *http.Request) (string, bool) {
+		return "ip:" + ClientIP(r), true
+	})
+}
+
+// KeyRateLimiter gives each API key its own read and write buckets on top of
+// the per-IP ones. It must run after the Authenticator middleware; requests
+// without a valid key pass through, having been limited by IP already.
+func KeyRateLimiter(read, write Limiter) func(http.Handler) http.Handler {
+	return limit(read, write, func(r *http.Request) (string, bool) {
+		p, ok := auth.FromContext(r.Context())
+		if !ok {
+			return "", false
+		}
+		return "key:" + strconv.Itoa(p.KeyID), true
+	})
+}
+
+// limit checks each request against the bucket clientKey names for it and
+// skips requests it returns false for
+func limit(read, write Limiter, clientKey func(*http.Request) (string, bool)) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			client, ok := clientKey(r)
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+			limiter, class := read, "read"
+			if isWrite(r.Method) {
+				limiter, class = write, "write"
+			}
+
+			key := class + ":" + client
+			ctx, span := tracer.Start(r.Context(), "ratelimit.Allow", trace.WithAttributes(attribute.String("ratelimit.class", class)))
+			d := limiter.Allow(ctx, key)
+			span.SetAttributes(attribute.Bool("ratelimit.allowed", d.Allowed))
+			span.End()
+
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(d.Limit))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(d.Remaining))
+			w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(d.Reset)))
+
+			if !d.Allowed {
+				logging.FromContext(r.Context()).WithFields(logrus.Fields{
+					"ip":     ClientIP(r),
+					"client": client,
+					"class":  class,
+					"path":   r.URL.Path,
+				}).Warn("Rate limit exceeded")
+
+				w.Header().Set("Retry-After", strconv.Itoa(max(1, ceilSeconds(d.RetryAfter))))
+				http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func isWrite(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// decision derives the response headers from the tokens left in a bucket
+func decision(allowed bool, tokens float64, rps, burst int) Decision {
+	d := Decision{
+		Allowed:   allowed,
+		Limit:     burst,
+		Remaining: max(0, int(math.Floor(tokens))),
+		Reset:     time.Duration((float64(burst) - tokens) / float64(rps) * float64(time.Second)),
+	}
+	if !allowed {
+		d.RetryAfter = time.Duration((1 - tokens) / float64(rps) * float64(time.Second))
+	}
+	return d
+}
+
+// localLimiter keeps one in-process token bucket per key, dropping buckets
+// that have been idle for longer than idleTTL
+type localLimiter struct {
+	rps     int
+	burst   int
+	idleTTL time.Duration
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// NewLocalLimiter returns an in-process limiter allowing each key rps
+// requests per second with the given burst
+func NewLocalLimiter(rps, burst int) Limiter {
+	return &localLimiter{
+		rps:       rps,
+		burst:     burst,
+		idleTTL:   10 * time.Minute,
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+	}
+}
+
+func (l *localLimiter) Allow(ctx context.Context, key string) Decision {
+	now := time.Now()
+
+	l.mu.Lock()
+	if now.Sub(l.lastSweep) > time.Minute {
+		for k, b := range l.buckets {
+			if now.Sub(b.lastSeen) > l.idleTTL {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastSweep = now
+	}
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{limiter: rate.NewLimiter(rate.Limit(l.rps), l.burst)}
+		l.buckets[key] = b
+	}
+	b.lastSeen = now
+	l.mu.Unlock()
+
+	allowed := b.limiter.AllowN(now, 1)
+	return decision(allowed, b.limiter.TokensAt(now), l.rps, l.burst)
+}
+
+// tokenBucketScript refills the bucket stored at KEYS[1] using the Redis
+// server clock, so replicas with skewed clocks still share one rate, then
+// tries to take a token. ARGV: rate per second, burst. Returns whether the
+// token was taken and the tokens left.
+var tokenBucketScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+local bucket = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(bucket[1]) or burst
+local ts = tonumber(bucket[2]) or now
+
+tokens = math.min(burst, tokens + math.max(0, now - ts) * rate / 1000)
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil(burst / rate * 1000) + 1000)
+return {allowed, tostring(tokens)}
+`)
+
+// RedisLimiter keeps per-key token buckets in Redis so every replica shares
+// them. When Redis cannot be reached it defers to the fallback limiter.
+type RedisLimiter struct {
+	client   *redis.Client
+	rps      int
+	burst    int
+	fallback Limiter
+
+	errors   atomic.Int64
+	lastWarn atomic.Int64
+}
+
+// NewRedisLimiter creates a cluster-wide limiter of rps requests per second per key
+func NewRedisLimiter(client *redis.Client, rps, burst int, fallback Limiter) *RedisLimiter {
+	return &RedisLimiter{client: client, rps: rps, burst: burst, fallback: fallback}
+}
+
+func (l *RedisLimiter) Allow(ctx context.Context, key string) Decision {
+	ctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+
+	res, err := tokenBucketScript.Run(ctx, l.client, []string{"urlshortener:ratelimit:" + key}, l.rps, l.burst).Slice()
+	if err == nil && len(res) != 2 {
+		err = redis.Nil
+	}
+	if err != nil {
+		l.errors.Add(1)
+		// Avoid flooding the log while Redis is down
+		now := time.Now().Unix()
+		if last := l.lastWarn.Load(); now-last >= 30 && l.lastWarn.CompareAndSwap(last, now) {
+			logger.WithError(err).Warn("Redis rate limiter unavailable, using in-process limiter")
+		}
+		return l.fallback.Allow(ctx, key)
+	}
+
+	allowed, _ := res[0].(int64)
+	tokensStr, _ := res[1].(string)
+	tokens, _ := strconv.ParseFloat(tokensStr, 64)
+	return decision(allowed == 1, tokens, l.rps, l.burst)
+}
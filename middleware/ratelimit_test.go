@@ -0,0 +1,121 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"urlshortner/auth"
+)
+
+func TestLocalLimiterBurstThenRejects(t *testing.T) {
+	l := NewLocalLimiter(1, 3)
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		if d := l.Allow(ctx, "a"); !d.Allowed {
+			t.Fatalf("request %d rejected within burst", i+1)
+		}
+	}
+	d := l.Allow(ctx, "a")
+	if d.Allowed {
+		t.Fatal("request beyond burst allowed")
+	}
+	if d.RetryAfter <= 0 || d.RetryAfter > time.Second {
+		t.Errorf("RetryAfter = %v, want within (0, 1s]", d.RetryAfter)
+	}
+	if d := l.Allow(ctx, "b"); !d.Allowed {
+		t.Error("separate key shares the exhausted bucket")
+	}
+}
+
+func TestDecisionTimings(t *testing.T) {
+	d := decision(false, 0.5, 1, 10)
+	if d.Remaining != 0 || d.Limit != 10 {
+		t.Errorf("got Remaining %d Limit %d, want 0 and 10", d.Remaining, d.Limit)
+	}
+	if d.Reset != 9500*time.Millisecond {
+		t.Errorf("Reset = %v, want 9.5s", d.Reset)
+	}
+	if d.RetryAfter != 500*time.Millisecond {
+		t.Errorf("RetryAfter = %v, want 500ms", d.RetryAfter)
+	}
+}
+
+func TestRateLimiterSplitsReadsAndWrites(t *testing.T) {
+	handler := RateLimiter(NewLocalLimiter(100, 100), NewLocalLimiter(1, 1))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	serve := func(method string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/shorten", nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := serve(http.MethodPost); rec.Code != http.StatusNoContent {
+		t.Fatalf("first write: status %d", rec.Code)
+	}
+	rec := serve(http.MethodPost)
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("second write: status %d, want 429", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") == "" || rec.Header().Get("RateLimit-Limit") != "1" {
+		t.Errorf("missing rate limit headers: %v", rec.Header())
+	}
+	if rec := serve(http.MethodGet); rec.Code != http.StatusNoContent {
+		t.Errorf("read after exhausted writes: status %d", rec.Code)
+	}
+}
+
+func TestRateLimiterIgnoresPresentedKeys(t *testing.T) {
+	handler := RateLimiter(NewLocalLimiter(1, 1), NewLocalLimiter(1, 1))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	codes := make([]int, 0, 2)
+	for _, key := range []string{"usk_made_up_1", "usk_made_up_2"} {
+		req := httptest.NewRequest(http.MethodGet, "/stats/abc", nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		req.Header.Set("Authorization", "Bearer "+key)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		codes = append(codes, rec.Code)
+	}
+	if codes[0] != http.StatusNoContent || codes[1] != http.StatusTooManyRequests {
+		t.Errorf("statuses %v, want a fresh key to share the IP's bucket", codes)
+	}
+}
+
+func TestKeyRateLimiterBucketsPerKey(t *testing.T) {
+	handler := KeyRateLimiter(NewLocalLimiter(1, 1), NewLocalLimiter(1, 1))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	serve := func(p *auth.Principal) int {
+		req := httptest.NewRequest(http.MethodGet, "/stats/abc", nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		if p != nil {
+			req = req.WithContext(auth.WithPrincipal(req.Context(), p))
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	alice, bob := &auth.Principal{KeyID: 1, Owner: "alice"}, &auth.Principal{KeyID: 2, Owner: "bob"}
+	if code := serve(alice); code != http.StatusNoContent {
+		t.Fatalf("first request with a key: status %d", code)
+	}
+	if code := serve(alice); code != http.StatusTooManyRequests {
+		t.Errorf("second request with the same key: status %d, want 429", code)
+	}
+	if code := serve(bob); code != http.StatusNoContent {
+		t.Errorf("another key from the same IP: status %d, want its own bucket", code)
+	}
+	for i := 0; i < 2; i++ {
+		if code := serve(nil); code != http.StatusNoContent {
+			t.Errorf("request without a key: status %d, want it left to the IP limiter", code)
+		}
+	}
+}
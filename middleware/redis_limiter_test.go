@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestRedisLimiterSharesBucketsAcrossReplicas(t *testing.T) {
+	ctx := context.Background()
+	srv := miniredis.RunT(t)
+	var replicas []*RedisLimiter
+	for i := 0; i < 2; i++ {
+		client := redis.NewClient(&redis.Options{Addr: srv.Addr()})
+		t.Cleanup(func() { client.Close() })
+		replicas = append(replicas, NewRedisLimiter(client, 1, 4, NewLocalLimiter(1, 4)))
+	}
+
+	allowed := 0
+	for i := 0; i < 8; i++ {
+		if replicas[i%2].Allow(ctx, "write:ip:192.0.2.1").Allowed {
+			allowed++
+		}
+	}
+	if allowed != 4 {
+		t.Errorf("replicas allowed %d requests together, want the shared burst of 4", allowed)
+	}
+	if d := replicas[0].Allow(ctx, "write:ip:192.0.2.2"); !d.Allowed || d.Remaining != 3 {
+		t.Errorf("other client: %+v, want a fresh bucket", d)
+	}
+	for _, r := range replicas {
+		if n := r.errors.Load(); n != 0 {
+			t.Errorf("limiter counted %d Redis errors", n)
+		}
+	}
+}
+
+func TestRedisLimiterFallsBackWhenRedisIsDown(t *testing.T) {
+	ctx := context.Background()
+	srv := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: srv.Addr(), MaxRetries: -1})
+	t.Cleanup(func() { client.Close() })
+	l := NewRedisLimiter(client, 1, 2, NewLocalLimiter(1, 2))
+	srv.Close()
+
+	var results []bool
+	for i := 0; i < 3; i++ {
+		results = append(results, l.Allow(ctx, "read:ip:192.0.2.1").Allowed)
+	}
+	if !results[0] || !results[1] || results[2] {
+		t.Errorf("fallback decisions %v, want the local burst of 2 then a rejection", results)
+	}
+	if l.errors.Load() != 3 {
+		t.Errorf("counted %d Redis errors, want 3", l.errors.Load())
+	}
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// APIKey is a credential for the write API. Only a hash of the secret is
+// stored; Prefix lets users tell their keys apart. Links created with the key
+// belong to Owner, which several keys may share.
+type APIKey struct {
+	ID        int        `json:"id"`
+	Name      string     `json:"name"`
+	Owner     string     `json:"owner"`
+	Prefix    string     `json:"prefix"`
+	Scopes    []string   `json:"scopes"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
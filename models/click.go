@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// ClickEvent is a single redirect through a short URL
+type ClickEvent struct {
+	URLID        int       `json:"-"`
+	ClickedAt    time.Time `json:"clicked_at"`
+	ReferrerHost string    `json:"referrer_host"`
+	Browser      string    `json:"browser"`
+	OS           string    `json:"os"`
+	Device       string    `json:"device"`
+	IP           string    `json:"ip"`
+	Country      string    `json:"country,omitempty"`
+}
+
+// BucketCount is the number of clicks in one time bucket
+type BucketCount struct {
+	Bucket string `json:"bucket"`
+	Count  int    `json:"count"`
+}
+
+// ReferrerCount is the number of clicks coming from one referrer host
+type ReferrerCount struct {
+	Referrer string `json:"referrer"`
+	Count    int    `json:"count"`
+}
+
+// ClickStats aggregates click events for one short URL
+type ClickStats struct {
+	Clicks       []BucketCount   `json:"clicks"`
+	TopReferrers []ReferrerCount `json:"top_referrers"`
+}
@@ -1,8 +1,37 @@
 package models
 
+import "time"
+
 type URL struct {
-	ID         int    `json:"id"`
-	URL        string `json:"url"`
-	ShortCode  string `json:"short_code"`
-	AccessCount int   `json:"access_count"`
+	ID          int        `json:"id"`
+	URL         string     `json:"url"`
+	ShortCode   string     `json:"short_code"`
+	AccessCount int        `json:"access_count"`
+	CreatedAt   time.Time  `json:"created_at,omitzero"`
+	UpdatedAt   time.Time  `json:"updated_at,omitzero"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	Owner       string     `json:"owner,omitempty"`
+	Title       string     `json:"title,omitempty"`
+	// ThreatStatus is set by the threat re-scan when the destination is
+	// listed, ThreatMatch names the entry that listed it
+	ThreatStatus string `json:"threat_status,omitempty"`
+	ThreatMatch  string `json:"threat_match,omitempty"`
+
+	// DestHash identifies the canonical destination of links whose code was
+	// generated, so later requests for the same destination can reuse them
+	DestHash      string `json:"-"`
+	GeneratedCode bool   `json:"-"`
+}
+
+// Threat statuses of a link
+const (
+	// ThreatFlagged links still redirect but are marked for review
+	ThreatFlagged = "flagged"
+	// ThreatDisabled links show a warning page instead of redirecting
+	ThreatDisabled = "disabled"
+)
+
+// IsExpired reports whether the link has an expiry that is not after now
+func (u *URL) IsExpired(now time.Time) bool {
+	return u.ExpiresAt != nil && !u.ExpiresAt.After(now)
 }
@@ -0,0 +1,41 @@
+package monitoring
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	reportersMu sync.RWMutex
+	reporters   []Reporter
+)
+
+// Reporter is implemented by collectors that also want a section in the
+// JSON metrics output
+type Reporter interface {
+	Report() (name string, value interface{})
+}
+
+// Register adds a background component's collector to Registry, and to
+// MetricsHandler if it is also a Reporter
+func Register(c prometheus.Collector) {
+	Registry.MustRegister(c)
+	if r, ok := c.(Reporter); ok {
+		reportersMu.Lock()
+		defer reportersMu.Unlock()
+		reporters = append(reporters, r)
+	}
+}
+
+func collectReports() map[string]interface{} {
+	reportersMu.RLock()
+	defer reportersMu.RUnlock()
+
+	reports := make(map[string]interface{})
+	for _, r := range reporters {
+		name, value := r.Report()
+		reports[name] = value
+	}
+	return reports
+}
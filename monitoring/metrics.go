@@ -1,28 +1,26 @@
 package monitoring
 
 import (
+	"context"
 	"encoding/json"
-	"fmt"
 	"net/http"
 	"runtime"
 	"time"
 
+	"urlshortner/buildinfo"
 	"urlshortner/database"
+	"urlshortner/logging"
 
-	"github.com/sirupsen/logrus"
+	"github.com/prometheus/common/expfmt"
 )
 
-var logger = logrus.New()
-
-func init() {
-	logger.SetFormatter(&logrus.JSONFormatter{})
-	logger.SetLevel(logrus.InfoLevel)
-}
+var logger = logging.Component("monitoring")
 
 type MetricsResponse struct {
-	System   SystemMetrics   `json:"system"`
-	Database DatabaseMetrics `json:"database"`
-	App      AppMetrics      `json:"app"`
+	System     SystemMetrics          `json:"system"`
+	Database   DatabaseMetrics        `json:"database"`
+	App        AppMetrics             `json:"app"`
+	Components map[string]interface{} `json:"components,omitempty"`
 }
 
 type SystemMetrics struct {
@@ -44,6 +42,8 @@ type DatabaseMetrics struct {
 
 type AppMetrics struct {
 	Version     string    `json:"version"`
+	Commit      string    `json:"commit"`
+	BuildTime   string    `json:"build_time"`
 	Environment string    `json:"environment"`
 	Timestamp   time.Time `json:"timestamp"`
 }
@@ -51,11 +51,19 @@ type AppMetrics struct {
 var startTime = time.Now()
 
 // MetricsHandler provides detailed application metrics
-func MetricsHandler(w http.ResponseWriter, r *http.Request) {
+func MetricsHandler(store database.Store, environment string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		defer cancel()
+
+		writeMetrics(w, store.Stats(ctx), environment)
+	}
+}
+
+func writeMetrics(w http.ResponseWriter, stats database.Stats, environment string) {
 	var m runtime.MemStats
 	runtime.ReadMemStats(&m)
-
-	stats := database.DB.Stats()
+	build := buildinfo.Get()
 
 	metrics := MetricsResponse{
 		System: SystemMetrics{
@@ -68,16 +76,19 @@ func MetricsHandler(w http.ResponseWriter, r *http.Request) {
 			NumGC:         m.NumGC,
 		},
 		Database: DatabaseMetrics{
-			Connected:  database.DB.Ping() == nil,
+			Connected:  stats.Connected,
 			OpenConns:  stats.OpenConnections,
 			InUseConns: stats.InUse,
 			IdleConns:  stats.Idle,
 		},
 		App: AppMetrics{
-			Version:     "1.0.0",
-			Environment: "production", // This should come from config
+			Version:     build.Version,
+			Commit:      build.Commit,
+			BuildTime:   build.BuildTime,
+			Environment: environment,
 			Timestamp:   time.Now().UTC(),
 		},
+		Components: collectReports(),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -88,47 +99,25 @@ func bToMb(b uint64) uint64 {
 	return b / 1024 / 1024
 }
 
-// PrometheusHandler provides metrics in Prometheus format
-func PrometheusHandler(w http.ResponseWriter, r *http.Request) {
-	var m runtime.MemStats
-	runtime.ReadMemStats(&m)
-
-	stats := database.DB.Stats()
-	uptime := time.Since(startTime).Seconds()
-
-	w.Header().Set("Content-Type", "text/plain")
-	w.WriteHeader(http.StatusOK)
-
-	metrics := `# HELP urlshortener_uptime_seconds Total uptime in seconds
-# TYPE urlshortener_uptime_seconds counter
-urlshortener_uptime_seconds %f
-
-# HELP urlshortener_memory_alloc_bytes Currently allocated memory in bytes
-# TYPE urlshortener_memory_alloc_bytes gauge
-urlshortener_memory_alloc_bytes %d
-
-# HELP urlshortener_goroutines Number of goroutines
-# TYPE urlshortener_goroutines gauge
-urlshortener_goroutines %d
-
-# HELP urlshortener_db_connections Database connection pool stats
-# TYPE urlshortener_db_connections gauge
-urlshortener_db_connections{state="open"} %d
-urlshortener_db_connections{state="in_use"} %d
-urlshortener_db_connections{state="idle"} %d
-
-# HELP urlshortener_gc_count Total number of garbage collections
-# TYPE urlshortener_gc_count counter
-urlshortener_gc_count %d
-`
-
-	w.Write([]byte(fmt.Sprintf(metrics,
-		uptime,
-		m.Alloc,
-		runtime.NumGoroutine(),
-		stats.OpenConnections,
-		stats.InUse,
-		stats.Idle,
-		m.NumGC,
-	)))
+// PrometheusHandler serves Registry in the Prometheus text format
+func PrometheusHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		families, err := Registry.Gather()
+		if err != nil {
+			// Gather still returns every metric it could collect
+			logger.WithError(err).Warn("Error gathering metrics")
+		}
+
+		format := expfmt.NewFormat(expfmt.TypeTextPlain)
+		w.Header().Set("Content-Type", string(format))
+		w.WriteHeader(http.StatusOK)
+
+		enc := expfmt.NewEncoder(w, format)
+		for _, family := range families {
+			if err := enc.Encode(family); err != nil {
+				logger.WithError(err).Error("Error writing metrics")
+				return
+			}
+		}
+	}
 }
@@ -0,0 +1,129 @@
+package monitoring
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"time"
+
+	"urlshortner/buildinfo"
+	"urlshortner/database"
+
+	"github.com/prometheus/client_golang/prometheus"
+	promcollectors "github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+// Registry holds the metrics served by PrometheusHandler, including the
+// collectors of background components added with Register
+var Registry = prometheus.NewRegistry()
+
+// Redirect outcomes counted by RecordRedirect
+const (
+	RedirectHit     = "hit"
+	RedirectMiss    = "miss"
+	RedirectExpired = "expired"
+	RedirectBlocked = "blocked"
+	RedirectError   = "error"
+)
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "urlshortener_http_requests_total",
+		Help: "HTTP requests by route template, method and status code",
+	}, []string{"route", "method", "status"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "urlshortener_http_request_duration_seconds",
+		Help:    "HTTP request latency by route template, method and status code",
+		Buckets: []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+	}, []string{"route", "method", "status"})
+
+	redirects = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "urlshortener_redirects_total",
+		Help: "Short link lookups by outcome: hit, miss, expired, blocked or error",
+	}, []string{"result"})
+
+	linksCreated = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "urlshortener_links_created_total",
+		Help: "Links created by code generation mode: the generator strategy, custom or import",
+	}, []string{"mode"})
+
+	dbDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "urlshortener_db_query_duration_seconds",
+		Help:    "Store operation latency by operation and outcome",
+		Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 5},
+	}, []string{"operation", "outcome"})
+
+	buildInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "urlshortener_build_info",
+		Help: "Build of the running binary",
+	}, []string{"version", "commit", "go_version"})
+)
+
+func init() {
+	Registry.MustRegister(
+		promcollectors.NewGoCollector(),
+		promcollectors.NewProcessCollector(promcollectors.ProcessCollectorOpts{}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "urlshortener_uptime_seconds",
+			Help: "Seconds since the process started",
+		}, func() float64 { return time.Since(startTime).Seconds() }),
+		httpRequests,
+		httpDuration,
+		redirects,
+		linksCreated,
+		dbDuration,
+		buildInfo,
+	)
+
+	build := buildinfo.Get()
+	buildInfo.WithLabelValues(build.Version, build.Commit, build.GoVersion).Set(1)
+}
+
+// RegisterDB adds the connection pool statistics of db
+func RegisterDB(db *sql.DB) {
+	Registry.MustRegister(promcollectors.NewDBStatsCollector(db, "urlshortener"))
+}
+
+// ObserveRequest records one served request. route is the mux path
+// template, so every short code lands in the same series.
+func ObserveRequest(route, method string, status int, d time.Duration) {
+	code := strconv.Itoa(status)
+	httpRequests.WithLabelValues(route, method, code).Inc()
+	httpDuration.WithLabelValues(route, method, code).Observe(d.Seconds())
+}
+
+// RecordRedirect counts a short link lookup by outcome
+func RecordRedirect(result string) {
+	redirects.WithLabelValues(result).Inc()
+}
+
+// RecordLinksCreated counts n new links created in the given mode
+func RecordLinksCreated(mode string, n int) {
+	if n > 0 {
+		linksCreated.WithLabelValues(mode).Add(float64(n))
+	}
+}
+
+// ObserveQuery is a database.Hook timing every Store operation
+func ObserveQuery(ctx context.Context, op string) (context.Context, func(error)) {
+	start := time.Now()
+	return ctx, func(err error) {
+		dbDuration.WithLabelValues(op, queryOutcome(err)).Observe(time.Since(start).Seconds())
+	}
+}
+
+func queryOutcome(err error) string {
+	switch {
+	case err == nil:
+		return "ok"
+	case errors.Is(err, database.ErrNotFound):
+		return "not_found"
+	case errors.Is(err, database.ErrConflict):
+		return "conflict"
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+		return "timeout"
+	}
+	return "error"
+}
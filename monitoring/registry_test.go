@@ -0,0 +1,96 @@
+package monitoring
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"urlshortner/database"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCounters(t *testing.T) {
+	before := testutil.ToFloat64(redirects.WithLabelValues(RedirectExpired))
+	RecordRedirect(RedirectExpired)
+	if got := testutil.ToFloat64(redirects.WithLabelValues(RedirectExpired)); got != before+1 {
+		t.Errorf("expired redirects = %v, want %v", got, before+1)
+	}
+
+	before = testutil.ToFloat64(linksCreated.WithLabelValues("import"))
+	RecordLinksCreated("import", 3)
+	RecordLinksCreated("import", 0)
+	if got := testutil.ToFloat64(linksCreated.WithLabelValues("import")); got != before+3 {
+		t.Errorf("imported links = %v, want %v", got, before+3)
+	}
+
+	before = testutil.ToFloat64(httpRequests.WithLabelValues("/u/{code}", "GET", "302"))
+	ObserveRequest("/u/{code}", "GET", 302, 2*time.Millisecond)
+	if got := testutil.ToFloat64(httpRequests.WithLabelValues("/u/{code}", "GET", "302")); got != before+1 {
+		t.Errorf("requests = %v, want %v", got, before+1)
+	}
+}
+
+func TestQueryOutcome(t *testing.T) {
+	tests := map[error]string{
+		nil:                  "ok",
+		database.ErrNotFound: "not_found",
+		fmt.Errorf("wrapped: %w", database.ErrConflict): "conflict",
+		context.DeadlineExceeded:                        "timeout",
+		context.Canceled:                                "timeout",
+		errors.New("disk full"):                         "error",
+	}
+	for err, want := range tests {
+		if got := queryOutcome(err); got != want {
+			t.Errorf("queryOutcome(%v) = %q, want %q", err, got, want)
+		}
+	}
+
+	_, done := ObserveQuery(context.Background(), "test.Op")
+	done(database.ErrNotFound)
+	if n := testutil.CollectAndCount(dbDuration, "urlshortener_db_query_duration_seconds"); n == 0 {
+		t.Error("no query latency recorded")
+	}
+}
+
+type reportingGauge struct {
+	prometheus.GaugeFunc
+}
+
+func (reportingGauge) Report() (string, interface{}) {
+	return "test_collector", 1
+}
+
+func TestPrometheusHandler(t *testing.T) {
+	Register(reportingGauge{prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "urlshortener_test_collector",
+		Help: "Collector registered by the test",
+	}, func() float64 { return 1 })})
+	RecordRedirect(RedirectHit)
+
+	rec := httptest.NewRecorder()
+	PrometheusHandler()(rec, httptest.NewRequest("GET", "/metrics/prometheus", nil))
+	body := rec.Body.String()
+	if !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain") {
+		t.Errorf("content type %q", rec.Header().Get("Content-Type"))
+	}
+	for _, want := range []string{
+		`urlshortener_redirects_total{result="hit"}`,
+		"urlshortener_build_info{",
+		"urlshortener_uptime_seconds",
+		"go_goroutines",
+		"urlshortener_test_collector 1",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics output lacks %s", want)
+		}
+	}
+	if _, ok := collectReports()["test_collector"]; !ok {
+		t.Error("registered Reporter missing from the JSON components")
+	}
+}
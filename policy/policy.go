@@ -0,0 +1,202 @@
+package policy
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Built-in rule names reported in a Violation
+const (
+	RulePrivateAddress = "private_address"
+	RuleSelfReference  = "self_reference"
+	RuleNotAllowed     = "not_in_allowlist"
+)
+
+// Violation explains which rule rejected a destination
+type Violation struct {
+	Rule   string
+	Reason string
+}
+
+func (v *Violation) Error() string {
+	return fmt.Sprintf("destination not allowed: %s (rule %s)", v.Reason, v.Rule)
+}
+
+// Rule allows or denies destination hosts matching a pattern. Patterns are
+// matched against the whole host name and may contain * wildcards, so
+// "*.example.com" covers every subdomain of example.com but not the domain
+// itself.
+type Rule struct {
+	Allow   bool
+	Pattern string
+	// Source locates the rule for error messages, e.g. "policy.txt:3"
+	Source string
+}
+
+func (r Rule) name() string {
+	action := "deny"
+	if r.Allow {
+		action = "allow"
+	}
+	if r.Source == "" {
+		return action + " " + r.Pattern
+	}
+	return action + " " + r.Pattern + " (" + r.Source + ")"
+}
+
+// Engine decides whether a destination URL may be shortened. Deny rules
+// win over allow rules, and once any allow rule exists only matching hosts
+// are accepted.
+type Engine struct {
+	allowPrivate bool
+	selfHosts    map[string]bool
+	allow        []Rule
+	deny         []Rule
+}
+
+// New creates an Engine. selfHosts are the host names this service answers
+// on; links to them would redirect back into the shortener.
+func New(selfHosts []string, rules []Rule, allowPrivate bool) *Engine {
+	e := &Engine{allowPrivate: allowPrivate, selfHosts: make(map[string]bool)}
+	for _, h := range selfHosts {
+		if h = strings.ToLower(strings.TrimSuffix(h, ".")); h != "" {
+			e.selfHosts[h] = true
+		}
+	}
+	for _, r := range rules {
+		r.Pattern = strings.ToLower(r.Pattern)
+		if r.Allow {
+			e.allow = append(e.allow, r)
+		} else {
+			e.deny = append(e.deny, r)
+		}
+	}
+	return e
+}
+
+// LoadFile reads rules from a file with one "allow <pattern>" or
+// "deny <pattern>" per line. Blank lines and lines starting with # are
+// ignored.
+func LoadFile(file string) ([]Rule, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var rules []Rule
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 2 || (fields[0] != "allow" && fields[0] != "deny") {
+			return nil, fmt.Errorf("%s:%d: expected \"allow <pattern>\" or \"deny <pattern>\"", file, line)
+		}
+		if _, err := path.Match(fields[1], ""); err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid pattern %q", file, line, fields[1])
+		}
+		rules = append(rules, Rule{
+			Allow:   fields[0] == "allow",
+			Pattern: fields[1],
+			Source:  fmt.Sprintf("%s:%d", path.Base(file), line),
+		})
+	}
+	return rules, scanner.Err()
+}
+
+// Check returns a *Violation when the normalized URL rawURL may not be
+// shortened
+func (e *Engine) Check(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return &Violation{Rule: RulePrivateAddress, Reason: "unparseable host"}
+	}
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+
+	if !e.allowPrivate && isLocal(host) {
+		return &Violation{Rule: RulePrivateAddress, Reason: "private, loopback or link-local address"}
+	}
+	if e.selfHosts[host] {
+		return &Violation{Rule: RuleSelfReference, Reason: "links to this service would loop"}
+	}
+	for _, r := range e.deny {
+		if matches(r.Pattern, host) {
+			return &Violation{Rule: r.name(), Reason: "host is on the denylist"}
+		}
+	}
+	if len(e.allow) == 0 {
+		return nil
+	}
+	for _, r := range e.allow {
+		if matches(r.Pattern, host) {
+			return nil
+		}
+	}
+	return &Violation{Rule: RuleNotAllowed, Reason: "host is not on the allowlist"}
+}
+
+func matches(pattern, host string) bool {
+	ok, _ := path.Match(pattern, host)
+	return ok
+}
+
+// cgnat is the carrier-grade NAT range, not covered by net.IP.IsPrivate
+var cgnat = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// isLocal reports whether host names this machine or a non-public network
+func isLocal(host string) bool {
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		// Browsers also accept IPv4 in decimal, octal or hex parts
+		if ip = parseLegacyIPv4(host); ip == nil {
+			return false
+		}
+	}
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() ||
+		ip.IsUnspecified() || cgnat.Contains(ip)
+}
+
+// parseLegacyIPv4 parses inet_aton style addresses such as "2130706433",
+// "0x7f.1" or "0177.0.0.1", returning nil for anything else
+func parseLegacyIPv4(host string) net.IP {
+	parts := strings.Split(host, ".")
+	if len(parts) > 4 {
+		return nil
+	}
+	values := make([]uint64, len(parts))
+	for i, p := range parts {
+		v, err := strconv.ParseUint(p, 0, 32)
+		if err != nil {
+			return nil
+		}
+		values[i] = v
+	}
+
+	// The last part fills all remaining bytes
+	var addr uint64
+	for i, v := range values[:len(values)-1] {
+		if v > 255 {
+			return nil
+		}
+		addr |= v << (24 - 8*i)
+	}
+	last := values[len(values)-1]
+	if last >= 1<<(8*(5-len(values))) {
+		return nil
+	}
+	addr |= last
+	return net.IPv4(byte(addr>>24), byte(addr>>16), byte(addr>>8), byte(addr))
+}
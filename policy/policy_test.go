@@ -0,0 +1,94 @@
+package policy
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckBuiltInRules(t *testing.T) {
+	e := New([]string{"Sho.rt."}, nil, false)
+	tests := []struct {
+		url  string
+		rule string
+	}{
+		{"https://example.com/", ""},
+		{"http://localhost:8080/", RulePrivateAddress},
+		{"http://api.localhost/", RulePrivateAddress},
+		{"http://10.1.2.3/", RulePrivateAddress},
+		{"http://100.64.0.1/", RulePrivateAddress},
+		{"http://[::1]/", RulePrivateAddress},
+		{"http://169.254.169.254/latest/meta-data", RulePrivateAddress},
+		{"http://2130706433/", RulePrivateAddress},
+		{"http://0x7f.1/", RulePrivateAddress},
+		{"http://0177.0.0.1/", RulePrivateAddress},
+		{"https://sho.rt/u/abc", RuleSelfReference},
+		{"https://www.sho.rt/", ""},
+		{"http://8.8.8.8/", ""},
+	}
+	for _, tt := range tests {
+		if got := ruleOf(e.Check(tt.url)); got != tt.rule {
+			t.Errorf("Check(%q) rule = %q, want %q", tt.url, got, tt.rule)
+		}
+	}
+
+	if err := New(nil, nil, true).Check("http://127.0.0.1/"); err != nil {
+		t.Errorf("private address refused with allowPrivate: %v", err)
+	}
+}
+
+func TestCheckAllowAndDenyRules(t *testing.T) {
+	e := New(nil, []Rule{
+		{Allow: true, Pattern: "*.Example.com"},
+		{Allow: true, Pattern: "example.org"},
+		{Allow: false, Pattern: "bad.example.com", Source: "policy.txt:3"},
+	}, false)
+	tests := []struct {
+		url  string
+		rule string
+	}{
+		{"https://www.example.com/", ""},
+		{"https://example.org/", ""},
+		{"https://example.com/", RuleNotAllowed},
+		{"https://bad.example.com/", "deny bad.example.com (policy.txt:3)"},
+		{"https://other.net/", RuleNotAllowed},
+	}
+	for _, tt := range tests {
+		if got := ruleOf(e.Check(tt.url)); got != tt.rule {
+			t.Errorf("Check(%q) rule = %q, want %q", tt.url, got, tt.rule)
+		}
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	dir := t.TempDir()
+	good := filepath.Join(dir, "policy.txt")
+	os.WriteFile(good, []byte("# comment\n\nallow *.example.com\ndeny bad.example.com\n"), 0o644)
+	rules, err := LoadFile(good)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 2 || !rules[0].Allow || rules[1].Allow || rules[1].Source != "policy.txt:4" {
+		t.Errorf("LoadFile = %+v", rules)
+	}
+
+	for name, content := range map[string]string{
+		"verb.txt":    "block example.com\n",
+		"pattern.txt": "deny [\n",
+	} {
+		file := filepath.Join(dir, name)
+		os.WriteFile(file, []byte(content), 0o644)
+		if _, err := LoadFile(file); err == nil {
+			t.Errorf("%s: invalid rule accepted", name)
+		}
+	}
+}
+
+func ruleOf(err error) string {
+	var v *Violation
+	if errors.As(err, &v) {
+		return v.Rule
+	}
+	return ""
+}
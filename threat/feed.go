@@ -0,0 +1,359 @@
+package threat
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"urlshortner/logging"
+	"urlshortner/urlnorm"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+var logger = logging.Component("threat")
+
+// RuleFeed is the policy rule reported for destinations on the feed
+const RuleFeed = "threat_feed"
+
+// Hash prefixes are between 4 and 32 bytes of a SHA-256 digest
+const (
+	minHashPrefix = 4
+	maxHashPrefix = sha256.Size
+)
+
+// canonical normalizes prefix entries the same way destinations are, without
+// stripping any query parameters
+var canonical = urlnorm.New(nil, false)
+
+// Match names the feed entry that lists a URL
+type Match struct {
+	Kind   string
+	Entry  string
+	Source string
+}
+
+func (m *Match) String() string {
+	return m.Kind + " " + m.Entry + " (" + m.Source + ")"
+}
+
+// list is one loaded generation of the feed
+type list struct {
+	hosts    map[string]*Match
+	prefixes []*Match
+	// hashes maps a prefix length in bytes to the raw prefixes of that length
+	hashes map[int]map[string]*Match
+	size   int
+}
+
+// Feed holds the threat list loaded from local files. The files are text with
+// one entry per line; blank lines and lines starting with # are ignored:
+//
+//	host evil.example             the host and all its subdomains
+//	prefix https://x.example/p/   every URL starting with it
+//	hash 1a2b3c4d                 hex SHA-256 prefix of a URL expression
+//	hashes 4 <base64>             concatenated raw prefixes of the given size
+//
+// Hash entries are matched like Safe Browsing: the host suffix and path
+// prefix combinations of a URL (e.g. "a.example/1/" or "example/1/2?q") are
+// hashed and compared by prefix.
+type Feed struct {
+	files    []string
+	interval time.Duration
+	list     atomic.Pointer[list]
+
+	mu     sync.Mutex
+	mtimes map[string]time.Time
+
+	reloads      atomic.Int64
+	reloadErrors atomic.Int64
+	hits         atomic.Int64
+}
+
+// NewFeed creates a Feed over files, checked for changes every interval by
+// Run. With no files it lists nothing.
+func NewFeed(files []string, interval time.Duration) *Feed {
+	f := &Feed{files: files, interval: interval, mtimes: make(map[string]time.Time)}
+	f.list.Store(&list{})
+	return f
+}
+
+// Enabled reports whether the feed reads any files
+func (f *Feed) Enabled() bool {
+	return len(f.files) > 0
+}
+
+// Load reads every file and replaces the current list. On error the
+// previous list stays in use.
+func (f *Feed) Load() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.load()
+}
+
+func (f *Feed) load() error {
+	l := &list{hosts: make(map[string]*Match), hashes: make(map[int]map[string]*Match)}
+	mtimes := make(map[string]time.Time, len(f.files))
+	for _, file := range f.files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return err
+		}
+		mtimes[file] = info.ModTime()
+		if err := l.readFile(file); err != nil {
+			return err
+		}
+	}
+	f.list.Store(l)
+	f.mtimes = mtimes
+	f.reloads.Add(1)
+	logger.WithFields(logrus.Fields{"files": len(f.files), "entries": l.size}).Info("Loaded threat feed")
+	return nil
+}
+
+// Run reloads the feed whenever one of its files changes, checking on every
+// tick until ctx is cancelled
+func (f *Feed) Run(ctx context.Context) {
+	ticker := time.NewTicker(f.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !f.changed() {
+				continue
+			}
+			if err := f.Load(); err != nil {
+				f.reloadErrors.Add(1)
+				logger.WithError(err).Error("Failed to reload threat feed, keeping the previous list")
+			}
+		}
+	}
+}
+
+func (f *Feed) changed() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, file := range f.files {
+		info, err := os.Stat(file)
+		if err != nil || !info.ModTime().Equal(f.mtimes[file]) {
+			return true
+		}
+	}
+	return false
+}
+
+// Check returns the entry listing rawURL, a normalized destination, or nil
+func (f *Feed) Check(rawURL string) *Match {
+	l := f.list.Load()
+	if l.size == 0 {
+		return nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil
+	}
+	m := l.match(rawURL, u)
+	if m != nil {
+		f.hits.Add(1)
+	}
+	return m
+}
+
+func (l *list) match(rawURL string, u *url.URL) *Match {
+	host := strings.ToLower(u.Hostname())
+	for h := host; h != ""; {
+		if m, ok := l.hosts[h]; ok {
+			return m
+		}
+		_, parent, found := strings.Cut(h, ".")
+		if !found {
+			break
+		}
+		h = parent
+	}
+
+	for _, m := range l.prefixes {
+		if strings.HasPrefix(rawURL, m.Entry) {
+			return m
+		}
+	}
+
+	if len(l.hashes) == 0 {
+		return nil
+	}
+	for _, expr := range expressions(host, u.EscapedPath(), u.RawQuery) {
+		sum := sha256.Sum256([]byte(expr))
+		for n, prefixes := range l.hashes {
+			if m, ok := prefixes[string(sum[:n])]; ok {
+				return m
+			}
+		}
+	}
+	return nil
+}
+
+// expressions lists the host suffix and path prefix combinations that are
+// hashed for lookups: the exact host and up to four suffixes taken from its
+// last five labels, each with the exact path with and without query and up
+// to four directory prefixes starting at "/"
+func expressions(host, path, query string) []string {
+	hosts := []string{host}
+	if net.ParseIP(host) == nil {
+		labels := strings.Split(host, ".")
+		if len(labels) > 5 {
+			labels = labels[len(labels)-5:]
+		}
+		for i := 0; i < len(labels)-1; i++ {
+			if suffix := strings.Join(labels[i:], "."); suffix != host {
+				hosts = append(hosts, suffix)
+			}
+		}
+	}
+
+	if path == "" {
+		path = "/"
+	}
+	var paths []string
+	seen := make(map[string]bool)
+	add := func(p string) {
+		if !seen[p] {
+			seen[p] = true
+			paths = append(paths, p)
+		}
+	}
+	if query != "" {
+		add(path + "?" + query)
+	}
+	add(path)
+	segments := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	dir := "/"
+	for i := 0; i < 4; i++ {
+		add(dir)
+		if i >= len(segments)-1 {
+			break
+		}
+		dir += segments[i] + "/"
+	}
+
+	exprs := make([]string, 0, len(hosts)*len(paths))
+	for _, h := range hosts {
+		for _, p := range paths {
+			exprs = append(exprs, h+p)
+		}
+	}
+	return exprs
+}
+
+func (l *list) readFile(file string) error {
+	fh, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+	return l.read(fh, filepath.Base(file))
+}
+
+func (l *list) read(r io.Reader, name string) error {
+	scanner := bufio.NewScanner(r)
+	// hashes lines can carry many prefixes
+	scanner.Buffer(make([]byte, 64*1024), 64<<20)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		if err := l.add(text, fmt.Sprintf("%s:%d", name, line)); err != nil {
+			return fmt.Errorf("%s:%d: %w", name, line, err)
+		}
+	}
+	return scanner.Err()
+}
+
+func (l *list) add(text, source string) error {
+	fields := strings.Fields(text)
+	switch {
+	case len(fields) == 2 && fields[0] == "host":
+		host := strings.ToLower(strings.TrimSuffix(fields[1], "."))
+		l.hosts[host] = &Match{Kind: "host", Entry: host, Source: source}
+		l.size++
+	case len(fields) == 2 && fields[0] == "prefix":
+		prefix, err := canonical.Normalize(fields[1])
+		if err != nil {
+			return fmt.Errorf("invalid prefix %q", fields[1])
+		}
+		l.prefixes = append(l.prefixes, &Match{Kind: "prefix", Entry: prefix, Source: source})
+		l.size++
+	case len(fields) == 2 && fields[0] == "hash":
+		raw, err := hex.DecodeString(fields[1])
+		if err != nil || len(raw) < minHashPrefix || len(raw) > maxHashPrefix {
+			return fmt.Errorf("hash must be %d to %d hex encoded bytes", minHashPrefix, maxHashPrefix)
+		}
+		l.addHash(raw, fields[1], source)
+	case len(fields) == 3 && fields[0] == "hashes":
+		size, err := strconv.Atoi(fields[1])
+		if err != nil || size < minHashPrefix || size > maxHashPrefix {
+			return fmt.Errorf("prefix size must be between %d and %d", minHashPrefix, maxHashPrefix)
+		}
+		raw, err := base64.StdEncoding.DecodeString(fields[2])
+		if err != nil || len(raw)%size != 0 {
+			return fmt.Errorf("hashes must be base64 of a multiple of %d bytes", size)
+		}
+		for i := 0; i < len(raw); i += size {
+			prefix := raw[i : i+size]
+			l.addHash(prefix, hex.EncodeToString(prefix), source)
+		}
+	default:
+		return fmt.Errorf("expected host, prefix, hash or hashes entry")
+	}
+	return nil
+}
+
+func (l *list) addHash(prefix []byte, entry, source string) {
+	byLength, ok := l.hashes[len(prefix)]
+	if !ok {
+		byLength = make(map[string]*Match)
+		l.hashes[len(prefix)] = byLength
+	}
+	byLength[string(prefix)] = &Match{Kind: "hash", Entry: entry, Source: source}
+	l.size++
+}
+
+var (
+	feedEntriesDesc      = prometheus.NewDesc("urlshortener_threat_feed_entries", "Entries in the loaded threat feed", nil, nil)
+	feedReloadsDesc      = prometheus.NewDesc("urlshortener_threat_feed_reloads_total", "Threat feed loads that succeeded", nil, nil)
+	feedReloadErrorsDesc = prometheus.NewDesc("urlshortener_threat_feed_reload_errors_total", "Threat feed reloads that failed", nil, nil)
+	feedHitsDesc         = prometheus.NewDesc("urlshortener_threat_feed_hits_total", "Lookups by creates, updates and scans that matched the threat feed", nil, nil)
+)
+
+// Describe implements prometheus.Collector
+func (f *Feed) Describe(ch chan<- *prometheus.Desc) {
+	ch <- feedEntriesDesc
+	ch <- feedReloadsDesc
+	ch <- feedReloadErrorsDesc
+	ch <- feedHitsDesc
+}
+
+// Collect implements prometheus.Collector
+func (f *Feed) Collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(feedEntriesDesc, prometheus.GaugeValue, float64(f.list.Load().size))
+	ch <- prometheus.MustNewConstMetric(feedReloadsDesc, prometheus.CounterValue, float64(f.reloads.Load()))
+	ch <- prometheus.MustNewConstMetric(feedReloadErrorsDesc, prometheus.CounterValue, float64(f.reloadErrors.Load()))
+	ch <- prometheus.MustNewConstMetric(feedHitsDesc, prometheus.CounterValue, float64(f.hits.Load()))
+}
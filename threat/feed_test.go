@@ -0,0 +1,86 @@
+package threat
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func loadTestFeed(t *testing.T, content string) *Feed {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "feed.txt")
+	if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	f := NewFeed([]string{file}, 0)
+	if err := f.Load(); err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestFeedCheck(t *testing.T) {
+	sum := sha256.Sum256([]byte("hashed.example/dl/"))
+	f := loadTestFeed(t, "# test feed\n\nhost evil.example\nprefix HTTPS://Files.example/bad/\nhash "+hex.EncodeToString(sum[:4])+"\n")
+
+	tests := []struct {
+		url  string
+		kind string
+	}{
+		{"https://evil.example/", "host"},
+		{"https://a.b.evil.example/x", "host"},
+		{"https://notevil.example/", ""},
+		{"https://files.example/bad/payload.exe", "prefix"},
+		{"https://files.example/good/", ""},
+		{"https://www.hashed.example/dl/setup.exe?x=1", "hash"},
+		{"https://hashed.example/other/", ""},
+	}
+	for _, tt := range tests {
+		m := f.Check(tt.url)
+		got := ""
+		if m != nil {
+			got = m.Kind
+		}
+		if got != tt.kind {
+			t.Errorf("Check(%q) = %v, want kind %q", tt.url, m, tt.kind)
+		}
+	}
+}
+
+func TestFeedLoadKeepsPreviousListOnError(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "feed.txt")
+	os.WriteFile(file, []byte("host evil.example\n"), 0o644)
+	f := NewFeed([]string{file}, 0)
+	if err := f.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	os.WriteFile(file, []byte("host evil.example\nhash zz\n"), 0o644)
+	if err := f.Load(); err == nil {
+		t.Fatal("invalid hash entry accepted")
+	}
+	if f.Check("https://evil.example/") == nil {
+		t.Error("previous list dropped after a failed reload")
+	}
+
+	want := `
+# HELP urlshortener_threat_feed_reloads_total Threat feed loads that succeeded
+# TYPE urlshortener_threat_feed_reloads_total counter
+urlshortener_threat_feed_reloads_total 1
+`
+	if err := testutil.CollectAndCompare(f, strings.NewReader(want), "urlshortener_threat_feed_reloads_total"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDisabledFeedListsNothing(t *testing.T) {
+	f := NewFeed(nil, 0)
+	if f.Enabled() || f.Check("https://evil.example/") != nil {
+		t.Error("feed without files lists something")
+	}
+}
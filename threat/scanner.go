@@ -0,0 +1,149 @@
+package threat
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"urlshortner/database"
+	"urlshortner/models"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+// Scanner periodically checks existing links against the feed, marking links
+// whose destination became listed with its action and clearing links that
+// are no longer listed
+type Scanner struct {
+	store    database.Store
+	feed     *Feed
+	interval time.Duration
+	action   string
+	changed  func(codes ...string)
+
+	runs         atomic.Int64
+	listed       atomic.Int64
+	errors       atomic.Int64
+	lastRun      atomic.Int64 // unix seconds
+	lastDuration atomic.Int64 // nanoseconds
+}
+
+// NewScanner creates a Scanner that gives listed links the status action,
+// models.ThreatFlagged or models.ThreatDisabled. changed, if set, is called
+// with the codes whose status was updated so caches can be invalidated.
+func NewScanner(store database.Store, feed *Feed, interval time.Duration, action string, changed func(codes ...string)) *Scanner {
+	if action != models.ThreatFlagged {
+		action = models.ThreatDisabled
+	}
+	return &Scanner{
+		store:    store,
+		feed:     feed,
+		interval: interval,
+		action:   action,
+		changed:  changed,
+	}
+}
+
+// Run scans right away, as the feed may have changed while the service was
+// down, and then on every tick until ctx is cancelled
+func (s *Scanner) Run(ctx context.Context) {
+	s.Scan(ctx)
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.Scan(ctx)
+		}
+	}
+}
+
+// Scan checks every link once and returns how many are currently listed
+func (s *Scanner) Scan(ctx context.Context) int {
+	start := time.Now()
+
+	type update struct {
+		code, url, status, match string
+	}
+	var updates []update
+	listed := 0
+	// Updates are applied after the walk, which holds a connection open
+	err := s.store.ForEachURL(ctx, func(u *models.URL) error {
+		status, match := "", ""
+		if m := s.feed.Check(u.URL); m != nil {
+			status, match = s.action, m.String()
+			listed++
+		}
+		if u.ThreatStatus != status || u.ThreatMatch != match {
+			updates = append(updates, update{u.ShortCode, u.URL, status, match})
+		}
+		return nil
+	})
+	if err != nil {
+		s.errors.Add(1)
+		logger.WithError(err).Error("Failed to scan links against threat feed")
+		return listed
+	}
+
+	var codes []string
+	for _, up := range updates {
+		err := s.store.SetThreatStatus(ctx, up.code, up.url, up.status, up.match)
+		if errors.Is(err, database.ErrNotFound) {
+			// Deleted, renamed or retargeted since the walk; the next scan
+			// checks renamed and retargeted links again
+			continue
+		} else if err != nil {
+			s.errors.Add(1)
+			logger.WithError(err).WithField("short_code", up.code).Error("Failed to update threat status")
+			continue
+		}
+		codes = append(codes, up.code)
+		fields := logrus.Fields{"short_code": up.code, "status": up.status, "match": up.match}
+		if up.status == "" {
+			logger.WithFields(fields).Info("Link no longer on threat feed")
+		} else {
+			logger.WithFields(fields).Warn("Link destination is on threat feed")
+		}
+	}
+	if s.changed != nil && len(codes) > 0 {
+		s.changed(codes...)
+	}
+
+	s.runs.Add(1)
+	s.listed.Store(int64(listed))
+	s.lastRun.Store(time.Now().Unix())
+	s.lastDuration.Store(int64(time.Since(start)))
+	return listed
+}
+
+var (
+	scansDesc            = prometheus.NewDesc("urlshortener_threat_scans_total", "Number of threat re-scans run", nil, nil)
+	listedDesc           = prometheus.NewDesc("urlshortener_threat_listed_links", "Links found on the threat feed by the last scan", nil, nil)
+	scanErrorsDesc       = prometheus.NewDesc("urlshortener_threat_scan_errors_total", "Threat re-scans or status updates that failed", nil, nil)
+	lastScanDesc         = prometheus.NewDesc("urlshortener_threat_last_scan_timestamp_seconds", "Unix time of the last scan", nil, nil)
+	lastScanDurationDesc = prometheus.NewDesc("urlshortener_threat_last_scan_duration_seconds", "Duration of the last scan", nil, nil)
+)
+
+// Describe implements prometheus.Collector
+func (s *Scanner) Describe(ch chan<- *prometheus.Desc) {
+	ch <- scansDesc
+	ch <- listedDesc
+	ch <- scanErrorsDesc
+	ch <- lastScanDesc
+	ch <- lastScanDurationDesc
+}
+
+// Collect implements prometheus.Collector
+func (s *Scanner) Collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(scansDesc, prometheus.CounterValue, float64(s.runs.Load()))
+	ch <- prometheus.MustNewConstMetric(listedDesc, prometheus.GaugeValue, float64(s.listed.Load()))
+	ch <- prometheus.MustNewConstMetric(scanErrorsDesc, prometheus.CounterValue, float64(s.errors.Load()))
+	ch <- prometheus.MustNewConstMetric(lastScanDesc, prometheus.GaugeValue, float64(s.lastRun.Load()))
+	ch <- prometheus.MustNewConstMetric(lastScanDurationDesc, prometheus.GaugeValue, time.Duration(s.lastDuration.Load()).Seconds())
+}
@@ -0,0 +1,103 @@
+package threat
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"urlshortner/database"
+	"urlshortner/models"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestScanMarksAndClearsLinks(t *testing.T) {
+	ctx := context.Background()
+	store := database.NewMemoryStore()
+	for _, u := range []*models.URL{
+		{URL: "https://evil.example/x", ShortCode: "bad"},
+		{URL: "https://example.com/", ShortCode: "good"},
+	} {
+		if err := store.Create(ctx, u, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var changed []string
+	s := NewScanner(store, loadTestFeed(t, "host evil.example\n"), 0, models.ThreatFlagged, func(codes ...string) {
+		changed = append(changed, codes...)
+	})
+	if n := s.Scan(ctx); n != 1 {
+		t.Fatalf("Scan listed %d links, want 1", n)
+	}
+	u, _ := store.GetByCode(ctx, "bad")
+	if u.ThreatStatus != models.ThreatFlagged || u.ThreatMatch == "" {
+		t.Errorf("listed link status %q match %q", u.ThreatStatus, u.ThreatMatch)
+	}
+	if len(changed) != 1 || changed[0] != "bad" {
+		t.Errorf("changed = %v, want [bad]", changed)
+	}
+	want := `
+# HELP urlshortener_threat_listed_links Links found on the threat feed by the last scan
+# TYPE urlshortener_threat_listed_links gauge
+urlshortener_threat_listed_links 1
+`
+	if err := testutil.CollectAndCompare(s, strings.NewReader(want), "urlshortener_threat_listed_links"); err != nil {
+		t.Error(err)
+	}
+
+	// A second scan finds nothing to update
+	changed = nil
+	s.Scan(ctx)
+	if len(changed) != 0 {
+		t.Errorf("unchanged scan reported %v", changed)
+	}
+
+	s.feed = loadTestFeed(t, "host other.example\n")
+	if n := s.Scan(ctx); n != 0 {
+		t.Fatalf("Scan listed %d links after the entry was removed", n)
+	}
+	if u, _ := store.GetByCode(ctx, "bad"); u.ThreatStatus != "" || u.ThreatMatch != "" {
+		t.Errorf("delisted link kept status %q match %q", u.ThreatStatus, u.ThreatMatch)
+	}
+}
+
+// retargetingStore retargets a link right after the scan walked it
+type retargetingStore struct {
+	database.Store
+	code, newURL string
+}
+
+func (s *retargetingStore) ForEachURL(ctx context.Context, fn func(*models.URL) error) error {
+	if err := s.Store.ForEachURL(ctx, fn); err != nil {
+		return err
+	}
+	_, err := s.Store.UpdateLink(ctx, s.code, s.newURL, "")
+	return err
+}
+
+func TestScanSkipsLinksRetargetedDuringScan(t *testing.T) {
+	ctx := context.Background()
+	mem := database.NewMemoryStore()
+	if err := mem.Create(ctx, &models.URL{URL: "https://evil.example/x", ShortCode: "moved"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	store := &retargetingStore{Store: mem, code: "moved", newURL: "https://example.com/"}
+
+	var changed []string
+	s := NewScanner(store, loadTestFeed(t, "host evil.example\n"), 0, models.ThreatDisabled, func(codes ...string) {
+		changed = append(changed, codes...)
+	})
+	s.Scan(ctx)
+
+	u, err := mem.GetByCode(ctx, "moved")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.ThreatStatus != "" {
+		t.Errorf("retargeted link got status %q for its old destination", u.ThreatStatus)
+	}
+	if len(changed) != 0 || s.errors.Load() != 0 {
+		t.Errorf("changed %v errors %d, want the update skipped quietly", changed, s.errors.Load())
+	}
+}
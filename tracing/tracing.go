@@ -0,0 +1,128 @@
+// Package tracing sets up OpenTelemetry tracing: the global tracer provider
+// and W3C trace context propagation, and a Store hook that wraps every
+// database operation in a span. Log entries pick up the trace of their
+// context in the logging package.
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"urlshortner/buildinfo"
+	"urlshortner/database"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Exporters selectable with Options.Exporter
+const (
+	ExporterNone = "none"
+	ExporterOTLP = "otlp"
+)
+
+// Options configures Setup
+type Options struct {
+	// Exporter is ExporterNone or ExporterOTLP
+	Exporter string
+	// Endpoint is the OTLP/HTTP collector, host:port or a full URL
+	Endpoint string
+	// Insecure sends spans over plain HTTP
+	Insecure bool
+	// SampleRatio is the share of new traces recorded; incoming requests
+	// follow the sampling decision of their caller
+	SampleRatio float64
+
+	ServiceName string
+	Environment string
+}
+
+var tracer = otel.Tracer("urlshortner")
+
+// Setup installs W3C trace context propagation and, unless the exporter is
+// ExporterNone, a tracer provider sending spans to an OTLP collector. The
+// returned function flushes pending spans on shutdown.
+func Setup(ctx context.Context, opts Options) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	switch opts.Exporter {
+	case ExporterNone, "":
+		// Incoming trace IDs still reach the logs through propagation
+		return func(context.Context) error { return nil }, nil
+	case ExporterOTLP:
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter %q, want none or otlp", opts.Exporter)
+	}
+
+	clientOpts := []otlptracehttp.Option{}
+	if strings.Contains(opts.Endpoint, "://") {
+		clientOpts = append(clientOpts, otlptracehttp.WithEndpointURL(opts.Endpoint))
+	} else if opts.Endpoint != "" {
+		clientOpts = append(clientOpts, otlptracehttp.WithEndpoint(opts.Endpoint))
+	}
+	if opts.Insecure {
+		clientOpts = append(clientOpts, otlptracehttp.WithInsecure())
+	}
+	exporter, err := otlptracehttp.New(ctx, clientOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("creating OTLP exporter: %w", err)
+	}
+
+	provider, err := NewProvider(ctx, exporter, opts)
+	if err != nil {
+		return nil, err
+	}
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// NewProvider creates a tracer provider batching spans to exporter, for
+// Setup or for an in-memory exporter in tests
+func NewProvider(ctx context.Context, exporter sdktrace.SpanExporter, opts Options) (*sdktrace.TracerProvider, error) {
+	build := buildinfo.Get()
+	res, err := resource.New(ctx,
+		resource.WithTelemetrySDK(),
+		resource.WithAttributes(
+			semconv.ServiceName(opts.ServiceName),
+			semconv.ServiceVersion(build.Version),
+			semconv.DeploymentEnvironment(opts.Environment),
+		),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("describing tracing resource: %w", err)
+	}
+
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(opts.SampleRatio))),
+	), nil
+}
+
+// StoreHook is a database.Hook running every Store operation in a client
+// span. Missing links and taken codes are expected outcomes, not errors.
+func StoreHook(ctx context.Context, op string) (context.Context, func(error)) {
+	ctx, span := tracer.Start(ctx, "store."+op,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBOperationName(op)),
+	)
+	return ctx, func(err error) {
+		switch {
+		case err == nil:
+		case errors.Is(err, database.ErrNotFound), errors.Is(err, database.ErrConflict):
+			span.SetAttributes(semconv.ErrorTypeKey.String(err.Error()))
+		default:
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+}
@@ -0,0 +1,139 @@
+package tracing
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"urlshortner/database"
+	"urlshortner/logging"
+	"urlshortner/middleware"
+	"urlshortner/models"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	incomingTraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	incomingSpanID  = "00f067aa0ba902b7"
+)
+
+func TestRequestSpansAndLogs(t *testing.T) {
+	ctx := context.Background()
+	store := database.Instrument(database.NewMemoryStore(), StoreHook)
+	if err := store.Create(ctx, &models.URL{URL: "https://example.com/", ShortCode: "abc"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Setup(ctx, Options{Exporter: ExporterNone}); err != nil {
+		t.Fatal(err)
+	}
+	exporter := tracetest.NewInMemoryExporter()
+	provider, err := NewProvider(ctx, exporter, Options{SampleRatio: 1, ServiceName: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { provider.Shutdown(ctx) })
+
+	var logs bytes.Buffer
+	logging.Logger.SetOutput(&logs)
+	t.Cleanup(func() { logging.Logger.SetOutput(os.Stderr) })
+
+	r := mux.NewRouter()
+	r.Use(middleware.Tracing)
+	r.Use(middleware.RequestLogger)
+	r.HandleFunc("/u/{code}", func(w http.ResponseWriter, r *http.Request) {
+		if _, err := store.GetByCode(r.Context(), mux.Vars(r)["code"]); err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		logging.FromContext(r.Context()).Info("Resolved link")
+		w.WriteHeader(http.StatusFound)
+	})
+
+	for _, path := range []string{"/u/abc", "/u/missing"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("traceparent", "00-"+incomingTraceID+"-"+incomingSpanID+"-01")
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	if err := provider.ForceFlush(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	var servers, stores tracetest.SpanStubs
+	for _, s := range exporter.GetSpans() {
+		switch s.Name {
+		case "GET /u/{code}":
+			servers = append(servers, s)
+		case "store.GetByCode":
+			stores = append(stores, s)
+		}
+	}
+	if len(servers) != 2 || len(stores) != 2 {
+		t.Fatalf("got %d server and %d store spans, want 2 of each", len(servers), len(stores))
+	}
+
+	server := servers[0]
+	if server.SpanKind != trace.SpanKindServer {
+		t.Errorf("server span kind %v", server.SpanKind)
+	}
+	if got := server.SpanContext.TraceID().String(); got != incomingTraceID {
+		t.Errorf("server span trace %s, want the incoming trace %s", got, incomingTraceID)
+	}
+	if got := server.Parent.SpanID().String(); got != incomingSpanID || !server.Parent.IsRemote() {
+		t.Errorf("server span parent %s, want the remote caller %s", got, incomingSpanID)
+	}
+
+	for i, s := range stores {
+		if s.Parent.SpanID() != servers[i].SpanContext.SpanID() {
+			t.Errorf("store span %d is not a child of its server span", i)
+		}
+		if s.SpanKind != trace.SpanKindClient {
+			t.Errorf("store span %d kind %v", i, s.SpanKind)
+		}
+	}
+	// A missing link is an expected outcome, not a failed store call
+	if stores[1].Status.Code == codes.Error {
+		t.Errorf("not found marked the store span as failed: %+v", stores[1].Status)
+	}
+
+	var resolved, completed int
+	scanner := bufio.NewScanner(&logs)
+	for scanner.Scan() {
+		var entry map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf("log line %q: %v", scanner.Text(), err)
+		}
+		if entry["trace_id"] != incomingTraceID {
+			t.Errorf("log entry %q has trace_id %v", entry["msg"], entry["trace_id"])
+		}
+		switch entry["msg"] {
+		case "Resolved link":
+			resolved++
+			if entry["span_id"] != server.SpanContext.SpanID().String() {
+				t.Errorf("handler log span_id %v, want the server span", entry["span_id"])
+			}
+		case "Request completed":
+			completed++
+		}
+	}
+	if resolved != 1 || completed != 2 {
+		t.Errorf("logged %d resolved and %d completed entries, want 1 and 2", resolved, completed)
+	}
+}
+
+func TestSetupRejectsUnknownExporter(t *testing.T) {
+	if _, err := Setup(context.Background(), Options{Exporter: "zipkin"}); err == nil {
+		t.Error("unknown exporter accepted")
+	}
+}
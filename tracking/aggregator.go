@@ -0,0 +1,226 @@
+package tracking
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"urlshortner/database"
+	"urlshortner/logging"
+	"urlshortner/models"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+var logger = logging.Component("tracking")
+
+// Aggregator buffers redirect hits in memory, coalescing access counts per
+// short code, and writes them to the store in batches. Flushes happen every
+// interval or as soon as flushSize hits are pending, whichever comes first.
+type Aggregator struct {
+	store      database.Store
+	interval   time.Duration
+	flushSize  int
+	maxPending int
+
+	mu     sync.Mutex
+	counts map[string]int
+	clicks []*models.ClickEvent
+	// pending counts hits whose access counts are not written yet; click
+	// events outlive them when only the events failed to flush
+	pending int
+
+	kick    chan struct{}
+	done    chan struct{}
+	stopped chan struct{}
+	flushMu sync.Mutex
+
+	flushes       atomic.Int64
+	flushErrors   atomic.Int64
+	flushedHits   atomic.Int64
+	droppedClicks atomic.Int64
+	lastFlush     atomic.Int64 // nanoseconds
+	flushTotal    atomic.Int64 // nanoseconds
+}
+
+// NewAggregator creates an Aggregator. Click events beyond maxPending are
+// dropped while the store is unavailable; access counts are always kept.
+func NewAggregator(store database.Store, interval time.Duration, flushSize int) *Aggregator {
+	if flushSize <= 0 {
+		flushSize = 1000
+	}
+	return &Aggregator{
+		store:      store,
+		interval:   interval,
+		flushSize:  flushSize,
+		maxPending: flushSize * 10,
+		counts:     make(map[string]int),
+		kick:       make(chan struct{}, 1),
+		done:       make(chan struct{}),
+		stopped:    make(chan struct{}),
+	}
+}
+
+// Record queues one redirect of code. It never blocks on the database.
+func (a *Aggregator) Record(code string, click *models.ClickEvent) {
+	a.mu.Lock()
+	a.counts[code]++
+	if click != nil {
+		if len(a.clicks) < a.maxPending {
+			a.clicks = append(a.clicks, click)
+		} else {
+			a.droppedClicks.Add(1)
+		}
+	}
+	a.pending++
+	full := a.pending >= a.flushSize
+	a.mu.Unlock()
+
+	if full {
+		select {
+		case a.kick <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Run flushes on every tick or size trigger until Close is called
+func (a *Aggregator) Run() {
+	defer close(a.stopped)
+
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-a.done:
+			return
+		case <-ticker.C:
+			a.Flush(context.Background())
+		case <-a.kick:
+			a.Flush(context.Background())
+		}
+	}
+}
+
+// Close stops the background loop and writes out everything still pending
+func (a *Aggregator) Close(ctx context.Context) error {
+	close(a.done)
+	select {
+	case <-a.stopped:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return a.Flush(ctx)
+}
+
+// Flush writes the pending hits to the store. Whatever was not written is put
+// back so the next flush retries it: everything when the access counts fail,
+// only the click events when just those fail.
+func (a *Aggregator) Flush(ctx context.Context) error {
+	a.flushMu.Lock()
+	defer a.flushMu.Unlock()
+
+	a.mu.Lock()
+	counts, clicks, pending := a.counts, a.clicks, a.pending
+	a.counts = make(map[string]int)
+	a.clicks = nil
+	a.pending = 0
+	a.mu.Unlock()
+
+	if pending == 0 && len(clicks) == 0 {
+		return nil
+	}
+
+	hits, codes := pending, len(counts)
+	start := time.Now()
+	flushCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	err := a.store.IncrementAccessBatch(flushCtx, counts)
+	if err == nil {
+		a.flushedHits.Add(int64(pending))
+		counts, pending = nil, 0
+		err = a.store.RecordClicks(flushCtx, clicks)
+	}
+	elapsed := time.Since(start)
+
+	a.flushes.Add(1)
+	a.lastFlush.Store(int64(elapsed))
+	a.flushTotal.Add(int64(elapsed))
+
+	if err != nil {
+		a.flushErrors.Add(1)
+		a.requeue(counts, clicks, pending)
+		logger.WithError(err).WithFields(logrus.Fields{
+			"pending": pending,
+			"clicks":  len(clicks),
+		}).Error("Failed to flush access counts")
+		return err
+	}
+
+	logger.WithFields(logrus.Fields{
+		"hits":        hits,
+		"codes":       codes,
+		"clicks":      len(clicks),
+		"duration_ms": elapsed.Milliseconds(),
+	}).Debug("Flushed access counts")
+	return nil
+}
+
+func (a *Aggregator) requeue(counts map[string]int, clicks []*models.ClickEvent, pending int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for code, n := range counts {
+		a.counts[code] += n
+	}
+	room := a.maxPending - len(a.clicks)
+	if room < len(clicks) {
+		a.droppedClicks.Add(int64(len(clicks) - max(room, 0)))
+		clicks = clicks[:max(room, 0)]
+	}
+	a.clicks = append(a.clicks, clicks...)
+	a.pending += pending
+}
+
+// QueueDepth is the number of hits waiting to be flushed
+func (a *Aggregator) QueueDepth() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.pending
+}
+
+var (
+	queueDepthDesc    = prometheus.NewDesc("urlshortener_access_queue_depth", "Redirect hits waiting to be flushed", nil, nil)
+	flushesDesc       = prometheus.NewDesc("urlshortener_access_flushes_total", "Access count flushes attempted", nil, nil)
+	flushErrorsDesc   = prometheus.NewDesc("urlshortener_access_flush_errors_total", "Access count flushes that failed", nil, nil)
+	flushedHitsDesc   = prometheus.NewDesc("urlshortener_access_flushed_hits_total", "Redirect hits written to the database", nil, nil)
+	droppedClicksDesc = prometheus.NewDesc("urlshortener_access_dropped_clicks_total", "Click events dropped because the queue was full", nil, nil)
+	flushSecondsDesc  = prometheus.NewDesc("urlshortener_access_flush_duration_seconds_sum", "Total time spent flushing", nil, nil)
+	lastFlushDesc     = prometheus.NewDesc("urlshortener_access_last_flush_duration_seconds", "Duration of the last flush", nil, nil)
+)
+
+// Describe implements prometheus.Collector
+func (a *Aggregator) Describe(ch chan<- *prometheus.Desc) {
+	ch <- queueDepthDesc
+	ch <- flushesDesc
+	ch <- flushErrorsDesc
+	ch <- flushedHitsDesc
+	ch <- droppedClicksDesc
+	ch <- flushSecondsDesc
+	ch <- lastFlushDesc
+}
+
+// Collect implements prometheus.Collector
+func (a *Aggregator) Collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(queueDepthDesc, prometheus.GaugeValue, float64(a.QueueDepth()))
+	ch <- prometheus.MustNewConstMetric(flushesDesc, prometheus.CounterValue, float64(a.flushes.Load()))
+	ch <- prometheus.MustNewConstMetric(flushErrorsDesc, prometheus.CounterValue, float64(a.flushErrors.Load()))
+	ch <- prometheus.MustNewConstMetric(flushedHitsDesc, prometheus.CounterValue, float64(a.flushedHits.Load()))
+	ch <- prometheus.MustNewConstMetric(droppedClicksDesc, prometheus.CounterValue, float64(a.droppedClicks.Load()))
+	ch <- prometheus.MustNewConstMetric(flushSecondsDesc, prometheus.CounterValue, time.Duration(a.flushTotal.Load()).Seconds())
+	ch <- prometheus.MustNewConstMetric(lastFlushDesc, prometheus.GaugeValue, time.Duration(a.lastFlush.Load()).Seconds())
+}
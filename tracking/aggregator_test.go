@@ -0,0 +1,145 @@
+package tracking
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"urlshortner/database"
+	"urlshortner/models"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// flakyStore fails the next clicks or counts writes as told
+type flakyStore struct {
+	database.Store
+	failCounts int
+	failClicks int
+	recorded   int
+}
+
+func (s *flakyStore) IncrementAccessBatch(ctx context.Context, counts map[string]int) error {
+	if s.failCounts > 0 {
+		s.failCounts--
+		return errors.New("counts unavailable")
+	}
+	return s.Store.IncrementAccessBatch(ctx, counts)
+}
+
+func (s *flakyStore) RecordClicks(ctx context.Context, events []*models.ClickEvent) error {
+	if s.failClicks > 0 {
+		s.failClicks--
+		return errors.New("clicks unavailable")
+	}
+	s.recorded += len(events)
+	return s.Store.RecordClicks(ctx, events)
+}
+
+func newTestAggregator(t *testing.T, store *flakyStore) *Aggregator {
+	t.Helper()
+	u := &models.URL{URL: "https://example.com/", ShortCode: "abc"}
+	if err := store.Create(context.Background(), u, nil); err != nil {
+		t.Fatal(err)
+	}
+	return NewAggregator(store, time.Hour, 100)
+}
+
+func accessCount(t *testing.T, store database.Store) int {
+	t.Helper()
+	u, err := store.GetByCode(context.Background(), "abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u.AccessCount
+}
+
+func TestFlushRetriesOnlyClicksWhenCountsWereWritten(t *testing.T) {
+	ctx := context.Background()
+	store := &flakyStore{Store: database.NewMemoryStore(), failClicks: 1}
+	a := newTestAggregator(t, store)
+
+	for i := 0; i < 3; i++ {
+		a.Record("abc", &models.ClickEvent{URLID: 1, ClickedAt: time.Now()})
+	}
+	if err := a.Flush(ctx); err == nil {
+		t.Fatal("Flush succeeded, want the click write error")
+	}
+	if got := accessCount(t, store); got != 3 {
+		t.Fatalf("access count after partial flush = %d, want 3", got)
+	}
+	if got := a.QueueDepth(); got != 0 {
+		t.Errorf("queue depth after partial flush = %d, want 0", got)
+	}
+	if got := a.flushedHits.Load(); got != 3 {
+		t.Errorf("flushed hits after partial flush = %d, want 3", got)
+	}
+
+	if err := a.Flush(ctx); err != nil {
+		t.Fatalf("retry Flush: %v", err)
+	}
+	if got := accessCount(t, store); got != 3 {
+		t.Errorf("access count after retry = %d, want 3", got)
+	}
+	if got := a.flushedHits.Load(); got != 3 {
+		t.Errorf("flushed hits after retry = %d, want 3", got)
+	}
+	if store.recorded != 3 {
+		t.Errorf("recorded %d click events, want 3", store.recorded)
+	}
+}
+
+func TestFlushRequeuesEverythingWhenCountsFail(t *testing.T) {
+	ctx := context.Background()
+	store := &flakyStore{Store: database.NewMemoryStore(), failCounts: 1}
+	a := newTestAggregator(t, store)
+
+	a.Record("abc", &models.ClickEvent{URLID: 1, ClickedAt: time.Now()})
+	a.Record("abc", nil)
+	if err := a.Flush(ctx); err == nil {
+		t.Fatal("Flush succeeded, want the count write error")
+	}
+	if got := a.QueueDepth(); got != 2 {
+		t.Fatalf("queue depth after failed flush = %d, want 2", got)
+	}
+
+	a.Record("abc", nil)
+	if err := a.Flush(ctx); err != nil {
+		t.Fatalf("retry Flush: %v", err)
+	}
+	if got := accessCount(t, store); got != 3 {
+		t.Errorf("access count = %d, want 3", got)
+	}
+	if got := a.flushedHits.Load(); got != 3 {
+		t.Errorf("flushed hits = %d, want 3", got)
+	}
+	if store.recorded != 1 {
+		t.Errorf("recorded %d click events, want 1", store.recorded)
+	}
+}
+
+func TestCloseFlushesPendingHits(t *testing.T) {
+	store := &flakyStore{Store: database.NewMemoryStore()}
+	a := newTestAggregator(t, store)
+	go a.Run()
+
+	a.Record("abc", nil)
+	a.Record("abc", nil)
+	if err := a.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := accessCount(t, store); got != 2 {
+		t.Errorf("access count after Close = %d, want 2", got)
+	}
+
+	want := `
+# HELP urlshortener_access_flushed_hits_total Redirect hits written to the database
+# TYPE urlshortener_access_flushed_hits_total counter
+urlshortener_access_flushed_hits_total 2
+`
+	if err := testutil.CollectAndCompare(a, strings.NewReader(want), "urlshortener_access_flushed_hits_total"); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,413 @@
+package transfer
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"urlshortner/database"
+	"urlshortner/logging"
+	"urlshortner/models"
+	"urlshortner/policy"
+	"urlshortner/threat"
+	"urlshortner/urlnorm"
+	"urlshortner/utils"
+
+	"github.com/sirupsen/logrus"
+)
+
+var logger = logging.Component("transfer")
+
+// Supported file formats
+const (
+	FormatCSV   = "csv"
+	FormatJSONL = "jsonl"
+)
+
+// importBatchSize is how many rows are written per transaction
+const importBatchSize = 500
+
+// maxReportedErrors caps the row errors listed in a Summary
+const maxReportedErrors = 100
+
+// csvColumns is the header written by Export. Import matches columns by name,
+// so they may come in any order and only short_code and url are required.
+var csvColumns = []string{"id", "short_code", "url", "title", "owner", "access_count", "created_at", "updated_at", "expires_at", "threat_status", "threat_match", "generated_code"}
+
+// jsonlRow is a link as written to and read from JSONL. It carries the
+// generated flag models.URL leaves out of its JSON, so imported links whose
+// code was generated stay eligible for reuse.
+type jsonlRow struct {
+	*models.URL
+	GeneratedCode bool `json:"generated_code,omitempty"`
+}
+
+// ValidFormat reports whether format is a supported file format
+func ValidFormat(format string) bool {
+	return format == FormatCSV || format == FormatJSONL
+}
+
+// ValidConflictPolicy reports whether policy is a database.Conflict* policy
+func ValidConflictPolicy(policy string) bool {
+	switch policy {
+	case database.ConflictSkip, database.ConflictOverwrite, database.ConflictFail:
+		return true
+	}
+	return false
+}
+
+// Export streams every link to w and returns how many were written
+func Export(ctx context.Context, store database.Store, w io.Writer, format string) (int, error) {
+	count := 0
+	if format == FormatJSONL {
+		enc := json.NewEncoder(w)
+		err := store.ForEachURL(ctx, func(u *models.URL) error {
+			count++
+			return enc.Encode(jsonlRow{URL: u, GeneratedCode: u.GeneratedCode})
+		})
+		return count, err
+	}
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvColumns); err != nil {
+		return 0, err
+	}
+	err := store.ForEachURL(ctx, func(u *models.URL) error {
+		expiresAt := ""
+		if u.ExpiresAt != nil {
+			expiresAt = u.ExpiresAt.UTC().Format(time.RFC3339Nano)
+		}
+		count++
+		if count%1000 == 0 {
+			cw.Flush()
+		}
+		return cw.Write([]string{
+			strconv.Itoa(u.ID),
+			u.ShortCode,
+			u.URL,
+			u.Title,
+			u.Owner,
+			strconv.Itoa(u.AccessCount),
+			u.CreatedAt.UTC().Format(time.RFC3339Nano),
+			u.UpdatedAt.UTC().Format(time.RFC3339Nano),
+			expiresAt,
+			u.ThreatStatus,
+			u.ThreatMatch,
+			strconv.FormatBool(u.GeneratedCode),
+		})
+	})
+	cw.Flush()
+	if err == nil {
+		err = cw.Error()
+	}
+	return count, err
+}
+
+// RowError explains why a row was rejected or stopped the import
+type RowError struct {
+	Row       int    `json:"row"`
+	ShortCode string `json:"short_code,omitempty"`
+	Error     string `json:"error"`
+	// Rule names the policy rule that rejected the destination
+	Rule string `json:"rule,omitempty"`
+}
+
+// Summary reports the outcome of an import
+type Summary struct {
+	Imported int `json:"imported"`
+	Skipped  int `json:"skipped"`
+	Rejected int `json:"rejected"`
+	// Aborted is set when a taken short code stopped a ConflictFail import.
+	// Rows of earlier batches stay imported.
+	Aborted bool       `json:"aborted,omitempty"`
+	Errors  []RowError `json:"errors,omitempty"`
+}
+
+func (s *Summary) reject(row int, code string, err error) {
+	s.Rejected++
+	if len(s.Errors) < maxReportedErrors {
+		rowErr := RowError{Row: row, ShortCode: code, Error: err.Error()}
+		var violation *policy.Violation
+		if errors.As(err, &violation) {
+			rowErr.Rule = violation.Rule
+		}
+		s.Errors = append(s.Errors, rowErr)
+	}
+}
+
+// Checks are the destination checks links created through the API go
+// through. Import applies them to every row; nil fields are skipped.
+type Checks struct {
+	Normalizer *urlnorm.Normalizer
+	Policy     *policy.Engine
+	Threats    *threat.Feed
+}
+
+// screen normalizes the row's destination, rejects it when the policy or
+// the threat feed refuse it and derives its destination hash
+func (c Checks) screen(u *models.URL) error {
+	if c.Normalizer != nil {
+		normalized, err := c.Normalizer.Normalize(u.URL)
+		if err != nil {
+			return rejectRow("invalid URL %q", u.URL)
+		}
+		u.URL = normalized
+	}
+	if !utils.IsValidURL(u.URL) {
+		return rejectRow("invalid URL %q", u.URL)
+	}
+	if c.Policy != nil {
+		if err := c.Policy.Check(u.URL); err != nil {
+			return &rowError{err: err}
+		}
+	}
+	if c.Threats != nil {
+		if m := c.Threats.Check(u.URL); m != nil {
+			logger.WithFields(logrus.Fields{"url": u.URL, "short_code": u.ShortCode, "match": m.String()}).Warn("Imported destination is on threat feed")
+			return &rowError{err: &policy.Violation{Rule: threat.RuleFeed, Reason: "destination is listed as malicious"}}
+		}
+	}
+	u.DestHash = utils.URLHash(u.URL)
+	return nil
+}
+
+// Import reads links in the given format from r and writes them in batches,
+// resolving taken short codes with onConflict. Destinations go through
+// checks as if the links were created through the API, and rows they refuse
+// are rejected. Rows are numbered from 1, not counting the CSV header.
+// written, if set, is called with the short codes of every committed batch
+// so caches can be invalidated.
+func Import(ctx context.Context, store database.Store, r io.Reader, format, onConflict string, checks Checks, written func(codes ...string)) (*Summary, error) {
+	summary := &Summary{}
+	var next func() (*models.URL, error)
+	if format == FormatJSONL {
+		next = jsonlRows(r)
+	} else {
+		var err error
+		if next, err = csvRows(r); err != nil {
+			return summary, &InputError{Err: err}
+		}
+	}
+
+	var batch []*models.URL
+	var rows []int
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		errs, err := store.ImportBatch(ctx, batch, onConflict)
+		if err != nil {
+			return err
+		}
+
+		var codes []string
+		for i, u := range batch {
+			if errs[i] == nil {
+				codes = append(codes, u.ShortCode)
+				continue
+			}
+			if onConflict == database.ConflictFail {
+				summary.Aborted = true
+				summary.Errors = append(summary.Errors, RowError{Row: rows[i], ShortCode: u.ShortCode, Error: "short code already exists"})
+				return nil
+			}
+			summary.Skipped++
+		}
+		summary.Imported += len(codes)
+		if written != nil && len(codes) > 0 {
+			written(codes...)
+		}
+		batch, rows = batch[:0], rows[:0]
+		return nil
+	}
+
+	now := time.Now().UTC()
+	for row := 1; ; row++ {
+		u, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err == nil {
+			err = validate(u, now)
+		}
+		if err == nil {
+			err = checks.screen(u)
+		}
+		if err != nil {
+			var rowErr *rowError
+			if !errors.As(err, &rowErr) {
+				if flushErr := flush(); flushErr != nil {
+					return summary, flushErr
+				}
+				return summary, &InputError{Row: row, Err: err}
+			}
+			code := ""
+			if u != nil {
+				code = u.ShortCode
+			}
+			summary.reject(row, code, rowErr.err)
+			continue
+		}
+
+		batch = append(batch, u)
+		rows = append(rows, row)
+		if len(batch) == importBatchSize {
+			if err := flush(); err != nil || summary.Aborted {
+				return summary, err
+			}
+		}
+	}
+	return summary, flush()
+}
+
+// InputError reports input that could not be read any further. Rows before
+// it have been processed.
+type InputError struct {
+	Row int
+	Err error
+}
+
+func (e *InputError) Error() string {
+	if e.Row == 0 {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("row %d: %v", e.Row, e.Err)
+}
+
+func (e *InputError) Unwrap() error { return e.Err }
+
+// rowError marks a problem with one row, as opposed to with the input
+type rowError struct {
+	err error
+}
+
+func (e *rowError) Error() string { return e.err.Error() }
+
+func rejectRow(format string, args ...interface{}) error {
+	return &rowError{err: fmt.Errorf(format, args...)}
+}
+
+// validate checks a row apart from its destination and fills in missing
+// timestamps
+func validate(u *models.URL, now time.Time) error {
+	if !utils.IsValidShortCode(u.ShortCode) {
+		return rejectRow("invalid short code %q", u.ShortCode)
+	}
+	if u.AccessCount < 0 {
+		return rejectRow("access_count must not be negative")
+	}
+	switch u.ThreatStatus {
+	case "":
+		u.ThreatMatch = ""
+	case models.ThreatFlagged, models.ThreatDisabled:
+	default:
+		return rejectRow("invalid threat_status %q", u.ThreatStatus)
+	}
+	if u.CreatedAt.IsZero() {
+		u.CreatedAt = now
+	}
+	if u.UpdatedAt.IsZero() {
+		u.UpdatedAt = u.CreatedAt
+	}
+	return nil
+}
+
+func jsonlRows(r io.Reader) func() (*models.URL, error) {
+	dec := json.NewDecoder(r)
+	return func() (*models.URL, error) {
+		var u models.URL
+		row := jsonlRow{URL: &u}
+		if err := dec.Decode(&row); err != nil {
+			var syntaxErr *json.SyntaxError
+			if err == io.EOF || errors.As(err, &syntaxErr) || errors.Is(err, io.ErrUnexpectedEOF) {
+				// The stream cannot be resynchronised after a syntax error
+				return nil, err
+			}
+			return nil, &rowError{err: err}
+		}
+		u.ID = 0
+		u.GeneratedCode = row.GeneratedCode
+		return &u, nil
+	}
+}
+
+func csvRows(r io.Reader) (func() (*models.URL, error), error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading CSV header: %w", err)
+	}
+
+	index := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.TrimPrefix(name, "\ufeff")
+		index[strings.TrimSpace(strings.ToLower(name))] = i
+	}
+	for _, required := range []string{"short_code", "url"} {
+		if _, ok := index[required]; !ok {
+			return nil, fmt.Errorf("CSV header is missing the %s column", required)
+		}
+	}
+
+	return func() (*models.URL, error) {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return nil, err
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			return nil, &rowError{err: err}
+		} else if err != nil {
+			return nil, err
+		}
+
+		field := func(name string) string {
+			if i, ok := index[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		u := &models.URL{
+			ShortCode: field("short_code"),
+			URL:       field("url"),
+			Title:     field("title"),
+			Owner:     field("owner"),
+
+			ThreatStatus: field("threat_status"),
+			ThreatMatch:  field("threat_match"),
+		}
+		if v := field("access_count"); v != "" {
+			if u.AccessCount, err = strconv.Atoi(v); err != nil {
+				return u, rejectRow("invalid access_count %q", v)
+			}
+		}
+		for name, dst := range map[string]*time.Time{"created_at": &u.CreatedAt, "updated_at": &u.UpdatedAt} {
+			if v := field(name); v != "" {
+				if *dst, err = time.Parse(time.RFC3339Nano, v); err != nil {
+					return u, rejectRow("invalid %s %q", name, v)
+				}
+			}
+		}
+		if v := field("generated_code"); v != "" {
+			if u.GeneratedCode, err = strconv.ParseBool(v); err != nil {
+				return u, rejectRow("invalid generated_code %q", v)
+			}
+		}
+		if v := field("expires_at"); v != "" {
+			expiresAt, err := time.Parse(time.RFC3339Nano, v)
+			if err != nil {
+				return u, rejectRow("invalid expires_at %q", v)
+			}
+			u.ExpiresAt = &expiresAt
+		}
+		return u, nil
+	}, nil
+}
@@ -0,0 +1,229 @@
+package transfer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"urlshortner/database"
+	"urlshortner/models"
+	"urlshortner/policy"
+	"urlshortner/threat"
+	"urlshortner/urlnorm"
+	"urlshortner/utils"
+)
+
+func testChecks(t *testing.T) Checks {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "feed.txt")
+	if err := os.WriteFile(file, []byte("host evil.example\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	feed := threat.NewFeed([]string{file}, 0)
+	if err := feed.Load(); err != nil {
+		t.Fatal(err)
+	}
+	return Checks{
+		Normalizer: urlnorm.New([]string{"utm_*"}, false),
+		Policy:     policy.New([]string{"sho.rt"}, nil, false),
+		Threats:    feed,
+	}
+}
+
+func TestImportScreensDestinations(t *testing.T) {
+	ctx := context.Background()
+	store := database.NewMemoryStore()
+	input := strings.Join([]string{
+		"short_code,url",
+		"good1,HTTPS://Example.com/a?utm_source=x&id=1",
+		"local1,http://127.0.0.1/admin",
+		"loop1,https://sho.rt/u/abc",
+		"bad1,https://login.evil.example/",
+		"ftp1,ftp://example.com/file",
+		"x,https://example.com/",
+	}, "\n")
+
+	summary, err := Import(ctx, store, strings.NewReader(input), FormatCSV, database.ConflictSkip, testChecks(t), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Imported != 1 || summary.Rejected != 5 {
+		t.Fatalf("imported %d rejected %d, want 1 and 5: %+v", summary.Imported, summary.Rejected, summary.Errors)
+	}
+
+	rules := map[string]string{}
+	for _, e := range summary.Errors {
+		rules[e.ShortCode] = e.Rule
+	}
+	want := map[string]string{
+		"local1": policy.RulePrivateAddress,
+		"loop1":  policy.RuleSelfReference,
+		"bad1":   threat.RuleFeed,
+		"ftp1":   "",
+		"x":      "",
+	}
+	for code, rule := range want {
+		if got, ok := rules[code]; !ok || got != rule {
+			t.Errorf("row %s: rule %q (reported %v), want %q", code, got, ok, rule)
+		}
+	}
+
+	u, err := store.GetByCode(ctx, "good1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.URL != "https://example.com/a?id=1" {
+		t.Errorf("stored URL %q, want the normalized destination", u.URL)
+	}
+	if u.DestHash != utils.URLHash(u.URL) {
+		t.Errorf("stored dest hash %q, want the hash of %q", u.DestHash, u.URL)
+	}
+}
+
+func TestImportConflictPolicies(t *testing.T) {
+	ctx := context.Background()
+	store := database.NewMemoryStore()
+	if err := store.Create(ctx, &models.URL{URL: "https://old.example/", ShortCode: "taken"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	input := "short_code,url\ntaken,https://new.example/\nfresh,https://fresh.example/\n"
+
+	summary, err := Import(ctx, store, strings.NewReader(input), FormatCSV, database.ConflictSkip, Checks{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Imported != 1 || summary.Skipped != 1 {
+		t.Errorf("skip: imported %d skipped %d, want 1 and 1", summary.Imported, summary.Skipped)
+	}
+
+	var written []string
+	summary, err = Import(ctx, store, strings.NewReader(input), FormatCSV, database.ConflictOverwrite, Checks{}, func(codes ...string) {
+		written = append(written, codes...)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Imported != 2 || len(written) != 2 {
+		t.Errorf("overwrite: imported %d, invalidated %v", summary.Imported, written)
+	}
+	if u, _ := store.GetByCode(ctx, "taken"); u == nil || u.URL != "https://new.example/" {
+		t.Errorf("overwrite kept the old destination: %+v", u)
+	}
+
+	summary, err = Import(ctx, store, strings.NewReader(input), FormatCSV, database.ConflictFail, Checks{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !summary.Aborted || summary.Imported != 0 {
+		t.Errorf("fail: aborted %v imported %d, want an aborted import", summary.Aborted, summary.Imported)
+	}
+}
+
+// oneCode is a CodeAllocator always offering the same code
+type oneCode string
+
+func (c oneCode) Next(ctx context.Context, collisions int) (string, error) {
+	return string(c), nil
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	src := database.NewMemoryStore()
+	if err := src.Create(ctx, &models.URL{URL: "https://a.example/", ShortCode: "aaa", Title: "A, with comma", Owner: "ops"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := src.Create(ctx, &models.URL{URL: "https://b.example/?q=1"}, oneCode("bbb")); err != nil {
+		t.Fatal(err)
+	}
+	if err := src.SetThreatStatus(ctx, "aaa", "https://a.example/", models.ThreatDisabled, "host evil.example (feed.txt:1)"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, format := range []string{FormatCSV, FormatJSONL} {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			n, err := Export(ctx, src, &buf, format)
+			if err != nil || n != 2 {
+				t.Fatalf("Export wrote %d rows: %v", n, err)
+			}
+
+			dst := database.NewMemoryStore()
+			summary, err := Import(ctx, dst, &buf, format, database.ConflictFail, Checks{}, nil)
+			if err != nil || summary.Imported != 2 {
+				t.Fatalf("Import: %+v, %v", summary, err)
+			}
+			u, err := dst.GetByCode(ctx, "aaa")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if u.Title != "A, with comma" || u.Owner != "ops" {
+				t.Errorf("round trip lost fields: %+v", u)
+			}
+			if u.ThreatStatus != models.ThreatDisabled || u.ThreatMatch != "host evil.example (feed.txt:1)" {
+				t.Errorf("round trip lost threat status: %q %q", u.ThreatStatus, u.ThreatMatch)
+			}
+			if u.GeneratedCode {
+				t.Error("custom code imported as generated")
+			}
+			// The generated link stays reusable for its destination
+			if u, err := dst.FindReusable(ctx, "", utils.URLHash("https://b.example/?q=1")); err != nil || u.ShortCode != "bbb" {
+				t.Errorf("FindReusable after round trip = %+v, %v, want bbb", u, err)
+			}
+		})
+	}
+}
+
+func TestImportStopsOnBrokenInput(t *testing.T) {
+	input := "{\"short_code\":\"ok1\",\"url\":\"https://a.example/\"}\n{broken\n"
+	summary, err := Import(context.Background(), database.NewMemoryStore(), strings.NewReader(input), FormatJSONL, database.ConflictSkip, Checks{}, nil)
+	var inputErr *InputError
+	if err == nil || !errors.As(err, &inputErr) || inputErr.Row != 2 {
+		t.Fatalf("err = %v, want an InputError on row 2", err)
+	}
+	if summary.Imported != 1 {
+		t.Errorf("imported %d rows before the broken one, want 1", summary.Imported)
+	}
+}
+
+func TestImportThreatStatus(t *testing.T) {
+	ctx := context.Background()
+	store := database.NewMemoryStore()
+	if err := store.Create(ctx, &models.URL{URL: "https://old.example/", ShortCode: "stale"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SetThreatStatus(ctx, "stale", "https://old.example/", models.ThreatFlagged, "host old.example (feed.txt:1)"); err != nil {
+		t.Fatal(err)
+	}
+	input := strings.Join([]string{
+		"short_code,url,threat_status,threat_match",
+		"stale,https://new.example/,,",
+		"flag1,https://flag.example/,flagged,host flag.example (feed.txt:2)",
+		"odd1,https://odd.example/,quarantined,",
+		"nomatch,https://c.example/,,leftover",
+	}, "\n")
+
+	summary, err := Import(ctx, store, strings.NewReader(input), FormatCSV, database.ConflictOverwrite, Checks{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Imported != 3 || summary.Rejected != 1 || summary.Errors[0].ShortCode != "odd1" {
+		t.Fatalf("summary %+v, want odd1 rejected", summary)
+	}
+	for code, want := range map[string][2]string{
+		"stale":   {"", ""},
+		"flag1":   {models.ThreatFlagged, "host flag.example (feed.txt:2)"},
+		"nomatch": {"", ""},
+	} {
+		u, err := store.GetByCode(ctx, code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if u.ThreatStatus != want[0] || u.ThreatMatch != want[1] {
+			t.Errorf("%s: status %q match %q, want %q %q", code, u.ThreatStatus, u.ThreatMatch, want[0], want[1])
+		}
+	}
+}
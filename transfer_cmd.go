@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"urlshortner/config"
+	"urlshortner/database"
+	"urlshortner/threat"
+	"urlshortner/transfer"
+	"urlshortner/urlnorm"
+	"urlshortner/utils"
+)
+
+// runExport implements `main export <file.csv|file.jsonl>`. A file of "-"
+// writes CSV to stdout.
+func runExport(cfg *config.Config, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: export <file.csv|file.jsonl>")
+	}
+	format, err := fileFormat(args[0])
+	if err != nil {
+		return err
+	}
+
+	store := database.InitDB(cfg.DatabaseURL)
+	defer database.DB.Close()
+
+	var w io.Writer = os.Stdout
+	if args[0] != "-" {
+		f, err := os.Create(args[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	count, err := transfer.Export(context.Background(), store, w, format)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Exported %d link(s)\n", count)
+	return nil
+}
+
+// runImport implements `main import <file.csv|file.jsonl> [skip|overwrite|fail]`.
+// A file of "-" reads CSV from stdin. Running servers keep serving cached
+// redirects for up to CACHE_TTL.
+func runImport(cfg *config.Config, args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return fmt.Errorf("usage: import <file.csv|file.jsonl> [skip|overwrite|fail]")
+	}
+	if cfg.DatabaseURL == "memory://" {
+		return fmt.Errorf("links imported into the in-memory store would be lost immediately")
+	}
+	format, err := fileFormat(args[0])
+	if err != nil {
+		return err
+	}
+	onConflict := database.ConflictSkip
+	if len(args) == 2 {
+		onConflict = args[1]
+	}
+	if !transfer.ValidConflictPolicy(onConflict) {
+		return fmt.Errorf("unknown conflict policy %q, expected skip, overwrite or fail", onConflict)
+	}
+	checks, err := importChecks(cfg)
+	if err != nil {
+		return err
+	}
+
+	store := database.InitDB(cfg.DatabaseURL)
+	defer database.DB.Close()
+
+	var r io.Reader = os.Stdin
+	if args[0] != "-" {
+		f, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	summary, err := transfer.Import(context.Background(), store, r, format, onConflict, checks, nil)
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(summary)
+	if err != nil {
+		return err
+	}
+	if summary.Aborted {
+		return fmt.Errorf("import aborted on a taken short code")
+	}
+	return nil
+}
+
+// importChecks builds the destination checks the server applies to new
+// links from the same settings
+func importChecks(cfg *config.Config) (transfer.Checks, error) {
+	destinationPolicy, err := loadPolicy(cfg)
+	if err != nil {
+		return transfer.Checks{}, fmt.Errorf("loading destination policy: %w", err)
+	}
+	threats := threat.NewFeed(utils.SplitList(cfg.ThreatFeedFiles), cfg.ThreatReloadInterval)
+	if threats.Enabled() {
+		if err := threats.Load(); err != nil {
+			return transfer.Checks{}, fmt.Errorf("loading threat feed: %w", err)
+		}
+	}
+	return transfer.Checks{
+		Normalizer: urlnorm.New(utils.SplitList(cfg.URLStripParams), cfg.URLSortQuery),
+		Policy:     destinationPolicy,
+		Threats:    threats,
+	}, nil
+}
+
+// fileFormat picks the transfer format from a file extension
+func fileFormat(path string) (string, error) {
+	if path == "-" {
+		return transfer.FormatCSV, nil
+	}
+	format := strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	if format == "ndjson" {
+		format = transfer.FormatJSONL
+	}
+	if !transfer.ValidFormat(format) {
+		return "", fmt.Errorf("cannot tell the format of %s, use a .csv or .jsonl file", path)
+	}
+	return format, nil
+}
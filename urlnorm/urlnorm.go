@@ -0,0 +1,202 @@
+package urlnorm
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+var (
+	// ErrInvalid is returned for input that cannot be read as a URL
+	ErrInvalid = errors.New("invalid URL")
+	// ErrScheme is returned for URLs that are not http or https
+	ErrScheme = errors.New("only http and https URLs are supported")
+)
+
+var schemeRegex = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9+.-]*://`)
+
+// Normalizer rewrites URLs into a canonical form so that equivalent
+// destinations compare equal
+type Normalizer struct {
+	stripExact    map[string]bool
+	stripPrefixes []string
+	sortQuery     bool
+}
+
+// New creates a Normalizer that drops the query parameters named in
+// stripParams, where a trailing "*" matches any suffix (e.g. "utm_*"), and
+// with sortQuery orders the remaining parameters by name
+func New(stripParams []string, sortQuery bool) *Normalizer {
+	n := &Normalizer{stripExact: make(map[string]bool), sortQuery: sortQuery}
+	for _, p := range stripParams {
+		p = strings.ToLower(strings.TrimSpace(p))
+		if p == "" {
+			continue
+		}
+		if prefix, ok := strings.CutSuffix(p, "*"); ok {
+			n.stripPrefixes = append(n.stripPrefixes, prefix)
+		} else {
+			n.stripExact[p] = true
+		}
+	}
+	return n
+}
+
+// Normalize returns the canonical form of raw. Input without a scheme is
+// taken to be http. Scheme and host are lower-cased, internationalised hosts
+// converted to punycode, default ports dropped, dot segments resolved and
+// the configured query parameters stripped and sorted.
+func (n *Normalizer) Normalize(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", ErrInvalid
+	}
+	if !schemeRegex.MatchString(raw) {
+		raw = "http://" + raw
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", ErrInvalid
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", ErrScheme
+	}
+
+	host, err := normalizeHost(u.Hostname())
+	if err != nil {
+		return "", err
+	}
+	port := u.Port()
+	if (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		port = ""
+	}
+	switch {
+	case port != "":
+		u.Host = net.JoinHostPort(host, port)
+	case strings.Contains(host, ":"):
+		u.Host = "[" + host + "]"
+	default:
+		u.Host = host
+	}
+
+	escapedPath := removeDotSegments(u.EscapedPath())
+	if escapedPath == "" {
+		escapedPath = "/"
+	}
+	if u.Path, err = url.PathUnescape(escapedPath); err != nil {
+		return "", ErrInvalid
+	}
+	u.RawPath = escapedPath
+
+	u.RawQuery = n.normalizeQuery(u.RawQuery)
+	u.ForceQuery = false
+
+	return u.String(), nil
+}
+
+func normalizeHost(host string) (string, error) {
+	host = strings.TrimSuffix(host, ".")
+	if host == "" {
+		return "", ErrInvalid
+	}
+	for i := 0; i < len(host); i++ {
+		if host[i] >= 0x80 {
+			ascii, err := idna.Lookup.ToASCII(host)
+			if err != nil {
+				return "", ErrInvalid
+			}
+			return ascii, nil
+		}
+	}
+	return strings.ToLower(host), nil
+}
+
+// removeDotSegments resolves "." and ".." in an absolute path as described
+// in RFC 3986 section 5.2.4, keeping a trailing slash
+func removeDotSegments(p string) string {
+	if !strings.Contains(p, ".") {
+		return p
+	}
+
+	segments := strings.Split(p, "/")
+	out := make([]string, 0, len(segments))
+	for i, seg := range segments {
+		last := i == len(segments)-1
+		switch seg {
+		case ".":
+			if last {
+				out = append(out, "")
+			}
+		case "..":
+			if len(out) > 1 {
+				out = out[:len(out)-1]
+			}
+			if last {
+				out = append(out, "")
+			}
+		default:
+			out = append(out, seg)
+		}
+	}
+	result := strings.Join(out, "/")
+	if !strings.HasPrefix(result, "/") {
+		result = "/" + result
+	}
+	return result
+}
+
+// normalizeQuery drops stripped parameters and optionally sorts the rest,
+// keeping each remaining pair exactly as it was encoded
+func (n *Normalizer) normalizeQuery(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+
+	type pair struct {
+		key string
+		raw string
+	}
+	var pairs []pair
+	for _, raw := range strings.Split(rawQuery, "&") {
+		if raw == "" {
+			continue
+		}
+		key, _, _ := strings.Cut(raw, "=")
+		if unescaped, err := url.QueryUnescape(key); err == nil {
+			key = unescaped
+		}
+		if n.stripped(key) {
+			continue
+		}
+		pairs = append(pairs, pair{key: key, raw: raw})
+	}
+	if n.sortQuery {
+		sort.SliceStable(pairs, func(i, j int) bool { return pairs[i].key < pairs[j].key })
+	}
+
+	kept := make([]string, len(pairs))
+	for i, p := range pairs {
+		kept[i] = p.raw
+	}
+	return strings.Join(kept, "&")
+}
+
+func (n *Normalizer) stripped(key string) bool {
+	key = strings.ToLower(key)
+	if n.stripExact[key] {
+		return true
+	}
+	for _, prefix := range n.stripPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
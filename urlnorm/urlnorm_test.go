@@ -0,0 +1,64 @@
+package urlnorm
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	n := New([]string{"utm_*", "fbclid"}, true)
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"example.com", "http://example.com/"},
+		{"HTTPS://Example.COM:443/a/./b/../c", "https://example.com/a/c"},
+		{"http://example.com:80/", "http://example.com/"},
+		{"http://example.com:8080/x/", "http://example.com:8080/x/"},
+		{"http://example.com./", "http://example.com/"},
+		{"http://bücher.example/", "http://xn--bcher-kva.example/"},
+		{"http://[::1]:80/", "http://[::1]/"},
+		{"https://example.com/?b=2&utm_source=x&a=1&FBCLID=y", "https://example.com/?a=1&b=2"},
+		{"https://example.com/p?", "https://example.com/p"},
+		{"https://example.com/a%2Fb?q=a%20b", "https://example.com/a%2Fb?q=a%20b"},
+	}
+	for _, tt := range tests {
+		got, err := n.Normalize(tt.in)
+		if err != nil {
+			t.Errorf("Normalize(%q) error: %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Normalize(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeKeepsQueryOrderUnlessSorting(t *testing.T) {
+	got, err := New(nil, false).Normalize("https://example.com/?b=2&a=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "https://example.com/?b=2&a=1" {
+		t.Errorf("got %q, want the original parameter order", got)
+	}
+}
+
+func TestNormalizeRejects(t *testing.T) {
+	n := New(nil, false)
+	tests := []struct {
+		in   string
+		want error
+	}{
+		{"", ErrInvalid},
+		{"   ", ErrInvalid},
+		{"ftp://example.com/", ErrScheme},
+		{"javascript://alert(1)", ErrScheme},
+		{"http:///path", ErrInvalid},
+	}
+	for _, tt := range tests {
+		if _, err := n.Normalize(tt.in); !errors.Is(err, tt.want) {
+			t.Errorf("Normalize(%q) error = %v, want %v", tt.in, err, tt.want)
+		}
+	}
+}
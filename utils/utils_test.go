@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitList(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"", nil},
+		{" , ,", nil},
+		{"a", []string{"a"}},
+		{" utm_* ,fbclid,, gclid ", []string{"utm_*", "fbclid", "gclid"}},
+		{"/etc/feeds/a.txt,/etc/feeds/b.txt", []string{"/etc/feeds/a.txt", "/etc/feeds/b.txt"}},
+	}
+	for _, tt := range tests {
+		if got := SplitList(tt.in); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("SplitList(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestIsValidShortCode(t *testing.T) {
+	for code, want := range map[string]bool{
+		"abc":                   true,
+		"Ab3xY9":                true,
+		"ab":                    false,
+		"abcdefghijklmnopqrstu": false,
+		"has-dash":              false,
+		"ünï":                   false,
+	} {
+		if got := IsValidShortCode(code); got != want {
+			t.Errorf("IsValidShortCode(%q) = %v, want %v", code, got, want)
+		}
+	}
+}
+
+func TestIsValidURL(t *testing.T) {
+	for u, want := range map[string]bool{
+		"https://example.com/x": true,
+		"http://a.b":            true,
+		"":                      false,
+		"example.com":           false,
+		"ftp://example.com/":    false,
+		"https://exa mple.com/": false,
+	} {
+		if got := IsValidURL(u); got != want {
+			t.Errorf("IsValidURL(%q) = %v, want %v", u, got, want)
+		}
+	}
+}